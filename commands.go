@@ -0,0 +1,261 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/BlunterMonk/StreamNotify/pkg/config"
+	"github.com/BlunterMonk/StreamNotify/pkg/kodi"
+	"github.com/BlunterMonk/StreamNotify/pkg/priority"
+	"github.com/BlunterMonk/StreamNotify/pkg/queue"
+	yt "github.com/BlunterMonk/StreamNotify/pkg/youtube"
+)
+
+// runCommand handles command line sub commands, returning the exit code
+func runCommand(name string, args []string) int {
+	switch name {
+	case "fixtures":
+		return fixturesCommand(args)
+	case "kodi-index":
+		return kodiIndexCommand(args)
+	case "queue":
+		return queueCommand(args)
+	case "explain":
+		return explainCommand(args)
+	}
+
+	fmt.Printf("unknown command: %v\n", name)
+	fmt.Println("commands:")
+	fmt.Println("  fixtures   record youtube pages for every configured channel, or replay them with -replay")
+	fmt.Println("  queue      show the live stream queue of the running app, or change it with skip, move or remove")
+	fmt.Println("  kodi-index rescan the kodi media index, or search it with -ext, -label and -folder")
+	fmt.Println("  explain    check every channel and say which live stream would be autoplayed and why")
+	return 2
+}
+
+func fixturesCommand(args []string) int {
+	fs := flag.NewFlagSet("fixtures", flag.ContinueOnError)
+	dir := fs.String("dir", fixturesDir(), "directory fixtures are saved to")
+	replay := fs.Bool("replay", false, "run the parser against every recorded fixture instead of recording")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *replay {
+		list, err := yt.LoadFixtures(*dir)
+		if err != nil {
+			log.Println("failed to load fixtures:", err)
+			return 1
+		}
+
+		failed := 0
+		for _, f := range list {
+			if f.Location != "" {
+				fmt.Printf("%v %v: redirect to %v\n", f.RecordedAt.Format("2006-01-02 15:04:05"), f.Channel, f.Location)
+				continue
+			}
+
+			if yt.IsChatFixture(f) {
+				page, err := yt.ParseChatFixture(f)
+				if errors.Is(err, yt.ErrChatEnded) || errors.Is(err, yt.ErrChatDisabled) {
+					fmt.Printf("%v %v: %v\n", f.RecordedAt.Format("2006-01-02 15:04:05"), f.Channel, err)
+					continue
+				}
+				if err != nil {
+					failed++
+					fmt.Printf("%v %v: %v\n", f.RecordedAt.Format("2006-01-02 15:04:05"), f.Channel, err)
+					continue
+				}
+				fmt.Printf("%v %v: messages: %v, next poll: %v\n", f.RecordedAt.Format("2006-01-02 15:04:05"), f.Channel,
+					len(page.Messages), page.Timeout)
+				for _, m := range page.Messages {
+					fmt.Printf("    %v: %v\n", m.Author, m.Text)
+				}
+				continue
+			}
+
+			res, err := yt.ParseFixture(f)
+			if err != nil {
+				failed++
+				fmt.Printf("%v %v: %v\n", f.RecordedAt.Format("2006-01-02 15:04:05"), f.Channel, err)
+				continue
+			}
+			fmt.Printf("%v %v: live: %v, id: %v, title: %v\n", f.RecordedAt.Format("2006-01-02 15:04:05"), f.Channel,
+				res.VideoDetails.IsLive, res.VideoDetails.VideoID, res.VideoDetails.Title)
+		}
+
+		fmt.Printf("%v fixtures, %v failed to parse\n", len(list), failed)
+		if failed > 0 {
+			return 1
+		}
+		return 0
+	}
+
+	if err := yt.UseCookieJar(fmt.Sprintf("%v/cookies.json", config.ConfigPath)); err != nil {
+		log.Println("failed to load youtube cookies:", err)
+	}
+	yt.SetConsentCookie(config.Get().ConsentCookie)
+	yt.Record(*dir)
+
+	channels := config.Get().Channels
+	streamInfo := yt.GetAllChannelStatus(channels)
+
+	names := make([]string, 0, len(channels))
+	for k := range channels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		// a failed channel is missing, or has its last known details marked stale
+		v, ok := streamInfo[k]
+		if !ok || v.Stale {
+			fmt.Printf("%v: failed\n", k)
+			continue
+		}
+		fmt.Printf("%v: live: %v, id: %v, title: %v\n", k, v.VideoDetails.IsLive, v.VideoDetails.VideoID, v.VideoDetails.Title)
+	}
+
+	fmt.Println("fixtures saved to", *dir)
+	return 0
+}
+
+func fixturesDir() string {
+	return fmt.Sprintf("%v/fixtures", config.ConfigPath)
+}
+
+func kodiIndexCommand(args []string) int {
+	fs := flag.NewFlagSet("kodi-index", flag.ContinueOnError)
+	dir := fs.String("dir", config.Get().MusicDir, "kodi directory to index")
+	ext := fs.String("ext", "", "only list files with this extension, e.g. .mp4")
+	label := fs.String("label", "", "only list files whose label contains this")
+	folder := fs.String("folder", "", "only list files in this kodi folder or below it")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg := config.Get()
+	c := kodi.NewClient(cfg.Host, cfg.Port, cfg.KodiUsername, cfg.KodiPassword, kodi.DefaultTimeout)
+	idx := kodi.NewIndex(c, kodiIndexFile(), time.Duration(cfg.KodiIndexTTL)*time.Minute)
+
+	// searching uses the saved index, otherwise rescan now
+	if *ext == "" && *label == "" && *folder == "" {
+		if err := idx.Refresh(*dir); err != nil {
+			log.Println("failed to scan kodi directory:", err)
+			return 1
+		}
+	}
+
+	q := kodi.Query{Label: *label, Folder: *folder}
+	if *ext != "" {
+		q.Extensions = []string{*ext}
+	}
+	list, err := idx.Query(*dir, q)
+	if err != nil {
+		log.Println("failed to query kodi index:", err)
+		return 1
+	}
+
+	for _, f := range list {
+		fmt.Printf("%v\t%v\n", f.Label, f.File)
+	}
+	fmt.Printf("%v files in %v\n", len(list), *dir)
+	return 0
+}
+
+func queueCommand(args []string) int {
+	fs := flag.NewFlagSet("queue", flag.ContinueOnError)
+	addr := fs.String("addr", config.Get().ControlAddr, "address of the running app")
+	fs.Usage = func() {
+		fmt.Println("usage: queue [-addr host:port] [list | skip | move <video id> <position> | remove <video id>]")
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *addr == "" {
+		*addr = queue.DefaultAddr
+	}
+
+	c := queue.NewClient(*addr)
+	var st queue.State
+	var err error
+
+	cmd := fs.Arg(0)
+	switch cmd {
+	case "", "list":
+		st, err = c.List()
+	case "skip":
+		st, err = c.Skip()
+	case "move":
+		// positions start at 1 for the stream that plays next
+		pos, perr := strconv.Atoi(fs.Arg(2))
+		if fs.NArg() != 3 || perr != nil {
+			fs.Usage()
+			return 2
+		}
+		st, err = c.Move(fs.Arg(1), pos-1)
+	case "remove":
+		if fs.NArg() != 2 {
+			fs.Usage()
+			return 2
+		}
+		st, err = c.Remove(fs.Arg(1))
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		log.Printf("queue %v failed: %v\n", cmd, err)
+		return 1
+	}
+
+	if st.Current.VideoID != "" {
+		fmt.Printf("playing: %v %v (%v)\n", st.Current.Channel, st.Current.Title, st.Current.VideoID)
+	}
+	for i, e := range st.Entries {
+		fmt.Printf("%3d. %v %v (%v)\n", i+1, e.Channel, e.Title, e.VideoID)
+	}
+	if len(st.Entries) == 0 {
+		fmt.Println("the queue is empty")
+	}
+	return 0
+}
+
+func explainCommand(args []string) int {
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	at := fs.String("at", "", "explain the rules at another time, as \"2006-01-02 15:04\"")
+	playing := fs.String("playing", "", "channel that's playing, it's kept if nothing higher is live")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	now := time.Now()
+	if *at != "" {
+		t, err := time.ParseInLocation("2006-01-02 15:04", *at, time.Local)
+		if err != nil {
+			log.Println("invalid time:", err)
+			return 2
+		}
+		now = t
+	}
+
+	if err := yt.UseCookieJar(fmt.Sprintf("%v/cookies.json", config.ConfigPath)); err != nil {
+		log.Println("failed to load youtube cookies:", err)
+	}
+	yt.SetConsentCookie(config.Get().ConsentCookie)
+	if config.Get().ReplayFixtures {
+		yt.Replay(fixturesDir())
+	}
+	streamInfo := yt.GetAllChannelStatus(config.Get().Channels)
+
+	plan := priority.Current(now)
+	e := plan.Explain(priority.Candidates(streamInfo), *playing, rand.New(rand.NewSource(time.Now().UnixNano())))
+	fmt.Print(e)
+	return 0
+}
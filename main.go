@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,28 +8,38 @@ import (
 	"log"
 	"math/rand"
 	"net"
-	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path"
 	"path/filepath"
-	"regexp"
-	"strconv"
-	"strings"
 	"syscall"
 	"time"
 
+	"github.com/BlunterMonk/StreamNotify/pkg/browser"
+	"github.com/BlunterMonk/StreamNotify/pkg/chatwatch"
 	"github.com/BlunterMonk/StreamNotify/pkg/config"
+	"github.com/BlunterMonk/StreamNotify/pkg/kodi"
+	"github.com/BlunterMonk/StreamNotify/pkg/mpv"
+	"github.com/BlunterMonk/StreamNotify/pkg/multiview"
+	"github.com/BlunterMonk/StreamNotify/pkg/player"
+	"github.com/BlunterMonk/StreamNotify/pkg/queue"
+	"github.com/BlunterMonk/StreamNotify/pkg/recorder"
+	"github.com/BlunterMonk/StreamNotify/pkg/resolve"
+	"github.com/BlunterMonk/StreamNotify/pkg/scheduler"
+	"github.com/BlunterMonk/StreamNotify/pkg/thumbcache"
 	"github.com/BlunterMonk/StreamNotify/pkg/toast"
+	"github.com/BlunterMonk/StreamNotify/pkg/vlc"
 	yt "github.com/BlunterMonk/StreamNotify/pkg/youtube"
 )
 
 var (
 	history []string //
+	thumbs  *thumbcache.Cache
+	vlcCmd  *exec.Cmd
 
-	// state
-	sleeping = false
+	// resolves youtube videos to direct stream urls, shared by every player window
+	resolver *resolve.Resolver
 )
 
 const (
@@ -48,13 +57,26 @@ const (
 	// in minutes
 	liveCheckTimer = 15
 	ambienceTimer  = 1
+
+	// thumbnail size used for notifications
+	thumbWidth            = 640
+	thumbHeight           = 360
+	defaultThumbCacheSize = 50
+
+	// first vlc rc port of the multiview windows, the main vlc uses 4212
+	defaultMultiviewPort = 4213
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	var xCode int
-	var streamInfo map[string]yt.VideoDetails
-	var sleeping bool
-	var vlcStatus VLCStatus
+	rand.Seed(time.Now().UnixNano())
+
+	// player status is shared between the player backend and the scheduler
+	status := player.NewStore()
 
 	sigc := make(chan os.Signal, 1)
 	signal.Notify(sigc, syscall.SIGTERM, syscall.SIGINT)
@@ -88,244 +110,134 @@ func main() {
 		}
 	}()
 
-	log.Println("starting vlc service...")
-	// TODO: detect disconnects or stuck state, restart vlc and continue
-
-	// Connect to VLC's RC interface
-	conn, err := startAndConnectVlcService()
+	// the scheduler only talks to the player, the backend is chosen by autoPlayApp
+	client, err := newPlayer(config.Get().AutoPlayApp)
 	if err != nil {
 		panic(err.Error())
 	}
-	defer conn.Close()
+	if c, ok := client.(io.Closer); ok {
+		defer c.Close()
+	}
 
-	// Read and process the response from VLC
-	go func() {
-		scanner := bufio.NewScanner(conn)
-		for scanner.Scan() {
-			line := scanner.Text()
-
-			// Parse the lines and assign to struct fields
-			fmt.Println("===", line)
-			// fmt.Println("===")
-			if strings.Contains(line, "state") {
-				vlcStatus.State = parseState(line)
-				// fmt.Println("state", vlcStatus.State)
-			}
-			if strings.Contains(line, "input") {
-				vlcStatus.CurrentVideo = parseInput(line)
-				// fmt.Println("input", vlcStatus.CurrentVideo)
-				vlcStatus.VideoId = parseVideoId(vlcStatus.CurrentVideo)
-				// fmt.Println("video id", vlcStatus.VideoId)
-			}
-			if strings.Contains(line, "time") {
-				vlcStatus.Time = parseFloat(line)
-			}
-			if strings.Contains(line, "length") {
-				vlcStatus.Length = parseFloat(line)
+	// kodi pushes player changes over its websocket, so they don't wait for the next status poll
+	if k, ok := client.(*kodi.Client); ok {
+		listener := kodi.NewListener(config.Get().Host, config.Get().KodiNotifyPort, k, status)
+		go listener.Run()
+		defer listener.Close()
+	}
+
+	// mpv reports its property changes as they happen, so they don't wait for the next status poll either
+	mp := client
+	if r, ok := mp.(*resolve.Player); ok {
+		mp = r.Player()
+	}
+	if m, ok := mp.(*mpv.Player); ok {
+		res := streamResolver()
+		m.Watch(func(s player.Status) {
+			// resolved stream urls are mapped back to their video, the same as the polled status
+			if res != nil {
+				if id, ok := res.VideoID(s.Input); ok {
+					s.VideoID = id
+				}
 			}
-		}
+			status.Set(s)
+		})
+	}
 
-		if err := scanner.Err(); err != nil {
-			fmt.Println("Error reading response:", err)
+	// live streams waiting behind the current one, controlled with the queue command
+	streams := queue.New()
+	addr := config.Get().ControlAddr
+	if addr == "" {
+		addr = queue.DefaultAddr
+	}
+	srv := queue.NewServer(addr, streams)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil {
+			log.Println("queue control server stopped:", err)
 		}
 	}()
+	defer srv.Close()
 
-	st := time.NewTicker(time.Duration(2) * time.Second)
-	lt := time.NewTicker(time.Duration(config.Config.LiveTimer) * time.Minute)
-	at := time.NewTicker(time.Duration(config.Config.AmbienceTimer) * time.Minute)
-	qt := time.NewTicker(time.Duration(config.Config.QuietTimer) * time.Minute)
-	rt := time.NewTicker(time.Duration(12 * time.Hour))
-
-	thumbDir := fmt.Sprintf("%v/thumb/", config.ConfigPath)
-	mkdir(thumbDir)
-	if nil != RemoveContents(thumbDir) {
-		log.Fatal("Failed to clear cached thumbnails")
+	thumbs, err = thumbcache.New(fmt.Sprintf("%v/thumb", config.ConfigPath), thumbCacheBytes())
+	if err != nil {
+		log.Println("failed to open thumbnail cache:", err)
 	}
 
-	// load in channel status
-	streamInfo = yt.GetAllChannelStatus(config.Config.Channels)
-	for _, v := range streamInfo {
-		on := v.VideoDetails.IsLive
-		if !on {
-			continue
-		}
-
-		notify(v)
-
-		// if !started && config.Config.AutoPlay {
-		// 	playYoutubeVideo(v.VideoDetails.VideoID, v)
-		// 	playingAmbient = v.VideoDetails.VideoID
-		// 	started = true
-		// }
+	if err := yt.UseCookieJar(fmt.Sprintf("%v/cookies.json", config.ConfigPath)); err != nil {
+		log.Println("failed to load youtube cookies:", err)
 	}
-	if quietTime(config.Config.QuietStartTime, config.Config.QuietEndTime) {
-		if vlcStatus.State > 0 {
-			log.Println("quiet hours, stopping all playback")
-			stopPlayback(conn)
-			sleeping = true
-		}
+	if config.Get().ReplayFixtures {
+		log.Println("replaying youtube responses from", fixturesDir())
+		yt.Replay(fixturesDir())
+	} else if config.Get().RecordFixtures {
+		log.Println("recording youtube responses to", fixturesDir())
+		yt.Record(fixturesDir())
 	}
 
-F: //loop
-	for {
-		select {
-		case <-rt.C:
-			// Clear cache and history every 12 hours so it doesn't get out of hand
-			RemoveContents(thumbDir)
-			break
-		case <-st.C:
-			// Send the "status" command to VLC
-			// fmt.Println("updating vlc status")
-			_, err := conn.Write([]byte("status\n"))
-			if err != nil {
-				fmt.Println("Error sending command:", err)
-				// return vlcStatus, err
-			}
-		case <-lt.C:
-			config.LoadConfig()
-			streamInfo = yt.GetAllChannelStatus(config.Config.Channels)
-
-			// go down the list of streamers to track, play the highest priority that is streaming
-			for _, v := range streamInfo {
-
-				on := v.VideoDetails.IsLive
-				if !on {
-					continue
-				}
-
-				notify(v)
-			}
-			break
-		case <-qt.C:
-			// halt all playback during quiet hours
-			if quietTime(config.Config.QuietStartTime, config.Config.QuietEndTime) {
-				if vlcStatus.State > 0 {
-					log.Println("quiet hours, stopping all playback")
-					stopPlayback(conn)
-					sleeping = true
-				}
-			}
-			break
-
-		case <-at.C:
-			// var np string
-			priority := strings.Split(config.Config.Priority, ",")
-			// on, id := videoIsPlaying(conn)
-			on := vlcStatus.State > 0 && vlcStatus.State != 5
-			// id := vlcStatus.CurrentVideo
-			np := vlcStatus.CurrentVideo
-
-			// if a video is playing, find out what video
-			if on {
-				// np = getPlayingVideoTitle(id)
-				log.Printf("Now Playing: %v\n", np)
-
-				// reset sleep timer if a new video starts playing after quiet hours were triggered
-				// this probably means a video was played manually when staying up later than normal
-				if sleeping {
-					sleeping = false
-					continue F
-				}
-			}
-
-			// Do not attempt to play anything during quiet hours
-			if quietTime(config.Config.QuietStartTime, config.Config.QuietEndTime) {
-				continue
-			}
+	// chat of the stream that's playing is watched for keywords and messages from the streamer
+	chat := chatwatch.New(scheduler.ChatRules, notifyChat)
 
-			log.Println("attempting to play priority live stream")
-
-			// go down the list of streamers to track, play the highest priority that is streaming
-			for i := 0; i < len(priority); i++ {
-				// cid := Config.Channels[priority[i]]
-				// on, vid, title := checkYoutubePage(cid)
-				// fmt.Printf("Channel: %v, live: %v\n", priority[i], on)
-				name := strings.Trim(priority[i], " ")
-				on := streamInfo[name].VideoDetails.IsLive
-				// title := streamInfo[name].VideoDetails.Title
-				vid := streamInfo[name].VideoDetails.VideoID
-				if !on {
-					continue
-				}
-
-				// don't try to play the same video
-				if strings.Contains(vlcStatus.VideoId, vid) {
-					log.Println("video already playing:", vid)
-					continue F
-				}
-
-				playYoutubeVideo(conn, vid, streamInfo[name])
-				continue F
-			}
+	opts := scheduler.Options{
+		Status:   channelStatus{},
+		Notifier: toastNotifier{},
+		Player:   client,
+		Store:    status,
+		Queue:    streams,
+		Skips:    srv.Skips(),
+		Chat:     chat,
+		Reload:   config.LoadConfig,
+	}
 
-			log.Println("no priority streams available, attempting to play a low priority stream")
+	// multiview opens its own player windows when several priority streams are live
+	if mc := config.Get().Multiview; mc.Windows > 1 {
+		n, w, h := mc.Windows, mc.ScreenWidth, mc.ScreenHeight
+		if w <= 0 || h <= 0 {
+			w, h = 1920, 1080
+		}
+		mv := multiview.New(n, w, h, newMultiviewPlayer)
+		defer mv.Close()
+		opts.Multiview = mv
+	}
 
-			for _, v := range streamInfo {
-				if strings.Contains(vlcStatus.VideoId, v.VideoDetails.VideoID) {
-					on = v.VideoDetails.IsLive
-					break
-				}
-			}
+	// priority streams are recorded whatever is playing, even during quiet hours
+	rec := newRecorder()
+	if rec != nil {
+		opts.Recorder = rec
+	}
 
-			// only continue if what's playing is ambient music or nothing
-			// this way we don't overwrite manually chosen videos
-			if !on || strings.HasPrefix(np, "file:") {
-				// if no one on the priority list is streaming
-				// just play the first live channel found
-				// by randomizing the order of low priority channels registered
-				vid := selectRandomLiveStream(streamInfo)
-				if config.Config.RandomizeStreams && vid.VideoDetails.VideoID != "" {
-					playYoutubeVideo(conn, vid.VideoDetails.VideoID, vid)
-					continue F
-				}
+	stop := make(chan struct{})
+	go func() {
+		xCode = <-killswitch
+		log.Println("app killswitch")
+		close(stop)
+	}()
 
-				log.Println("no live streams, playing ambient music")
+	scheduler.New(opts).Run(stop)
 
-				// If no streams were found just play some BGM
-				if !on {
-					var err error
-					_, err = playAmbienceMV(conn, config.Config.MusicDir)
-					if err != nil {
-						log.Println(err.Error())
-					}
-				}
-			} else {
-				log.Println("nothing to play.")
-			}
-			break
-		case xCode = <-killswitch:
-			log.Println("app killswitch")
-			break F
-		}
+	// os.Exit skips deferred calls, recordings have to be finished so they aren't left as part files
+	if rec != nil {
+		rec.Close()
 	}
+	chat.Close()
 
 	os.Exit(xCode)
 }
 
-func quietTime(s, e string) bool {
-	now := time.Now()
-	// fmt.Println(now.Round(0))
-	yyyy, mm, dd := now.Date()
-	now = time.Date(yyyy, mm, dd, now.Hour(), now.Minute(), now.Second(), 0, time.UTC)
+// channelStatus checks every channel in the config for live streams
+type channelStatus struct{}
 
-	// fmt.Println(fmt.Sprintf("%d-%d-%dT%s:00", yyyy, mm, dd, s))
-	qs, err := time.ParseInLocation("2006-01-02T15:04:05", fmt.Sprintf("%d-%02d-%02dT%s:00", yyyy, mm, dd, s), time.UTC)
-	if err != nil {
-		fmt.Println(err.Error())
-	}
-	// qs = qs.Local()
-	qe, err := time.ParseInLocation("2006-01-02T15:04:05", fmt.Sprintf("%d-%02d-%02dT%s:00", yyyy, mm, dd, e), time.UTC)
-	if err != nil {
-		fmt.Println(err.Error())
-	}
-	// qe = qe.Local()
-	fmt.Println("checking quiet time", qs, "<", now, "<", qe)
-	if qs.Before(qe) {
-		return qs.Before(now) && qe.After(now)
-	}
+func (channelStatus) ChannelStatus() map[string]yt.VideoDetails {
+	yt.SetConsentCookie(config.Get().ConsentCookie)
+	streamInfo := yt.GetAllChannelStatus(config.Get().Channels)
+	reportHealth()
+	return streamInfo
+}
+
+// toastNotifier sends a windows notification for each live stream, once per video
+type toastNotifier struct{}
 
-	fmt.Println("checking quiet time", qe, "<", now, "<", qs)
-	return qe.Before(now) && qs.After(now)
+func (toastNotifier) Notify(channel string, v yt.VideoDetails) {
+	notify(v)
 }
 
 func notify(videoData yt.VideoDetails) {
@@ -336,33 +248,15 @@ func notify(videoData yt.VideoDetails) {
 		return
 	}
 
-	// config.ConfigPath = "E:/User/src/go/src/github.com/BlunterMonk/StreamNotify"
-	fn := fixPath(fmt.Sprintf("%v/thumb/%v.jpg", config.ConfigPath, videoID))
-	log.Println("thumbnail: ", fn)
-	if _, err := os.Stat(fn); errors.Is(err, os.ErrNotExist) {
-		// path/to/whatever does not exist
-		thmb := videoData.GetThumbnail()
-		log.Println("downloading thumbnail: ", thmb)
-
-		out, err := os.Create(fn)
-		if err != nil {
-			log.Println(err, "couldn't display notif")
-			return
-		}
-		defer out.Close()
-
-		resp, err := http.Get(thmb)
-		if err != nil {
-			log.Println(err, "couldn't display notif")
-			return
-		}
-		defer resp.Body.Close()
-
-		_, err = io.Copy(out, resp.Body)
+	// the notification is still sent without an icon if the thumbnail can't be loaded
+	var fn string
+	if thumbs != nil {
+		var err error
+		fn, err = thumbs.Get(videoID, thumbnailImages(videoData), thumbWidth, thumbHeight)
 		if err != nil {
-			log.Println(err, "couldn't display notif")
-			return
+			log.Println(err, "couldn't load thumbnail")
 		}
+		log.Println("thumbnail: ", fn)
 	}
 
 	url := fmt.Sprintf("https://www.youtube.com/watch?v=%v", videoID)
@@ -383,38 +277,42 @@ func notify(videoData yt.VideoDetails) {
 	history = append(history, videoID)
 }
 
-func selectRandomLiveStream(streamInfo map[string]yt.VideoDetails) yt.VideoDetails {
-
-	rand.Seed(time.Now().UnixNano())
+// notifyChat sends a notification for a chat message that matched the chat rules
+func notifyChat(a chatwatch.Alert) {
+	m := a.Message
+	log.Printf("chat alert (%v) %v - %v: %v\n", a.Reason, a.Stream.Channel, m.Author, m.Text)
 
-	count := len(streamInfo)
-	indices := make([]int, 0)
-	keys := make([]string, 0, len(streamInfo))
-	for k := range streamInfo {
-		keys = append(keys, k)
-		// fmt.Println(k)
+	text := m.Text
+	if m.Paid != "" {
+		text = fmt.Sprintf("[%v] %v", m.Paid, text)
 	}
 
-	// randomize indices
-	for len(indices) < count {
-		ind := rand.Intn(count)
-		if contains(indices, ind) {
-			continue
-		}
-		indices = append(indices, ind)
+	url := fmt.Sprintf("https://www.youtube.com/watch?v=%v", a.Stream.VideoID)
+	err := toast.Push(text,
+		toast.WithTitle(fmt.Sprintf("%v chat - %v", a.Stream.Channel, m.Author)),
+		toast.WithAppID("Streamer"),
+		toast.WithAudio(toast.Default),
+		toast.WithProtocolAction("Watch", url),
+		toast.WithProtocolAction("Dismiss", "dismiss"),
+	)
+	if err != nil {
+		log.Println(err)
 	}
+}
 
-	for i := 0; i < count; i++ {
-		v := streamInfo[keys[indices[i]]]
-		if !v.VideoDetails.IsLive {
-			continue
-		}
-
-		// fmt.Println("returning live video:", v)
-		return v
+func thumbnailImages(videoData yt.VideoDetails) []thumbcache.Image {
+	images := make([]thumbcache.Image, 0)
+	for _, v := range videoData.GetThumbnails() {
+		images = append(images, thumbcache.Image{URL: v.Url, Width: v.Width, Height: v.Height})
 	}
+	return images
+}
 
-	return yt.VideoDetails{}
+func thumbCacheBytes() int64 {
+	if config.Get().ThumbCacheSize <= 0 {
+		return defaultThumbCacheSize << 20
+	}
+	return int64(config.Get().ThumbCacheSize) << 20
 }
 
 /////////////////////////////////////////////////////////////
@@ -429,15 +327,6 @@ func strcontains(s []string, e string) bool {
 	return false
 }
 
-func contains(s []int, e int) bool {
-	for _, a := range s {
-		if a == e {
-			return true
-		}
-	}
-	return false
-}
-
 func fixPath(dir string) string {
 	return filepath.ToSlash(path.Clean(dir))
 }
@@ -504,26 +393,32 @@ func saveStatus(streamInfo map[string]yt.VideoDetails) error {
 	return nil
 }
 
-func videoIsPlaying(conn net.Conn) (bool, int) {
-	fmt.Println("Video is Playing")
-	status, err := getVlcStatus(conn)
-	if err != nil {
-		return false, 0
+// reportHealth logs any broken channels and saves the health of every channel
+// so it can be checked while the app is running
+func reportHealth() {
+	health := yt.Health()
+	for _, h := range health {
+		if h.Broken() {
+			log.Printf("channel unhealthy: %v (%v), failures: %v, last error: %v, next attempt: %v\n",
+				h.Channel, h.Handle, h.ConsecutiveFailures, h.LastError, h.NextAttempt.Format(time.Kitchen))
+		}
+	}
+	if until := yt.SlowdownUntil(); !until.IsZero() {
+		log.Println("youtube is throttling requests, slowing down until", until.Format(time.Kitchen))
 	}
-	fmt.Println("status:", status)
-	// TODO: determine if a video is already active
-	return status.State > 0, 0
-}
 
-func stopPlayback(conn net.Conn) {
-	fmt.Println("Stop Playback")
+	if err := saveHealth(health); err != nil {
+		log.Println("failed to save channel health:", err)
+	}
+}
 
-	// Stop the current video and start the new one
-	_, err := conn.Write([]byte("clear\n"))
+func saveHealth(health []yt.ChannelHealth) error {
+	body, err := json.MarshalIndent(health, "", "  ")
 	if err != nil {
-		log.Fatalf("Error clearing playlist: %v", err)
+		return err
 	}
 
+	return config.SaveFile(fmt.Sprintf("%v/.health.json", config.ConfigPath), body)
 }
 
 func getPlayingVideoTitle(id int) string {
@@ -531,16 +426,6 @@ func getPlayingVideoTitle(id int) string {
 	return ""
 }
 
-func playYoutubeVideo(conn net.Conn, videoID string, details yt.VideoDetails) {
-	fmt.Println("Play Youtube Video:", videoID)
-
-	// The YouTube URL you want to stream
-	youtubeURL := fmt.Sprintf("https://www.youtube.com/watch?v=%s", videoID) // Example YouTube URL
-	playVideoOnVlcHttp(conn, youtubeURL)
-
-	fmt.Println("VLC is streaming the video.")
-}
-
 func playVideoWithVlc(filepath string) error {
 
 	// VLC command with the YouTube URL
@@ -557,68 +442,84 @@ func playVideoWithVlc(filepath string) error {
 	return nil
 }
 
-func playAmbienceMV(conn net.Conn, dir string) (string, error) {
-
-	videoPath, err := loadRandomLocalVideo(dir)
-	if err != nil {
-		return "", err
+// newMultiviewPlayer opens a player window for one multiview tile, each with its own ipc socket or rc port
+func newMultiviewPlayer(i int, t multiview.Tile) (player.Player, func() error, error) {
+	switch config.Get().AutoPlayApp {
+	case "mpv":
+		socket := config.Get().MpvSocket
+		if socket == "" {
+			socket = mpv.DefaultSocket()
+		}
+		p, err := mpv.NewPlayer(config.Get().MpvPath, fmt.Sprintf("%v-%d", socket, i),
+			"--no-fullscreen", "--no-border", fmt.Sprintf("--geometry=%dx%d+%d+%d", t.Width, t.Height, t.X, t.Y))
+		if err != nil {
+			return nil, nil, err
+		}
+		return withResolver(p), p.Quit, nil
+	case "vlc", "":
+	default:
+		return nil, nil, fmt.Errorf("multiview needs vlc or mpv, not %v", config.Get().AutoPlayApp)
 	}
 
-	fmt.Println("Playing Ambience MV:", videoPath)
-	playVideoOnVlcHttp(conn, videoPath)
-	return videoPath, nil
-}
-
-func loadRandomLocalVideo(dir string) (string, error) {
-	var videoPath string
-
-	files, err := os.ReadDir(dir)
-	if err != nil {
-		return "", err
+	port := config.Get().Multiview.VlcPort
+	if port == 0 {
+		port = defaultMultiviewPort
 	}
+	addr := fmt.Sprintf("localhost:%d", port+i)
 
-	n := rand.Intn(len(files))
-	if n >= len(files) {
-		n = len(files) - 1
+	var cmd *exec.Cmd
+	start := func() error {
+		cmd = exec.Command("vlc", "-I", "rc", "--rc-host="+addr, "--no-one-instance", "--no-fullscreen",
+			"--no-embedded-video", "--no-video-deco",
+			fmt.Sprintf("--video-x=%d", t.X), fmt.Sprintf("--video-y=%d", t.Y),
+			fmt.Sprintf("--width=%d", t.Width), fmt.Sprintf("--height=%d", t.Height))
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		go cmd.Wait()
+		return nil
 	}
-
-	videoPath = strings.ReplaceAll(fmt.Sprintf("%s/%s", dir, files[n].Name()), "/", "\\")
-	fmt.Println("random video chosen:", n, videoPath)
-	return videoPath, nil
-}
-
-func startAndConnectVlcService() (net.Conn, error) {
-	var conn net.Conn
-	var err error
-
-	conn, err = net.Dial("tcp", "localhost:4212")
-	if err != nil {
-		fmt.Println("vlc not running, trying to connect")
-
-		for i := 0; i < 5; i++ {
-			err = startVlcService()
-			if err != nil {
-				fmt.Println(err.Error())
-				continue
-			}
-			time.Sleep(time.Second)
-			conn, err = net.Dial("tcp", "localhost:4212")
-			if err != nil {
-				log.Println("failed to start vlc service:", err.Error())
-				continue
-			}
-			return conn, nil
+	kill := func() error {
+		if cmd == nil || cmd.Process == nil {
+			return nil
 		}
-		fmt.Println("Error connecting to VLC:", err)
-		return nil, err
+		err := cmd.Process.Kill()
+		cmd = nil
+		if err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return err
+		}
+		return nil
+	}
+	dial := func() (vlc.Backend, error) {
+		return vlc.Dial(addr, vlc.DefaultTimeout)
 	}
 
-	return conn, nil
+	sup := vlc.NewSupervisor(dial, start, kill)
+	if err := sup.Connect(); err != nil {
+		return nil, nil, err
+	}
+
+	return withResolver(vlc.NewPlayer(sup)), func() error {
+		sup.Close()
+		return kill()
+	}, nil
 }
 
 func startVlcService() error {
 	// VLC command with the YouTube URL
-	cmd := exec.Command("vlc", "-I", "rc", "--rc-host=localhost:4212", "--one-instance", "--fullscreen")
+	cmd := exec.Command("vlc", "-I", "rc", "--rc-host="+vlcAddr(), "--one-instance", "--fullscreen")
+	if config.Get().VlcInterface == "http" {
+		password, err := vlcPassword()
+		if err != nil {
+			return err
+		}
+		host, port, err := net.SplitHostPort(vlcAddr())
+		if err != nil {
+			return err
+		}
+		cmd = exec.Command("vlc", "--extraintf", "http", "--http-host", host, "--http-port", port,
+			"--http-password", password, "--one-instance", "--fullscreen")
+	}
 
 	// Run the command
 	err := cmd.Start()
@@ -627,120 +528,168 @@ func startVlcService() error {
 		return err
 	}
 
+	// reap the process when it exits so it can be restarted
+	vlcCmd = cmd
+	go cmd.Wait()
+
 	return nil
 }
 
-// Define a struct to represent the VLC playback status
-type VLCStatus struct {
-	State        int     `json:"state"`
-	CurrentVideo string  `json:"current_video"`
-	Time         float64 `json:"time"`
-	Length       float64 `json:"length"`
-	VideoId      string  `json:"video_id"`
-}
+// newPlayer creates the playback backend for the autoplay app
+func newPlayer(app string) (player.Player, error) {
+	switch app {
+	case "vlc":
+	case "mpv":
+		log.Println("starting mpv...")
+		cfg := config.Get()
+		p, err := mpv.NewPlayer(cfg.MpvPath, cfg.MpvSocket)
+		if err != nil {
+			return nil, err
+		}
+		return withResolver(p), nil
+	case "kodi":
+		log.Println("connecting to kodi at", config.Get().Host)
+		return newKodiClient(), nil
+	case "web":
+		cfg := config.Get()
+		return browser.NewPlayer(browser.Options{
+			Command:      cfg.BrowserCommand,
+			Args:         cfg.BrowserArgs,
+			Mode:         cfg.BrowserMode,
+			DevToolsPort: cfg.BrowserDevTools,
+			ProfileDir:   fmt.Sprintf("%v/browser", config.ConfigPath),
+		}), nil
+	default:
+		log.Printf("autoplay app %q is not supported, using vlc\n", app)
+	}
 
-func getVlcStatus(conn net.Conn) (VLCStatus, error) {
-	// VLC command with the YouTube URL
-	// cmd := exec.Command("vlc", "-I", "rc", "--rc-host=localhost:4212", "--one-instance", filepath)
+	log.Println("starting vlc service...")
 
-	// Run the command
-	// err := cmd.Start()
-	// if err != nil {
-	// 	fmt.Println("Error starting VLC:", err)
-	// 	return err
-	// }
-	// Initialize the struct
-	var vlcStatus VLCStatus
-
-	// Connect to VLC's RC interface
-	// conn, err := net.Dial("tcp", "localhost:4212")
-	// if err != nil {
-	// 	fmt.Println("Error connecting to VLC:", err)
-	// 	return vlcStatus, err
-	// }
-	// defer conn.Close()
-
-	// // Set a timeout for the connection (optional)
-	// conn.SetDeadline(time.Now().Add(5 * time.Second))
-
-	fmt.Println("current status:")
-	fmt.Println(vlcStatus)
-	fmt.Println("===============")
-
-	return vlcStatus, nil
+	// the supervisor restarts vlc if it disconnects or gets stuck
+	sup := vlc.NewSupervisor(dialVlcService, startVlcService, killVlcService)
+	if err := sup.Connect(); err != nil {
+		return nil, err
+	}
+
+	return withResolver(vlc.NewPlayer(sup)), nil
 }
 
-// Parse state (e.g., "state: playing")
-var parseStateRegexp = regexp.MustCompile("play state: ([0-9])")
+// withResolver makes the player open youtube videos through yt-dlp or streamlink if one is configured
+func withResolver(p player.Player) player.Player {
+	r := streamResolver()
+	if r == nil {
+		return p
+	}
+	return resolve.NewPlayer(p, r, config.Get().Resolver.Quality)
+}
 
-func parseState(line string) int {
-	matches := parseStateRegexp.FindStringSubmatch(line)
-	if len(matches) < 2 {
-		fmt.Println("parse state regex failed")
-		return 0
+// streamResolver returns the configured yt-dlp or streamlink resolver, nil if there isn't one
+func streamResolver() *resolve.Resolver {
+	rc := config.Get().Resolver
+	if rc.Tool == "" {
+		return nil
 	}
-	n, err := strconv.ParseInt(matches[1], 10, 64)
-	if err != nil {
-		fmt.Println("parse state as int failed:", err.Error())
-		return 0
+
+	if resolver == nil {
+		r, err := resolve.New(rc.Tool, rc.Path)
+		if err != nil {
+			log.Println("not resolving stream urls:", err)
+			return nil
+		}
+		resolver = r
 	}
-	return int(n)
+	return resolver
 }
 
-// Parse current video file (e.g., "input: file:///C:/path/to/video.mp4")
-var parseInputRegexp = regexp.MustCompile("new input: (.*)\\s")
-var parseVideoIdRegexp = regexp.MustCompile("/id/(.*)/source")
+// newRecorder sets up recording of live streams, nil if it's turned off
+func newRecorder() *recorder.Recorder {
+	rc := config.Get().Recorder
+	if rc.Tool == "" {
+		return nil
+	}
+
+	dir := rc.Dir
+	if dir == "" {
+		dir = fmt.Sprintf("%v/recordings", config.ConfigPath)
+	}
 
-func parseInput(line string) string {
-	matches := parseInputRegexp.FindStringSubmatch(line)
-	if len(matches) < 2 {
-		fmt.Println("parse state regex failed")
-		return ""
+	opts := recorder.Options{
+		Tool:     rc.Tool,
+		Bin:      rc.Path,
+		Dir:      dir,
+		Template: rc.Template,
+		Quality:  rc.Quality,
+		MaxBytes: int64(rc.MaxSize) * 1024 * 1024 * 1024,
+	}
+	if r := streamResolver(); r != nil {
+		opts.Resolve = func(videoID string) (string, error) {
+			res, err := r.Resolve(videoID, []string{"best"})
+			return res.URL, err
+		}
 	}
-	return matches[1]
+
+	rec, err := recorder.New(opts)
+	if err != nil {
+		log.Println("not recording live streams:", err)
+		return nil
+	}
+	return rec
 }
 
-func parseVideoId(line string) string {
-	matches := parseVideoIdRegexp.FindStringSubmatch(line)
-	// fmt.Println(matches)
-	if len(matches) < 2 {
-		fmt.Println("parse video id regex failed")
-		return ""
+// dialVlcService connects to vlc through the interface chosen in the config
+func dialVlcService() (vlc.Backend, error) {
+	if config.Get().VlcInterface == "http" {
+		password, err := vlcPassword()
+		if err != nil {
+			return nil, err
+		}
+		return vlc.DialHTTP(vlcAddr(), password, vlc.DefaultTimeout)
 	}
-	return matches[1]
+
+	return vlc.Dial(vlcAddr(), vlc.DefaultTimeout)
 }
 
-// Parse time (e.g., "time: 120.8")
-func parseFloat(line string) float64 {
-	parts := strings.Split(line, ": ")
-	if len(parts) > 1 {
-		var time float64
-		fmt.Sscanf(parts[1], "%f", &time)
-		return time
+// vlcPassword returns the password for the vlc http interface, anyone on the machine could control vlc with a default one
+func vlcPassword() (string, error) {
+	if p := config.Get().VlcPassword; p != "" {
+		return p, nil
 	}
-	return 0
+	return "", errors.New("vlc http interface needs a password, set vlcPassword in the config")
 }
 
-func playVideoOnVlcHttp(conn net.Conn, videoPath string) {
-	// Connect to VLC's RC interface at port 4212
-	// conn, err := net.Dial("tcp", "localhost:4212")
-	// if err != nil {
-	// 	log.Fatalf("Error connecting to VLC RC interface: %v", err)
-	// }
-	// defer conn.Close()
+func vlcAddr() string {
+	cfg := config.Get()
+	if cfg.VlcAddr != "" {
+		return cfg.VlcAddr
+	}
+	if cfg.VlcInterface == "http" {
+		return vlc.DefaultHTTPAddr
+	}
+	return vlc.DefaultAddr
+}
 
-	// Stop the current video and start the new one
-	_, err := conn.Write([]byte("clear\n"))
-	if err != nil {
-		log.Fatalf("Error clearing playlist: %v", err)
+// killVlcService stops the vlc process started by this app, if there is one
+func killVlcService() error {
+	if vlcCmd == nil || vlcCmd.Process == nil {
+		return nil
 	}
 
-	// Send the 'add' command to start the video playback
-	_, err = conn.Write([]byte(fmt.Sprintf("add %s\n", videoPath)))
-	if err != nil {
-		log.Fatalf("Error sending command: %v", err)
+	err := vlcCmd.Process.Kill()
+	vlcCmd = nil
+	if err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
 	}
+	return nil
+}
+
+// newKodiClient connects to kodi with the media index the ambience picker uses
+func newKodiClient() *kodi.Client {
+	cfg := config.Get()
+	c := kodi.NewClient(cfg.Host, cfg.Port, cfg.KodiUsername, cfg.KodiPassword, kodi.DefaultTimeout)
+	c.UseIndex(kodi.NewIndex(c, kodiIndexFile(), time.Duration(cfg.KodiIndexTTL)*time.Minute))
+	return c
+}
 
-	// Optionally, wait and monitor playback status or send further commands
-	fmt.Println("Playback command sent to VLC. The video should start playing.")
+func kodiIndexFile() string {
+	return fmt.Sprintf("%v/kodi/index.json", config.ConfigPath)
 }
@@ -0,0 +1,234 @@
+package browser
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BlunterMonk/StreamNotify/pkg/player"
+)
+
+const (
+	ModeKiosk = "kiosk"
+	ModeApp   = "app"
+
+	// how long to wait for a launched browser to open its devtools port
+	launchTimeout = 10 * time.Second
+
+	// without devtools there's no telling when a video ends, a url is assumed to play for about as long as a stream
+	assumePlaying = 3 * time.Hour
+)
+
+var _ player.Player = (*Player)(nil)
+
+type Options struct {
+	Command      string   // browser executable, empty opens the system default browser
+	Args         []string // extra arguments passed to the browser
+	Mode         string   // "kiosk" or "app" to open without browser chrome, chromium based browsers only
+	DevToolsPort int      // if set, chromium is driven over the devtools protocol and a single tab is reused
+	ProfileDir   string   // browser profile used when launching with devtools
+}
+
+// Player opens videos in a web browser
+type Player struct {
+	opts     Options
+	devtools *DevTools
+
+	mu     sync.Mutex
+	last   string
+	opened time.Time // when last was opened
+	warned bool      // the user was told the tab can't be closed
+	cmd    *exec.Cmd
+}
+
+func NewPlayer(opts Options) *Player {
+	p := &Player{opts: opts}
+	if opts.DevToolsPort > 0 {
+		p.devtools = NewDevTools(fmt.Sprintf("localhost:%d", opts.DevToolsPort))
+	}
+	return p
+}
+
+// start runs the command without waiting for it to finish, it's reaped in the background
+// so it doesn't linger as a zombie once it exits
+func start(cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+func (p *Player) PlayURL(url string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.devtools != nil {
+		if err := p.launch(); err != nil {
+			return err
+		}
+		return p.devtools.Navigate(url)
+	}
+
+	if p.opts.Command == "" {
+		if err := openDefault(url); err != nil {
+			return err
+		}
+	} else {
+		if err := start(exec.Command(p.opts.Command, p.args(url)...)); err != nil {
+			return fmt.Errorf("failed to open browser: %v", err)
+		}
+	}
+
+	p.last = url
+	p.opened = time.Now()
+	return nil
+}
+
+func (p *Player) PlayFile(path string) error {
+	return p.PlayURL(fileURL(path))
+}
+
+// Stop navigates the tab to a blank page. A browser we only opened a url in can't be stopped,
+// the url is forgotten so it isn't reported as playing anymore.
+func (p *Player) Stop() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.devtools == nil {
+		if p.last != "" && !p.warned {
+			log.Println("the browser tab can't be closed without devtools, set a devtools port in the config")
+			p.warned = true
+		}
+		p.last = ""
+		return nil
+	}
+	if !p.devtools.Available() {
+		return nil
+	}
+	return p.devtools.Navigate("about:blank")
+}
+
+// Status reads the video element in the tab. Without devtools the last opened url is assumed to be playing
+// until it's stopped or it's been open for as long as a stream usually runs.
+func (p *Player) Status() (player.Status, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.devtools == nil {
+		if p.last == "" || time.Since(p.opened) > assumePlaying {
+			return player.Status{State: player.StateStopped}, nil
+		}
+		return player.Status{
+			State:   player.StatePlaying,
+			Input:   p.last,
+			VideoID: player.VideoID(p.last),
+			Time:    time.Since(p.opened).Seconds(),
+		}, nil
+	}
+
+	if !p.devtools.Available() {
+		return player.Status{State: player.StateStopped}, nil
+	}
+
+	page, err := p.devtools.State()
+	if err != nil {
+		return player.Status{}, err
+	}
+
+	s := player.Status{
+		Input:   page.URL,
+		VideoID: player.VideoID(page.URL),
+		Time:    page.Time,
+		Length:  page.Duration,
+	}
+	switch {
+	case !page.HasVideo || page.Ended || page.URL == "about:blank":
+		s = player.Status{State: player.StateStopped}
+	case page.Paused:
+		s.State = player.StatePaused
+	default:
+		s.State = player.StatePlaying
+	}
+
+	return s, nil
+}
+
+func (p *Player) NowPlaying() string {
+	s, err := p.Status()
+	if err != nil || !s.State.Active() {
+		return ""
+	}
+	return s.Input
+}
+
+// launch starts the browser with devtools enabled if it isn't already listening, must be called with the lock held
+func (p *Player) launch() error {
+	if p.devtools.Available() {
+		return nil
+	}
+	if p.opts.Command == "" {
+		return errors.New("devtools needs a browser command to launch, set browserCommand in the config")
+	}
+
+	args := append([]string{}, p.opts.Args...)
+	args = append(args, fmt.Sprintf("--remote-debugging-port=%d", p.opts.DevToolsPort))
+	if p.opts.ProfileDir != "" {
+		args = append(args, "--user-data-dir="+p.opts.ProfileDir)
+	}
+	switch p.opts.Mode {
+	case ModeKiosk:
+		args = append(args, "--kiosk", "about:blank")
+	case ModeApp:
+		args = append(args, "--app=about:blank")
+	default:
+		args = append(args, "about:blank")
+	}
+
+	log.Println("launching browser with devtools:", p.opts.Command)
+	p.cmd = exec.Command(p.opts.Command, args...)
+	if err := p.cmd.Start(); err != nil {
+		return fmt.Errorf("failed to launch browser: %v", err)
+	}
+	go p.cmd.Wait()
+
+	for deadline := time.Now().Add(launchTimeout); time.Now().Before(deadline); {
+		time.Sleep(500 * time.Millisecond)
+		if p.devtools.Available() {
+			// the browser is ours, its first tab is used rather than opening another
+			if err := p.devtools.Adopt(); err != nil {
+				log.Println("failed to use the browser's first tab:", err)
+			}
+			return nil
+		}
+	}
+	return errors.New("browser did not open its devtools port")
+}
+
+// args returns the browser arguments for opening a url without devtools
+func (p *Player) args(url string) []string {
+	args := append([]string{}, p.opts.Args...)
+
+	switch p.opts.Mode {
+	case ModeKiosk:
+		args = append(args, "--kiosk", url)
+	case ModeApp:
+		args = append(args, "--app="+url)
+	default:
+		args = append(args, url)
+	}
+	return args
+}
+
+func fileURL(path string) string {
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return "file://" + path
+}
@@ -0,0 +1,295 @@
+package browser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/BlunterMonk/StreamNotify/pkg/ws"
+)
+
+const devtoolsTimeout = 5 * time.Second
+
+// reads the state of the first video element on the page
+const pageStateScript = `JSON.stringify((() => {
+	const v = document.querySelector("video");
+	return {
+		url: location.href,
+		hasVideo: !!v,
+		paused: v ? v.paused : true,
+		ended: v ? v.ended : false,
+		time: v ? v.currentTime : 0,
+		duration: v && isFinite(v.duration) ? v.duration : 0,
+	};
+})())`
+
+// PageState is the state of the video in the controlled tab
+type PageState struct {
+	URL      string  `json:"url"`
+	HasVideo bool    `json:"hasVideo"`
+	Paused   bool    `json:"paused"`
+	Ended    bool    `json:"ended"`
+	Time     float64 `json:"time"`
+	Duration float64 `json:"duration"`
+}
+
+type target struct {
+	ID                   string `json:"id"`
+	Type                 string `json:"type"`
+	URL                  string `json:"url"`
+	WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
+}
+
+type devtoolsRequest struct {
+	ID     int         `json:"id"`
+	Method string      `json:"method"`
+	Params interface{} `json:"params,omitempty"`
+}
+
+type devtoolsResponse struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// DevTools drives a chromium tab over the devtools protocol, the same tab is reused for every video.
+// Only tabs this process opened are used, the user's own tabs are left alone.
+type DevTools struct {
+	addr   string
+	client *http.Client
+
+	mu       sync.Mutex
+	targetID string
+	conn     *ws.Conn // connection to the tab, kept open between calls
+	nextID   int
+}
+
+func NewDevTools(addr string) *DevTools {
+	return &DevTools{
+		addr:   addr,
+		client: &http.Client{Timeout: devtoolsTimeout},
+	}
+}
+
+// Available returns true if a browser is listening on the devtools port
+func (d *DevTools) Available() bool {
+	resp, err := d.client.Get(fmt.Sprintf("http://%v/json/version", d.addr))
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// Navigate loads the url in the controlled tab
+func (d *DevTools) Navigate(u string) error {
+	_, err := d.call("Page.navigate", map[string]string{"url": u})
+	return err
+}
+
+// State returns the state of the video in the controlled tab
+func (d *DevTools) State() (PageState, error) {
+	res, err := d.call("Runtime.evaluate", map[string]interface{}{
+		"expression":    pageStateScript,
+		"returnByValue": true,
+	})
+	if err != nil {
+		return PageState{}, err
+	}
+
+	var out struct {
+		Result struct {
+			Value string `json:"value"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(res, &out); err != nil {
+		return PageState{}, err
+	}
+
+	var s PageState
+	if err := json.Unmarshal([]byte(out.Result.Value), &s); err != nil {
+		return PageState{}, fmt.Errorf("failed to decode page state: %v", err)
+	}
+	return s, nil
+}
+
+// Adopt takes over the first tab of a browser this process just launched, so it isn't left blank next to a new one
+func (d *DevTools) Adopt() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pages, err := d.pages()
+	if err != nil {
+		return err
+	}
+	if len(pages) == 0 {
+		return errors.New("browser has no tabs")
+	}
+
+	d.disconnect()
+	d.targetID = pages[0].ID
+	return nil
+}
+
+// Close closes the connection to the tab, the tab itself stays open
+func (d *DevTools) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.disconnect()
+	return nil
+}
+
+// call sends one command to the tab and waits for its response, a failed connection is redialed on the next call
+func (d *DevTools) call(method string, params interface{}) (json.RawMessage, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	conn, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := d.roundTrip(conn, method, params)
+	if err != nil {
+		var rpc *rpcError
+		if !errors.As(err, &rpc) {
+			d.disconnect()
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// rpcError is an error returned by the browser, the connection is still fine after one
+type rpcError struct {
+	method  string
+	message string
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("devtools %v failed: %v", e.method, e.message)
+}
+
+func (d *DevTools) roundTrip(conn *ws.Conn, method string, params interface{}) (json.RawMessage, error) {
+	d.nextID++
+	id := d.nextID
+	body, err := json.Marshal(devtoolsRequest{ID: id, Method: method, Params: params})
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.WriteMessage(body); err != nil {
+		return nil, err
+	}
+
+	// events for the tab arrive on the same connection, skip them
+	conn.SetReadDeadline(time.Now().Add(devtoolsTimeout))
+	for {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+
+		var res devtoolsResponse
+		if err := json.Unmarshal(msg, &res); err != nil || res.ID != id {
+			continue
+		}
+		if res.Error != nil {
+			return nil, &rpcError{method: method, message: res.Error.Message}
+		}
+		return res.Result, nil
+	}
+}
+
+// connect returns the open connection to our tab, dialing it if there isn't one, must be called with the lock held
+func (d *DevTools) connect() (*ws.Conn, error) {
+	if d.conn != nil {
+		return d.conn, nil
+	}
+
+	t, err := d.target()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := ws.Dial(t.WebSocketDebuggerURL, nil, devtoolsTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to browser tab: %v", err)
+	}
+	d.conn = conn
+	return conn, nil
+}
+
+// disconnect must be called with the lock held
+func (d *DevTools) disconnect() {
+	if d.conn != nil {
+		d.conn.Close()
+		d.conn = nil
+	}
+}
+
+// target finds the tab we opened, or opens a new one if the user closed it
+func (d *DevTools) target() (target, error) {
+	pages, err := d.pages()
+	if err != nil {
+		return target{}, err
+	}
+
+	for _, t := range pages {
+		if t.ID == d.targetID {
+			return t, nil
+		}
+	}
+
+	var t target
+	if err := d.getJSON(http.MethodPut, "/json/new?"+url.QueryEscape("about:blank"), &t); err != nil {
+		return target{}, err
+	}
+	if t.WebSocketDebuggerURL == "" {
+		return target{}, errors.New("browser did not open a new tab")
+	}
+
+	d.targetID = t.ID
+	return t, nil
+}
+
+// pages returns the open tabs that can be driven
+func (d *DevTools) pages() ([]target, error) {
+	var list []target
+	if err := d.getJSON(http.MethodGet, "/json/list", &list); err != nil {
+		return nil, err
+	}
+
+	pages := make([]target, 0)
+	for _, t := range list {
+		if t.Type == "page" && t.WebSocketDebuggerURL != "" {
+			pages = append(pages, t)
+		}
+	}
+	return pages, nil
+}
+
+func (d *DevTools) getJSON(method, path string, out interface{}) error {
+	req, err := http.NewRequest(method, fmt.Sprintf("http://%v%v", d.addr, path), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("devtools request failed: %v: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("devtools request failed: %v: %v", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
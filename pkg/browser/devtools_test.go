@@ -0,0 +1,258 @@
+package browser
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBrowser serves the devtools endpoints with the user's own tab open,
+// every tab answers Runtime.evaluate with a paused video on its url
+type fakeBrowser struct {
+	srv *httptest.Server
+
+	mu      sync.Mutex
+	tabs    []target
+	urls    map[string]string
+	dials   map[string]int
+	created int
+}
+
+func newFakeBrowser(t *testing.T) *fakeBrowser {
+	b := &fakeBrowser{urls: make(map[string]string), dials: make(map[string]int)}
+	b.srv = httptest.NewServer(b)
+	t.Cleanup(b.srv.Close)
+
+	b.addTab("user", "https://example.com/inbox")
+	return b
+}
+
+func (b *fakeBrowser) addr() string {
+	return strings.TrimPrefix(b.srv.URL, "http://")
+}
+
+// addTab must be called with the lock held or before serving
+func (b *fakeBrowser) addTab(id, u string) target {
+	t := target{ID: id, Type: "page", URL: u, WebSocketDebuggerURL: fmt.Sprintf("ws://%v/devtools/page/%v", b.addr(), id)}
+	b.tabs = append(b.tabs, t)
+	b.urls[id] = u
+	return t
+}
+
+func (b *fakeBrowser) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	switch {
+	case r.URL.Path == "/json/version":
+		b.mu.Unlock()
+		w.Write([]byte(`{}`))
+	case r.URL.Path == "/json/list":
+		json.NewEncoder(w).Encode(b.tabs)
+		b.mu.Unlock()
+	case r.URL.Path == "/json/new" && r.Method == http.MethodPut:
+		b.created++
+		t := b.addTab(fmt.Sprint("new", b.created), "about:blank")
+		b.mu.Unlock()
+		json.NewEncoder(w).Encode(t)
+	case strings.HasPrefix(r.URL.Path, "/devtools/page/"):
+		id := strings.TrimPrefix(r.URL.Path, "/devtools/page/")
+		b.dials[id]++
+		b.mu.Unlock()
+		b.tab(w, r, id)
+	default:
+		b.mu.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// tab answers devtools calls over a websocket until the client goes away
+func (b *fakeBrowser) tab(w http.ResponseWriter, r *http.Request, id string) {
+	conn, rw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	h := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %v\r\n\r\n",
+		base64.StdEncoding.EncodeToString(h[:]))
+	rw.Flush()
+
+	for {
+		op, msg, err := readClientFrame(rw.Reader)
+		if err != nil || op == 0x8 {
+			return
+		}
+
+		var req struct {
+			ID     int               `json:"id"`
+			Method string            `json:"method"`
+			Params map[string]string `json:"params"`
+		}
+		json.Unmarshal(msg, &req)
+
+		// an event the client has to skip
+		writeServerFrame(conn, []byte(`{"method":"Page.frameNavigated","params":{}}`))
+
+		var result interface{} = map[string]interface{}{}
+		switch req.Method {
+		case "Page.navigate":
+			b.mu.Lock()
+			b.urls[id] = req.Params["url"]
+			b.mu.Unlock()
+		case "Runtime.evaluate":
+			b.mu.Lock()
+			state, _ := json.Marshal(PageState{URL: b.urls[id], HasVideo: true, Paused: true, Time: 12})
+			b.mu.Unlock()
+			result = map[string]interface{}{"result": map[string]string{"value": string(state)}}
+		}
+		res, _ := json.Marshal(map[string]interface{}{"id": req.ID, "result": result})
+		writeServerFrame(conn, res)
+	}
+}
+
+func readClientFrame(r *bufio.Reader) (byte, []byte, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return 0, nil, err
+	}
+	n := int(head[1] & 0x7F)
+	if n == 126 {
+		ext := make([]byte, 2)
+		io.ReadFull(r, ext)
+		n = int(binary.BigEndian.Uint16(ext))
+	}
+	mask := make([]byte, 4)
+	io.ReadFull(r, mask)
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return head[0] & 0x0F, payload, nil
+}
+
+func writeServerFrame(w io.Writer, payload []byte) {
+	head := []byte{0x81, byte(len(payload))}
+	if len(payload) >= 126 {
+		head = []byte{0x81, 126, byte(len(payload) >> 8), byte(len(payload))}
+	}
+	w.Write(append(head, payload...))
+}
+
+func TestDevToolsLeavesUserTabs(t *testing.T) {
+	b := newFakeBrowser(t)
+	d := NewDevTools(b.addr())
+	defer d.Close()
+
+	if err := d.Navigate("https://www.youtube.com/watch?v=abcdefghijk"); err != nil {
+		t.Fatal(err)
+	}
+	s, err := d.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.URL != "https://www.youtube.com/watch?v=abcdefghijk" || !s.Paused || s.Time != 12 {
+		t.Errorf("got %+v", s)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.urls["user"] != "https://example.com/inbox" || b.dials["user"] != 0 {
+		t.Errorf("the user's tab was used")
+	}
+	if b.created != 1 {
+		t.Errorf("opened %d tabs, want 1", b.created)
+	}
+	if b.dials["new1"] != 1 {
+		t.Errorf("dialed the tab %d times, want one connection for every call", b.dials["new1"])
+	}
+}
+
+func TestDevToolsReopensClosedTab(t *testing.T) {
+	b := newFakeBrowser(t)
+	d := NewDevTools(b.addr())
+	defer d.Close()
+
+	if err := d.Navigate("https://youtu.be/abcdefghijk"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the user closes our tab
+	b.mu.Lock()
+	b.tabs = b.tabs[:1]
+	b.mu.Unlock()
+	d.mu.Lock()
+	d.conn.Close()
+	d.mu.Unlock()
+
+	// the broken connection fails one call, the next opens a new tab
+	d.Navigate("https://youtu.be/abcdefghijk")
+	if err := d.Navigate("https://youtu.be/abcdefghijk"); err != nil {
+		t.Fatal(err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.created != 2 || b.urls["new2"] != "https://youtu.be/abcdefghijk" {
+		t.Errorf("created %d tabs, urls %v", b.created, b.urls)
+	}
+	if b.dials["user"] != 0 {
+		t.Error("the user's tab was used")
+	}
+}
+
+func TestDevToolsAdopt(t *testing.T) {
+	b := newFakeBrowser(t)
+	d := NewDevTools(b.addr())
+	defer d.Close()
+
+	if err := d.Adopt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Navigate("https://youtu.be/abcdefghijk"); err != nil {
+		t.Fatal(err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.created != 0 || b.urls["user"] != "https://youtu.be/abcdefghijk" {
+		t.Errorf("the launched browser's tab wasn't used, created %d", b.created)
+	}
+}
+
+func TestNoDevTools(t *testing.T) {
+	p := NewPlayer(Options{Command: "true"})
+	p.last = "https://youtu.be/abcdefghijk"
+	p.opened = time.Now().Add(-assumePlaying - time.Minute)
+
+	// open long past anything that could still be playing
+	if s, _ := p.Status(); s.State.Active() {
+		t.Errorf("got %v, want stopped", s.State)
+	}
+
+	p.opened = time.Now()
+	if s, _ := p.Status(); !s.State.Active() || s.VideoID != "abcdefghijk" {
+		t.Errorf("got %+v, want playing", s)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := p.Stop(); err != nil {
+			t.Errorf("stop: %v", err)
+		}
+	}
+	if s, _ := p.Status(); s.State.Active() {
+		t.Errorf("got %v after stop, want stopped", s.State)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !windows && !darwin
+
+package browser
+
+import "os/exec"
+
+// openDefault opens the url in the default browser
+func openDefault(url string) error {
+	return start(exec.Command("xdg-open", url))
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package browser
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// openDefault opens the url in the default browser, & has to be escaped for cmd
+func openDefault(url string) error {
+	return start(exec.Command("cmd", "/c", "start", "", strings.ReplaceAll(url, "&", "^&")))
+}
@@ -0,0 +1,217 @@
+package chatwatch
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BlunterMonk/StreamNotify/pkg/filter"
+	yt "github.com/BlunterMonk/StreamNotify/pkg/youtube"
+)
+
+const (
+	minRetry = 30 * time.Second
+	maxRetry = 10 * time.Minute
+
+	// message ids remembered so a message repeated by youtube isn't alerted twice
+	seenLimit = 2000
+)
+
+// Rules decide which chat messages raise an alert
+type Rules struct {
+	Keywords   []string // keywords or regular expressions matched against the message
+	Owner      bool     // messages from the streamer
+	Moderators bool     // messages from moderators
+	Users      []string // authors by name or channel id
+}
+
+// Empty reports if the rules can never match
+func (r Rules) Empty() bool {
+	return len(r.Keywords) == 0 && !r.Owner && !r.Moderators && len(r.Users) == 0
+}
+
+// Match returns why the message matches the rules, empty if it doesn't
+func (r Rules) Match(m yt.ChatMessage) string {
+	if r.Owner && m.Owner {
+		return "streamer"
+	}
+	if r.Moderators && m.Moderator {
+		return "moderator"
+	}
+	for _, u := range r.Users {
+		u = strings.TrimPrefix(strings.TrimSpace(u), "@")
+		if u != "" && (strings.EqualFold(strings.TrimPrefix(m.Author, "@"), u) || m.AuthorChannelID == u) {
+			return "user " + m.Author
+		}
+	}
+	if filter.Match(r.Keywords, m.Text) {
+		return "keyword"
+	}
+	return ""
+}
+
+// Stream is a live stream whose chat is watched
+type Stream struct {
+	Channel string
+	VideoID string
+}
+
+// Alert is a chat message that matched the rules
+type Alert struct {
+	Stream  Stream
+	Message yt.ChatMessage
+	Reason  string
+}
+
+// Watcher polls the live chats of a set of streams and calls alert for every matching message
+type Watcher struct {
+	rules func() Rules
+	alert func(Alert)
+
+	mu      sync.Mutex
+	watches map[string]chan struct{} // stop channels keyed by video id
+	ended   map[string]bool          // streams whose chat ended or is turned off, not opened again
+	wg      sync.WaitGroup
+}
+
+// New creates a watcher, rules is called on every poll so config changes apply right away
+func New(rules func() Rules, alert func(Alert)) *Watcher {
+	return &Watcher{
+		rules:   rules,
+		alert:   alert,
+		watches: make(map[string]chan struct{}, 0),
+		ended:   make(map[string]bool, 0),
+	}
+}
+
+// Update watches the chats of the streams and stops watching any stream not in the list
+func (w *Watcher) Update(streams []Stream) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	wanted := make(map[string]bool, len(streams))
+	for _, s := range streams {
+		wanted[s.VideoID] = true
+		if _, ok := w.watches[s.VideoID]; ok || w.ended[s.VideoID] {
+			continue
+		}
+
+		stop := make(chan struct{})
+		w.watches[s.VideoID] = stop
+
+		log.Println("watching live chat:", s.Channel, s.VideoID)
+		w.wg.Add(1)
+		go w.watch(s, stop)
+	}
+
+	for id, stop := range w.watches {
+		if !wanted[id] {
+			close(stop)
+			delete(w.watches, id)
+		}
+	}
+	for id := range w.ended {
+		if !wanted[id] {
+			delete(w.ended, id)
+		}
+	}
+}
+
+// Close stops watching every chat
+func (w *Watcher) Close() error {
+	w.Update(nil)
+	w.wg.Wait()
+	return nil
+}
+
+func (w *Watcher) watch(s Stream, stop chan struct{}) {
+	defer w.wg.Done()
+
+	// the first poll returns recent history, only messages from now on are alerted
+	since := time.Now()
+	seen := make(map[string]bool, 0)
+	retry := minRetry
+
+	var chat *yt.Chat
+	for {
+		var wait time.Duration
+
+		if chat == nil {
+			c, err := yt.OpenChat(s.VideoID)
+			if errors.Is(err, yt.ErrChatDisabled) || errors.Is(err, yt.ErrChatEnded) {
+				log.Printf("not watching live chat of %v: %v\n", s.Channel, err)
+				w.forget(s.VideoID, stop)
+				return
+			}
+			if err != nil {
+				log.Printf("failed to open live chat of %v, retrying in %v: %v\n", s.Channel, retry, err)
+				wait, retry = retry, backoff(retry)
+			} else {
+				chat = c
+			}
+		}
+
+		if chat != nil {
+			msgs, next, err := chat.Next()
+			switch {
+			case errors.Is(err, yt.ErrChatEnded):
+				log.Println("live chat ended:", s.Channel)
+				w.forget(s.VideoID, stop)
+				return
+			case err != nil:
+				log.Printf("failed to poll live chat of %v: %v\n", s.Channel, err)
+				wait, retry = retry, backoff(retry)
+			default:
+				retry = minRetry
+				wait = next
+				w.check(s, msgs, since, seen)
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (w *Watcher) check(s Stream, msgs []yt.ChatMessage, since time.Time, seen map[string]bool) {
+	rules := w.rules()
+	for _, m := range msgs {
+		if seen[m.ID] || (!m.Time.IsZero() && m.Time.Before(since)) {
+			continue
+		}
+		if len(seen) > seenLimit {
+			for k := range seen {
+				delete(seen, k)
+			}
+		}
+		seen[m.ID] = true
+
+		if reason := rules.Match(m); reason != "" {
+			w.alert(Alert{Stream: s, Message: m, Reason: reason})
+		}
+	}
+}
+
+// forget removes a watch that ended on its own so it isn't started again
+func (w *Watcher) forget(videoID string, stop chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.watches[videoID] == stop {
+		delete(w.watches, videoID)
+		w.ended[videoID] = true
+	}
+}
+
+func backoff(d time.Duration) time.Duration {
+	d *= 2
+	if d > maxRetry {
+		return maxRetry
+	}
+	return d
+}
@@ -9,11 +9,18 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 var (
-	Config        *config
-	ConfigPath    string
+	// ConfigPath is the directory holding the config and everything else saved to disk, it's set once on startup
+	ConfigPath string
+
+	// current is replaced as a whole on reload, the config it points to is never changed
+	mu      sync.RWMutex
+	current *config
+	noDir   bool // the config directory couldn't be found, only the defaults are used
+
 	defaultConfig = config{
 		LiveTimer:        1,
 		AmbienceTimer:    1,
@@ -23,8 +30,25 @@ var (
 		AutoPlay:         true,
 		RandomizeStreams: true,
 		AutoPlayApp:      "web",
+		VlcInterface:     "rc",
 		MusicDir:         "E:/User/Videos/bgm",
 		Priority:         "elira,doki,mint,eva",
+		Filters: FilterConfig{
+			Ignore: []string{"unarchived", "members? only", "membership"},
+		},
+		ChannelFilters: map[string]FilterConfig{},
+		ConsentCookie:  "SOCS=CAI",
+		ThumbCacheSize: 50,
+		ResumeAmbience: true,
+		Multiview: MultiviewConfig{
+			ScreenWidth:  1920,
+			ScreenHeight: 1080,
+		},
+		ResumeRewind: 5,
+		Volume: VolumeConfig{
+			Channels: map[string]int{},
+			Fade:     2,
+		},
 		Channels: map[string]string{
 			"eva":   "@EvaAnanova",
 			"doki":  "@dokibird",
@@ -41,6 +65,10 @@ var (
 type config struct {
 	Host             string            `json:"host"`             // kodi host IP
 	Port             string            `json:"port"`             // kodi host port
+	KodiUsername     string            `json:"kodiUsername"`     // kodi web server username, if it requires one
+	KodiPassword     string            `json:"kodiPassword"`     // kodi web server password, if it requires one
+	KodiNotifyPort   string            `json:"kodiNotifyPort"`   // kodi websocket port for player notifications, defaults to 9090
+	KodiIndexTTL     int               `json:"kodiIndexTTL"`     // time in minutes before the kodi media index is rescanned, defaults to a day
 	MusicDir         string            `json:"musicDir"`         // full path to folder containing music that should be randomized
 	StorageDir       string            `json:"storageDir"`       // full path to storage directory
 	AmbienceTimer    int               `json:"ambienceTimer"`    // time in minutes when kodi should attempt to play ambient music
@@ -50,15 +78,150 @@ type config struct {
 	QuietEndTime     string            `json:"quietEndTime"`     // [0-23] the hour when quiet time ends
 	RandomizeStreams bool              `json:"randomizeStreams"` // if true, a random registered streamer will play if no other priority streamer is playing
 	AutoPlay         bool              `json:"autoPlay"`         // automatically open videos
-	AutoPlayApp      string            `json:"autoPlayApp"`      // application to open videos in ("vlc", "web")
-	Priority         string            `json:"priority"`         // a priority queue for live channels stored as list separated by commas
+	AutoPlayApp      string            `json:"autoPlayApp"`      // application to open videos in ("vlc", "mpv", "kodi", "web")
+	VlcInterface     string            `json:"vlcInterface"`     // how to control vlc ("rc", "http")
+	VlcAddr          string            `json:"vlcAddr"`          // host:port of the vlc interface, defaults to localhost:4212 for rc and localhost:8080 for http
+	VlcPassword      string            `json:"vlcPassword"`      // password for the vlc http interface, required to use it, there's no default
+	MpvPath          string            `json:"mpvPath"`          // path to the mpv executable, defaults to mpv on the PATH
+	MpvSocket        string            `json:"mpvSocket"`        // path of the mpv ipc socket, defaults to a file in the temp directory, a named pipe (\\.\pipe\streamnotify-mpv) on windows
+	BrowserCommand   string            `json:"browserCommand"`   // browser executable for web autoplay, defaults to the system browser
+	BrowserArgs      []string          `json:"browserArgs"`      // extra arguments passed to the browser
+	BrowserMode      string            `json:"browserMode"`      // "kiosk" or "app" to open videos without browser chrome
+	BrowserDevTools  int               `json:"browserDevTools"`  // devtools port, if set a chromium browser is controlled directly and its tab reused
+	Priority         string            `json:"priority"`         // a priority queue for live channels stored as list separated by commas, used if priorityRules has no tiers
 	Channels         map[string]string `json:"channels"`         // list of channel IDs, play priority based on list order
+
+	Filters        FilterConfig            `json:"filters"`        // stream title filters applied to every channel
+	ChannelFilters map[string]FilterConfig `json:"channelFilters"` // stream title filters applied to a single channel, keyed by channel name
+	ConsentCookie  string                  `json:"consentCookie"`  // cookies sent to youtube to skip the EU consent page, "SOCS=CAI" if empty
+	ThumbCacheSize int                     `json:"thumbCacheSize"` // max size in MB of the thumbnail cache
+	RecordFixtures bool                    `json:"recordFixtures"` // save youtube responses to the fixtures folder, the last 100 of each channel are kept
+	ReplayFixtures bool                    `json:"replayFixtures"` // serve youtube responses from the fixtures folder instead of the network
+	Volume         VolumeConfig            `json:"volume"`         // player volume for live streams and ambience
+	ControlAddr    string                  `json:"controlAddr"`    // host:port the queue commands are served on, defaults to localhost:4290
+	Resolver       ResolverConfig          `json:"resolver"`       // resolve youtube videos to direct stream urls for vlc and mpv
+	Chat           ChatConfig              `json:"chat"`           // live chat alerts for the streams being watched
+	Recorder       RecorderConfig          `json:"recorder"`       // record live streams of some channels to disk
+	Multiview      MultiviewConfig         `json:"multiview"`      // several live streams at once in tiled windows
+	PriorityRules  PriorityConfig          `json:"priorityRules"`  // tiers of channels to autoplay, with overrides at certain times
+	Preempt        PreemptConfig           `json:"preempt"`        // when autoplay can replace what's playing
+	ResumeAmbience bool                    `json:"resumeAmbience"` // resume ambient music where it left off after a live stream ends
+	ResumeRewind   int                     `json:"resumeRewind"`   // time in seconds to rewind when resuming ambient music
+}
+
+// PriorityConfig decides which live stream is autoplayed, the first tier with a live stream wins
+type PriorityConfig struct {
+	Tiers     []TierConfig     `json:"tiers"`     // highest priority first, one tier per channel in priority if empty
+	Overrides []OverrideConfig `json:"overrides"` // changes to the tiers at certain times, the first one that applies to a channel wins
+	Never     []string         `json:"never"`     // channels that are never autoplayed, they still send notifications
+}
+
+// TierConfig is a group of channels with the same priority, one of the live ones is picked at random
+type TierConfig struct {
+	Name     string         `json:"name"`     // shown when explaining a choice, defaults to the tier number
+	Channels []string       `json:"channels"` // channel names
+	Weights  map[string]int `json:"weights"`  // chance of each channel being picked over the others in the tier, defaults to 1
+}
+
+// OverrideConfig moves channels to another tier, or stops them being autoplayed, during some hours or days
+type OverrideConfig struct {
+	Channels []string `json:"channels"` // channel names
+	Tier     string   `json:"tier"`     // name of the tier the channels move to, added after the others if it doesn't exist
+	Never    bool     `json:"never"`    // don't autoplay the channels while the override applies
+	Days     []string `json:"days"`     // "mon" to "sun", every day if empty. Times past midnight count as the next day
+	Start    string   `json:"start"`    // "15:04", all day if start and end are empty. overrides with a time that can't be read are ignored and logged
+	End      string   `json:"end"`      // "15:04", can be earlier than start to go past midnight
+}
+
+// PreemptConfig decides when autoplay can replace what's playing, videos started by hand are kept by default
+type PreemptConfig struct {
+	Manual      string `json:"manual"`      // what can replace a video started by hand: "never", "higher" for a stream in a higher tier, "idle" after idleMinutes, or "always"
+	IdleMinutes int    `json:"idleMinutes"` // minutes without the video being paused or changed before "idle" lets autoplay take over, defaults to 60, kodi's screensaver coming on counts as idle
+	Grace       int    `json:"grace"`       // seconds a switch has to stay wanted before it happens, 0 switches right away
+}
+
+// ResolverConfig sets up yt-dlp or streamlink to get direct stream urls instead of handing the player a watch page
+type ResolverConfig struct {
+	Tool     string              `json:"tool"`     // "yt-dlp" or "streamlink", resolving is off if empty
+	Path     string              `json:"path"`     // path to the tool, defaults to the tool on the PATH
+	Quality  []string            `json:"quality"`  // qualities tried in order, e.g. ["1080p", "720p", "best"]
+	Channels map[string][]string `json:"channels"` // qualities tried for a single channel's streams, keyed by channel name
+}
+
+// ChatConfig decides which live chat messages send a notification, chat isn't watched if nothing is set
+type ChatConfig struct {
+	Keywords    []string `json:"keywords"`    // keywords or regular expressions matched against messages, case insensitive
+	Owner       bool     `json:"owner"`       // notify for every message from the streamer
+	Moderators  bool     `json:"moderators"`  // notify for every message from a moderator
+	Users       []string `json:"users"`       // notify for every message from these authors, by name or channel id
+	AllPriority bool     `json:"allPriority"` // watch every live priority stream, not just the ones playing
+}
+
+// RecorderConfig sets up recording live streams whenever the channels go live
+type RecorderConfig struct {
+	Tool     string   `json:"tool"`     // "streamlink", "yt-dlp" or "ffmpeg", recording is off if empty. ffmpeg needs the resolver set up
+	Path     string   `json:"path"`     // path to the tool, defaults to the tool on the PATH
+	Dir      string   `json:"dir"`      // full path to the recordings folder, defaults to recordings in the config folder
+	Template string   `json:"template"` // file path under dir, with {channel}, {id}, {title}, {date} and {time} filled in
+	Quality  string   `json:"quality"`  // quality passed to streamlink or yt-dlp, defaults to best
+	Channels []string `json:"channels"` // channels recorded whenever they're live
+	MaxSize  int      `json:"maxSize"`  // max size in GB of the finished recordings, the oldest are deleted past it. other files in dir are never deleted
+}
+
+// MultiviewConfig sets up tiled player windows for when several priority streams are live, vlc or mpv only
+type MultiviewConfig struct {
+	Windows      int `json:"windows"`      // [2-4] most streams shown at once, multiview is off below 2
+	ScreenWidth  int `json:"screenWidth"`  // width in pixels of the screen the windows are tiled on
+	ScreenHeight int `json:"screenHeight"` // height in pixels of the screen the windows are tiled on
+	VlcPort      int `json:"vlcPort"`      // rc port of the first vlc window, the rest use the ports after it, defaults to 4213
+}
+
+// VolumeConfig holds volume profiles as percentages 1-100, a profile left at 0 keeps whatever the volume already is
+type VolumeConfig struct {
+	Live         int            `json:"live"`         // volume for live streams
+	Ambience     int            `json:"ambience"`     // volume for ambient music
+	Channels     map[string]int `json:"channels"`     // volume for a single channel's streams, keyed by channel name
+	Fade         int            `json:"fade"`         // time in seconds to fade out and back in when switching videos
+	EveningStart string         `json:"eveningStart"` // time the evening volume starts, "15:04"
+	EveningEnd   string         `json:"eveningEnd"`   // time the evening volume ends, "15:04"
+	Evening      int            `json:"evening"`      // max volume during the evening
+}
+
+// FilterConfig holds lists of keywords or regular expressions matched against stream titles, case insensitive.
+// Rules that aren't valid regular expressions are skipped
+type FilterConfig struct {
+	Ignore          []string `json:"ignore"`          // matching streams are treated as offline
+	NotifyInclude   []string `json:"notifyInclude"`   // if set, only matching streams send notifications
+	NotifyExclude   []string `json:"notifyExclude"`   // matching streams never send notifications
+	AutoPlayInclude []string `json:"autoPlayInclude"` // if set, only matching streams are played automatically
+	AutoPlayExclude []string `json:"autoPlayExclude"` // matching streams are never played automatically
 }
 
 func init() {
+	path, err := getConfigPath()
+	if err != nil {
+		path = "./"
+		noDir = true
+	}
+	ConfigPath = path
+
 	LoadConfig()
 }
 
+// Get returns the config, callers that read several fields should keep the result
+// so a reload in between can't mix two versions
+func Get() *config {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+func set(c *config) {
+	mu.Lock()
+	current = c
+	mu.Unlock()
+}
+
 func getConfigPath() (string, error) {
 
 	// UserConfigDir returns the default root directory to use for user-specific configuration data. Users should create their own application-specific subdirectory within this one and use that.
@@ -79,28 +242,25 @@ func getConfigPath() (string, error) {
 
 func LoadConfig() {
 
-	path, err := getConfigPath()
-	if err != nil {
-		Config = &defaultConfig
-		ConfigPath = "./"
+	if noDir {
+		set(&defaultConfig)
 		return
 	}
 
-	ConfigPath = path
-	cfg, err := loadConfigFile(path)
+	cfg, err := loadConfigFile(ConfigPath)
 	if err != nil {
 		fmt.Println(err.Error())
 		fmt.Println("loading default config")
 
-		Config = &defaultConfig
+		set(&defaultConfig)
 
-		j, err := json.Marshal(Config)
+		j, err := json.Marshal(&defaultConfig)
 		if err != nil {
 			fmt.Println("failed to save default config to file: ", err.Error())
 			return
 		}
 
-		err = SaveFile(configFilename(path), j)
+		err = SaveFile(configFilename(ConfigPath), j)
 		if err != nil {
 			fmt.Println("failed to save default config to file: ", err.Error())
 			return
@@ -108,7 +268,18 @@ func LoadConfig() {
 		return
 	}
 
-	Config = cfg
+	set(cfg)
+}
+
+// Use replaces the config with one decoded from body over the defaults, for tests that
+// can't rely on the config folder
+func Use(body []byte) error {
+	cfg, err := decodeConfig(body)
+	if err != nil {
+		return err
+	}
+	set(cfg)
+	return nil
 }
 
 func configFilename(configPath string) string {
@@ -128,14 +299,46 @@ func loadConfigFile(configPath string) (*config, error) {
 		return nil, err
 	}
 
-	// decode response
+	return decodeConfig(body)
+}
+
+// decodeConfig decodes a config on top of the defaults, so keys missing from
+// files saved by older versions keep their default values
+func decodeConfig(body []byte) (*config, error) {
+	// a copy, decoding reuses the slices it decodes into
 	var res config
-	rb := bytes.NewReader(body)
-	err = json.NewDecoder(rb).Decode(&res)
+	j, err := json.Marshal(&defaultConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(j, &res); err != nil {
+		return nil, err
+	}
+
+	// maps are merged when decoding, the file's maps replace the defaults instead
+	channels, channelFilters, volumes := res.Channels, res.ChannelFilters, res.Volume.Channels
+	res.Channels, res.ChannelFilters, res.Volume.Channels = nil, nil, nil
+
+	err = json.NewDecoder(bytes.NewReader(body)).Decode(&res)
 	if err != nil {
 		return nil, err
 	}
 
+	if res.Channels == nil {
+		res.Channels = channels
+	}
+	if res.ChannelFilters == nil {
+		res.ChannelFilters = channelFilters
+	}
+	if res.Volume.Channels == nil {
+		res.Volume.Channels = volumes
+	}
+
+	// without a consent cookie every request ends up on the consent page
+	if res.ConsentCookie == "" {
+		res.ConsentCookie = defaultConfig.ConsentCookie
+	}
+
 	return &res, nil
 }
 
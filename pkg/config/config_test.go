@@ -0,0 +1,86 @@
+package config
+
+import (
+	"os"
+	"sync"
+	"testing"
+)
+
+// run with -race, reloads swap the config while other goroutines read it
+func TestReloadConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				set(&config{LiveTimer: i*100 + j})
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_ = Get().LiveTimer
+			}
+		}()
+	}
+	wg.Wait()
+
+	if Get() == nil {
+		t.Error("no config after reloads")
+	}
+}
+
+func TestLoadKeepsDefaults(t *testing.T) {
+	dir := t.TempDir()
+	body := `{"host": "192.168.1.20", "consentCookie": "", "channels": {"nimi": "@NimiNightmare"}, "volume": {"ambience": 40}, "filters": {"ignore": ["karaoke"]}}`
+	if err := os.WriteFile(configFilename(dir), []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := loadConfigFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Host != "192.168.1.20" || c.Volume.Ambience != 40 {
+		t.Errorf("got host %v ambience %v, want the file's values", c.Host, c.Volume.Ambience)
+	}
+	if !c.ResumeAmbience || c.ResumeRewind != 5 || c.Volume.Fade != 2 || c.LiveTimer != 1 {
+		t.Errorf("got %+v, want the defaults for keys missing from the file", c)
+	}
+	if c.ConsentCookie != "SOCS=CAI" {
+		t.Errorf("got consent cookie %q, want the default in place of an empty one", c.ConsentCookie)
+	}
+	if len(c.Channels) != 1 || c.Channels["nimi"] != "@NimiNightmare" {
+		t.Errorf("got channels %v, want only the file's", c.Channels)
+	}
+	if len(c.Filters.Ignore) != 1 || c.Filters.Ignore[0] != "karaoke" {
+		t.Errorf("got ignore %q, want only the file's", c.Filters.Ignore)
+	}
+	if c.ChannelFilters == nil || c.Volume.Channels == nil {
+		t.Error("missing maps weren't defaulted")
+	}
+
+	if defaultConfig.Channels["nimi"] != "" || defaultConfig.Channels["doki"] == "" || defaultConfig.Filters.Ignore[0] != "unarchived" {
+		t.Errorf("loading changed the defaults: %v %q", defaultConfig.Channels, defaultConfig.Filters.Ignore)
+	}
+}
+
+func TestUse(t *testing.T) {
+	t.Cleanup(LoadConfig)
+
+	if err := Use([]byte(`{"liveTimer": 7}`)); err != nil {
+		t.Fatal(err)
+	}
+	if c := Get(); c.LiveTimer != 7 || c.QuietStartTime != "03:00" {
+		t.Errorf("got %+v, want the live timer over the defaults", c)
+	}
+
+	if err := Use([]byte(`{"liveTimer": "7"}`)); err == nil {
+		t.Error("used a config that doesn't decode")
+	}
+	if Get().LiveTimer != 7 {
+		t.Error("a config that doesn't decode replaced the last one")
+	}
+}
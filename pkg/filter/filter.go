@@ -0,0 +1,95 @@
+package filter
+
+import (
+	"log"
+	"regexp"
+	"sync"
+
+	"github.com/BlunterMonk/StreamNotify/pkg/config"
+)
+
+// Action is something the app can do with a live stream
+type Action int
+
+const (
+	Notify Action = iota
+	AutoPlay
+)
+
+var (
+	cache   = make(map[string]*regexp.Regexp, 0)
+	cacheMu sync.Mutex
+)
+
+// Ignored returns true if the stream title matches an ignore filter,
+// either globally or for the given channel
+func Ignored(channel, title string) bool {
+	cfg := config.Get()
+	return matchAny(cfg.Filters.Ignore, title) || matchAny(cfg.ChannelFilters[channel].Ignore, title)
+}
+
+// Allowed returns true if the stream should be used for the given action.
+// Ignored streams are never allowed. Include lists must match when they are set,
+// global and per channel filters both have to pass.
+func Allowed(channel, title string, action Action) bool {
+	if Ignored(channel, title) {
+		return false
+	}
+
+	cfg := config.Get()
+	for _, f := range []config.FilterConfig{cfg.Filters, cfg.ChannelFilters[channel]} {
+		include, exclude := lists(f, action)
+		if len(include) > 0 && !matchAny(include, title) {
+			return false
+		}
+		if matchAny(exclude, title) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func lists(f config.FilterConfig, action Action) ([]string, []string) {
+	switch action {
+	case Notify:
+		return f.NotifyInclude, f.NotifyExclude
+	case AutoPlay:
+		return f.AutoPlayInclude, f.AutoPlayExclude
+	}
+	return nil, nil
+}
+
+// Match returns true if the text matches any of the keywords or regular expressions, case insensitive
+func Match(patterns []string, text string) bool {
+	return matchAny(patterns, text)
+}
+
+func matchAny(patterns []string, title string) bool {
+	for _, p := range patterns {
+		if r := compile(p); r != nil && r.MatchString(title) {
+			return true
+		}
+	}
+	return false
+}
+
+// compile turns a filter into a case insensitive regex, nil if it isn't a valid regex.
+// Invalid rules are skipped rather than guessed at, so a typo can't start matching unintended titles
+func compile(pattern string) *regexp.Regexp {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	if r, ok := cache[pattern]; ok {
+		return r
+	}
+
+	r, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		log.Printf("invalid filter regex, skipping rule: %v - %v\n", pattern, err)
+		r = nil
+	}
+
+	cache[pattern] = r
+	return r
+}
@@ -0,0 +1,108 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/BlunterMonk/StreamNotify/pkg/config"
+)
+
+// rules are global filters for every channel plus channel filters for doki
+const rules = `{
+	"filters": {
+		"ignore": ["unarchived", "[bad"],
+		"notifyExclude": ["rerun"],
+		"autoPlayInclude": ["karaoke", "singing", "(broken"],
+		"autoPlayExclude": ["asmr"]
+	},
+	"channelFilters": {
+		"doki": {"ignore": ["minecraft"], "notifyInclude": ["karaoke"], "autoPlayExclude": ["horror"]}
+	}
+}`
+
+func useRules(t *testing.T) {
+	t.Helper()
+	t.Cleanup(config.LoadConfig)
+	if err := config.Use([]byte(rules)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		text     string
+		want     bool
+	}{
+		{[]string{"karaoke"}, "KARAOKE night", true},
+		{[]string{"members? only"}, "Member only stream", true},
+		{[]string{"^minecraft"}, "late night minecraft", false},
+		// an invalid regex is skipped instead of matched as a keyword
+		{[]string{"[unclosed"}, "an [unclosed bracket", false},
+		{[]string{"[unclosed", "bracket"}, "an [unclosed bracket", true},
+	}
+
+	for _, tt := range tests {
+		if got := Match(tt.patterns, tt.text); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.patterns, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestIgnored(t *testing.T) {
+	useRules(t)
+
+	tests := []struct {
+		channel, title string
+		want           bool
+	}{
+		{"mint", "UNARCHIVED karaoke", true},
+		{"mint", "minecraft together", false},
+		{"doki", "minecraft together", true},
+		// the invalid [bad rule is skipped
+		{"mint", "a [bad title", false},
+	}
+
+	for _, tt := range tests {
+		if got := Ignored(tt.channel, tt.title); got != tt.want {
+			t.Errorf("Ignored(%q, %q) = %v, want %v", tt.channel, tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	useRules(t)
+
+	tests := []struct {
+		channel, title string
+		action         Action
+		want           bool
+	}{
+		// ignored streams are never allowed
+		{"mint", "unarchived karaoke", Notify, false},
+		{"mint", "unarchived karaoke", AutoPlay, false},
+
+		// notify only has an exclude globally, autoplay needs an include to match
+		{"mint", "chatting", Notify, true},
+		{"mint", "chatting", AutoPlay, false},
+		{"mint", "karaoke rerun", Notify, false},
+		{"mint", "karaoke rerun", AutoPlay, true},
+		{"mint", "singing asmr", AutoPlay, false},
+		{"mint", "singing asmr", Notify, true},
+
+		// doki's rules apply on top of the global ones
+		{"doki", "chatting", Notify, false},
+		{"doki", "karaoke", Notify, true},
+		{"doki", "horror karaoke", AutoPlay, false},
+		{"doki", "horror karaoke", Notify, true},
+		{"doki", "karaoke rerun", Notify, false},
+
+		// the invalid (broken include is skipped, the valid ones still have to match
+		{"mint", "a (broken title", AutoPlay, false},
+	}
+
+	for _, tt := range tests {
+		if got := Allowed(tt.channel, tt.title, tt.action); got != tt.want {
+			t.Errorf("Allowed(%q, %q, %v) = %v, want %v", tt.channel, tt.title, tt.action, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package kodi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultIndexTTL = 24 * time.Hour
+
+var ErrNoMatches = errors.New("no files in the kodi index match")
+
+// IndexEntry is a single file in a kodi source
+type IndexEntry struct {
+	File   string `json:"file"`
+	Label  string `json:"label"`
+	Folder string `json:"folder"`
+	Ext    string `json:"ext"`
+}
+
+// Query filters index entries, empty fields match everything
+type Query struct {
+	Folder     string   // only files in this folder or below it
+	Extensions []string // only files with one of these extensions, e.g. ".mp4"
+	Label      string   // only files whose label contains this, case insensitive
+}
+
+type indexRoot struct {
+	Root      string       `json:"root"`
+	ScannedAt time.Time    `json:"scannedAt"`
+	Files     []IndexEntry `json:"files"`
+}
+
+// Index is a recursive listing of kodi directories, rescanned once it's older than the ttl.
+// The file is shared with the kodi-index command, a listing it saved is picked up on the next read.
+type Index struct {
+	client   *Client
+	filename string
+	ttl      time.Duration
+
+	// saveMu keeps saves from interleaving, it's taken before mu
+	saveMu sync.Mutex
+
+	mu      sync.Mutex
+	roots   map[string]*indexRoot
+	modTime time.Time // of the file when it was last loaded or saved
+	rand    *rand.Rand
+}
+
+// NewIndex creates an index saved to filename, entries saved by a previous run are loaded
+func NewIndex(client *Client, filename string, ttl time.Duration) *Index {
+	if ttl <= 0 {
+		ttl = DefaultIndexTTL
+	}
+
+	idx := &Index{
+		client:   client,
+		filename: filename,
+		ttl:      ttl,
+		roots:    make(map[string]*indexRoot, 0),
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	if err := idx.load(); err != nil {
+		log.Println("failed to load kodi index, it will be rebuilt:", err)
+	}
+
+	return idx
+}
+
+// Refresh rescans a root directory now, whatever its age
+func (i *Index) Refresh(root string) error {
+	files, err := i.scan(root)
+	if err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	i.roots[root] = &indexRoot{Root: root, ScannedAt: time.Now(), Files: files}
+	i.mu.Unlock()
+
+	return i.save()
+}
+
+// Files returns every file below root, scanning it first if it's missing or expired
+func (i *Index) Files(root string) ([]IndexEntry, error) {
+	if err := i.reload(); err != nil {
+		log.Println("failed to reload kodi index:", err)
+	}
+
+	i.mu.Lock()
+	r, ok := i.roots[root]
+	i.mu.Unlock()
+
+	if !ok || time.Since(r.ScannedAt) > i.ttl {
+		log.Println("scanning kodi directory:", root)
+		if err := i.Refresh(root); err != nil {
+			// an old listing is better than nothing if kodi is unreachable
+			if ok {
+				log.Println("failed to rescan kodi directory, using the old index:", err)
+				return r.Files, nil
+			}
+			return nil, err
+		}
+
+		i.mu.Lock()
+		r = i.roots[root]
+		i.mu.Unlock()
+	}
+
+	return r.Files, nil
+}
+
+// Query returns the files below root that match the query
+func (i *Index) Query(root string, q Query) ([]IndexEntry, error) {
+	files, err := i.Files(root)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]IndexEntry, 0)
+	for _, f := range files {
+		if q.matches(f) {
+			list = append(list, f)
+		}
+	}
+	return list, nil
+}
+
+// Random returns a random file below root that matches the query
+func (i *Index) Random(root string, q Query) (IndexEntry, error) {
+	list, err := i.Query(root, q)
+	if err != nil {
+		return IndexEntry{}, err
+	}
+	if len(list) == 0 {
+		return IndexEntry{}, fmt.Errorf("%w: %v", ErrNoMatches, root)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return list[i.rand.Intn(len(list))], nil
+}
+
+func (q Query) matches(f IndexEntry) bool {
+	if folder := strings.TrimSuffix(q.Folder, "/"); folder != "" && f.Folder != folder && !strings.HasPrefix(f.Folder, folder+"/") {
+		return false
+	}
+	if q.Label != "" && !strings.Contains(strings.ToLower(f.Label), strings.ToLower(q.Label)) {
+		return false
+	}
+	if len(q.Extensions) > 0 {
+		for _, ext := range q.Extensions {
+			if strings.EqualFold(f.Ext, ext) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func (i *Index) scan(dir string) ([]IndexEntry, error) {
+	res, err := i.client.GetDirectory(dir, "video")
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]IndexEntry, 0)
+	for _, v := range res {
+		switch v.Filetype {
+		case "file":
+			list = append(list, IndexEntry{
+				File:   v.Filename,
+				Label:  v.Label,
+				Folder: strings.TrimSuffix(dir, "/"),
+				Ext:    strings.ToLower(path.Ext(v.Filename)),
+			})
+		case "directory":
+			sub, err := i.scan(v.Filename)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, sub...)
+		}
+	}
+
+	return list, nil
+}
+
+// reload loads the file again if something else saved it since
+func (i *Index) reload() error {
+	st, err := os.Stat(i.filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	changed := !st.ModTime().Equal(i.modTime)
+	i.mu.Unlock()
+	if !changed {
+		return nil
+	}
+	return i.load()
+}
+
+// load merges the saved roots into the index, a root scanned more recently in memory is kept
+func (i *Index) load() error {
+	st, err := os.Stat(i.filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	body, err := os.ReadFile(i.filename)
+	if err != nil {
+		return err
+	}
+
+	roots := make(map[string]*indexRoot, 0)
+	if err := json.Unmarshal(body, &roots); err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.merge(roots)
+	i.modTime = st.ModTime()
+	return nil
+}
+
+// merge must be called with the lock held
+func (i *Index) merge(roots map[string]*indexRoot) {
+	for k, r := range roots {
+		if cur, ok := i.roots[k]; !ok || r.ScannedAt.After(cur.ScannedAt) {
+			i.roots[k] = r
+		}
+	}
+}
+
+// save writes the index, keeping roots another process saved in the meantime
+func (i *Index) save() error {
+	i.saveMu.Lock()
+	defer i.saveMu.Unlock()
+
+	if err := i.load(); err != nil {
+		log.Println("failed to read the saved kodi index, overwriting it:", err)
+	}
+
+	i.mu.Lock()
+	body, err := json.Marshal(i.roots)
+	i.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(i.filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// write to a temp file first so a crash doesn't leave a broken index,
+	// each save gets its own so the command and the app can't write the same one
+	f, err := os.CreateTemp(dir, filepath.Base(i.filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(body); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), i.filename); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	if st, err := os.Stat(i.filename); err == nil {
+		i.mu.Lock()
+		i.modTime = st.ModTime()
+		i.mu.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package kodi
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueryFolder(t *testing.T) {
+	tests := []struct {
+		folder string
+		file   string
+		want   bool
+	}{
+		{"smb://nas/bgm", "smb://nas/bgm", true},
+		{"smb://nas/bgm/", "smb://nas/bgm", true},
+		{"smb://nas/bgm", "smb://nas/bgm/rain", true},
+		{"smb://nas/bgm", "smb://nas/bgm2", false},
+		{"smb://nas/bgm", "smb://nas/bgm-old/rain", false},
+		{"smb://nas/bgm/rain", "smb://nas/bgm", false},
+		{"", "smb://nas/anything", true},
+	}
+	for _, tt := range tests {
+		got := Query{Folder: tt.folder}.matches(IndexEntry{Folder: tt.file})
+		if got != tt.want {
+			t.Errorf("folder %v, file in %v: got %v, want %v", tt.folder, tt.file, got, tt.want)
+		}
+	}
+}
+
+func newTestIndex(filename string) *Index {
+	return NewIndex(nil, filename, time.Hour)
+}
+
+func setRoot(i *Index, root string, files ...string) {
+	entries := make([]IndexEntry, 0, len(files))
+	for _, f := range files {
+		entries = append(entries, IndexEntry{File: root + "/" + f, Label: f, Folder: root})
+	}
+	i.mu.Lock()
+	i.roots[root] = &indexRoot{Root: root, ScannedAt: time.Now(), Files: entries}
+	i.mu.Unlock()
+}
+
+// the kodi-index command and the running app save the same file
+func TestIndexSharedFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "kodi", "index.json")
+	app := newTestIndex(filename)
+	cmd := newTestIndex(filename)
+
+	setRoot(app, "smb://nas/bgm", "old.mp4")
+	if err := app.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the command rescans the folder and saves another root too
+	time.Sleep(10 * time.Millisecond)
+	setRoot(cmd, "smb://nas/bgm", "new.mp4")
+	setRoot(cmd, "smb://nas/videos", "clip.mp4")
+	if err := cmd.save(); err != nil {
+		t.Fatal(err)
+	}
+	// make sure the change is visible on filesystems with coarse timestamps
+	later := time.Now().Add(time.Second)
+	os.Chtimes(filename, later, later)
+
+	files, err := app.Files("smb://nas/bgm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Label != "new.mp4" {
+		t.Errorf("got %+v, want the command's rescan", files)
+	}
+
+	// saving from the app keeps the root only the command scanned
+	setRoot(app, "smb://nas/music", "song.mp4")
+	if err := app.save(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := newTestIndex(filename)
+	for _, root := range []string{"smb://nas/bgm", "smb://nas/videos", "smb://nas/music"} {
+		if _, ok := reloaded.roots[root]; !ok {
+			t.Errorf("%v missing from the saved index", root)
+		}
+	}
+}
+
+func TestIndexConcurrentSaves(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "index.json")
+	idx := newTestIndex(filename)
+
+	var wg sync.WaitGroup
+	for n := 0; n < 4; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				setRoot(idx, fmt.Sprintf("root%d", n), "file.mp4")
+				if err := idx.save(); err != nil {
+					t.Error(err)
+				}
+			}
+		}(n)
+	}
+	wg.Wait()
+
+	if left, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(left) > 0 {
+		t.Errorf("temp files left behind: %v", left)
+	}
+	if len(newTestIndex(filename).roots) != 4 {
+		t.Errorf("got %d roots, want 4", len(newTestIndex(filename).roots))
+	}
+}
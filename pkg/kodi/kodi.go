@@ -5,304 +5,385 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"math/rand"
 	"net/http"
-	"os"
-	"path"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/BlunterMonk/StreamNotify/pkg/config"
+	"github.com/BlunterMonk/StreamNotify/pkg/player"
 )
 
 const (
-	GET_FILES_REQUEST_BODY         = `{"jsonrpc":"2.0", "id":1, "method":"Files.GetDirectory", "params": { "directory": "%v", "media": "video" }}`
-	GET_PLAYLIST_REQUEST_BODY      = `{"jsonrpc":"2.0", "id":1, "method":"Playlist.GetItems", "params":{"playlistid":1}}`
-	GET_ACTIVE_PLAYER_REQUEST_BODY = `{"jsonrpc":"2.0", "id":1, "method":"Player.GetActivePlayers"}`
-	GET_ITEM_REQUEST_BODY          = `{"jsonrpc":"2.0", "id":1, "method":"Player.GetItem", "params":{"playerid":%v}}`
-	ADD_TO_QUEUE_REQUEST_BODY      = `{"jsonrpc":"2.0", "id":1, "method":"Playlist.Add", "params":{"playlistid":1, "item":{"file":"%v"}}}`
+	DefaultPort    = "8080"
+	DefaultTimeout = 5 * time.Second
 
-	SET_VOLUME_REQUEST_BODY = `{"jsonrpc":"2.0", "id":1, "method":"Application.SetVolume", "params":{"volume":%v}}`
+	YoutubeAddonID = "plugin.video.youtube"
 
-	PLAY_FILE_REQUEST_BODY  = `{"jsonrpc":"2.0", "method":"Player.Open", "id":1, "params":{"item":{"file":"%v"}}}`
-	STOP_VIDEO_REQUEST_BODY = `{"jsonrpc":"2.0", "method":"Player.Stop", "id":1, "params":{"playerid":1}}`
+	// kodi's playlist for videos
+	videoPlaylistID = 1
 )
 
-func Monitor() {
+var ErrYoutubeAddonMissing = errors.New("kodi youtube addon (plugin.video.youtube) is not installed or enabled")
 
-}
+var _ player.Player = (*Client)(nil)
+var _ player.VolumeController = (*Client)(nil)
+var _ player.Seeker = (*Client)(nil)
 
-/////////////// Cache
+// Client controls kodi over its JSON-RPC http interface
+type Client struct {
+	endpoint string
+	username string
+	password string
+	http     *http.Client
 
-func cacheAll(dir string) error {
-	list, err := getAllFiles(dir)
-	if err != nil {
-		return err
-	}
+	mu           sync.Mutex
+	nextID       int
+	youtubeAddon *bool // cached result of the addon check
+	index        *Index
+	rand         *rand.Rand
+}
 
-	f, err := os.OpenFile("./all.txt", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
-	if err != nil {
-		return err
+// NewClient creates a client for kodi at host:port, host may include the scheme.
+// Username and password are only needed if kodi's web server requires them.
+func NewClient(host, port, username, password string, timeout time.Duration) *Client {
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
 	}
-	defer f.Close()
-
-	for _, v := range list {
-		f.WriteString(v + "\n")
+	if port == "" {
+		port = DefaultPort
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
 	}
 
-	return nil
+	return &Client{
+		endpoint: fmt.Sprintf("%v:%v/jsonrpc", strings.TrimSuffix(host, "/"), port),
+		username: username,
+		password: password,
+		http:     &http.Client{Timeout: timeout},
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
 }
 
-func getAllFiles(path string) ([]string, error) {
-	list := make([]string, 0)
-	res, err := getFiles(path)
-	if err != nil {
-		return nil, err
-	}
-	for k, v := range res.Result.Files {
-		if v.Filetype == "file" {
-			fmt.Printf("%v - %v\n", k, v.Filename)
-			list = append(list, v.Filename)
-		} else if v.Filetype == "directory" {
-			subfiles, err := getAllFiles(v.Filename)
-			if err != nil {
-				return nil, err
-			}
-			list = append(list, subfiles...)
+/////////////// Player
+
+// PlayURL plays a url, youtube urls go through the youtube addon when it's installed
+func (c *Client) PlayURL(url string) error {
+	if id := player.VideoID(url); id != "" {
+		err := c.PlayYoutube(id)
+		if !errors.Is(err, ErrYoutubeAddonMissing) {
+			return err
 		}
+		log.Println(err, "trying to play the url directly")
 	}
 
-	return list, nil
+	return c.open(url)
 }
 
-func getFiles(path string) (FilesGetDirectoryOutput, error) {
+func (c *Client) PlayFile(path string) error {
+	return c.open(path)
+}
 
-	// load cached data if it exists
-	outFile := fmt.Sprintf("./data/%v.json", strings.TrimSuffix(strings.TrimPrefix(path, config.Config.StorageDir), "/"))
+// PlayYoutube plays a video through the youtube addon
+func (c *Client) PlayYoutube(videoID string) error {
+	ok, err := c.HasYoutubeAddon()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrYoutubeAddonMissing
+	}
 
-	f, err := os.OpenFile(outFile, os.O_RDONLY|os.O_EXCL, 0666)
-	if err == nil || errors.Is(err, os.ErrExist) {
-		fmt.Printf("Returning Cached: %v\n", outFile)
+	return c.open(`plugin://plugin.video.youtube/play/?video_id=` + videoID)
+}
 
-		body, err := ioutil.ReadAll(f)
-		if err != nil {
-			return FilesGetDirectoryOutput{}, err
-		}
+// Stop stops every active player
+func (c *Client) Stop() error {
+	players, err := c.ActivePlayers()
+	if err != nil {
+		return err
+	}
 
-		// decode response
-		var res FilesGetDirectoryOutput
-		rb := bytes.NewReader(body)
-		err = json.NewDecoder(rb).Decode(&res)
-		if err != nil {
-			return FilesGetDirectoryOutput{}, err
+	for _, p := range players {
+		if err := c.Call("Player.Stop", map[string]interface{}{"playerid": p.PlayerID}, nil); err != nil {
+			return err
 		}
-
-		return res, nil
 	}
+	return nil
+}
 
-	q := fmt.Sprintf(GET_FILES_REQUEST_BODY, path)
+// Status returns the status of the video player, other players count as stopped
+func (c *Client) Status() (player.Status, error) {
+	id, ok, err := c.videoPlayer()
+	if err != nil || !ok {
+		return player.Status{State: player.StateStopped}, err
+	}
 
-	resp, err := http.Post(requestEndpoint(), "application/json", bytes.NewBuffer([]byte(q)))
+	var props PlayerProperties
+	err = c.Call("Player.GetProperties", map[string]interface{}{
+		"playerid":   id,
+		"properties": []string{"speed", "time", "totaltime"},
+	}, &props)
 	if err != nil {
-		return FilesGetDirectoryOutput{}, err
+		return player.Status{}, err
 	}
 
-	fmt.Println(resp.StatusCode)
-
-	// read response body
-	body, err := ioutil.ReadAll(resp.Body)
+	item, err := c.GetItem(id)
 	if err != nil {
-		return FilesGetDirectoryOutput{}, err
+		return player.Status{}, err
 	}
 
-	// save response to file
-	mkdir(outFile)
-	saveOutput(outFile, body)
-
-	// decode response
-	var res FilesGetDirectoryOutput
-	rb := bytes.NewReader(body)
-	err = json.NewDecoder(rb).Decode(&res)
-	if err != nil {
-		return FilesGetDirectoryOutput{}, err
+	s := player.Status{
+		State:   player.StatePlaying,
+		Input:   item.File,
+		VideoID: player.VideoID(item.File),
+		Time:    props.Time.InSeconds(),
+		Length:  props.TotalTime.InSeconds(),
+	}
+	if props.Speed == 0 {
+		s.State = player.StatePaused
 	}
 
-	return res, nil
+	return s, nil
 }
 
-/////////////// Playback
-
-func playAmbienceMV() (string, error) {
-	log.Println("Attempting to play ambient music")
+// NowPlaying returns the file or url of the playing video, the same input Status reports
+func (c *Client) NowPlaying() string {
+	id, ok, err := c.videoPlayer()
+	if err != nil || !ok {
+		return ""
+	}
 
-	res, err := getFiles(config.Config.MusicDir)
+	item, err := c.GetItem(id)
 	if err != nil {
-		return "", err
+		log.Printf("failed to get the playing video: %v\n", err)
+		return ""
 	}
-	count := len(res.Result.Files)
-	rand.Seed(time.Now().UnixNano())
-	ind := rand.Intn(count)
-	fn := res.Result.Files[ind].Filename
-	playFile(fn)
+	return item.File
+}
 
-	if on, _ := videoIsPlaying(); on {
-		log.Println("now playing: " + fn)
-		request[KodiOutput](fmt.Sprintf(SET_VOLUME_REQUEST_BODY, 50))
+// Pause pauses or resumes the video player
+func (c *Client) Pause(pause bool) error {
+	id, ok, err := c.videoPlayer()
+	if err != nil || !ok {
+		return err
 	}
+	return c.Call("Player.PlayPause", map[string]interface{}{"playerid": id, "play": !pause}, nil)
+}
 
-	return fn, nil
+// Seek jumps to a position in seconds
+func (c *Client) Seek(seconds int) error {
+	id, ok, err := c.videoPlayer()
+	if err != nil || !ok {
+		return err
+	}
+
+	return c.Call("Player.Seek", map[string]interface{}{
+		"playerid": id,
+		"value":    map[string]interface{}{"time": timeFromSeconds(seconds)},
+	}, nil)
 }
 
-func playYoutubeVideo(videoID string) {
-	pluginUrl := `plugin://plugin.video.youtube/?action=play_video&videoid=` + videoID
-	request[KodiOutput](fmt.Sprintf(`{
-		"jsonrpc":"2.0",
-		"method":"Player.Open",
-		"id":1,
-		"params":{
-			"item":{
-				"file":"%v"
-			}
-		}
-	}`, pluginUrl))
+// SetVolume sets the application volume, 0-100
+func (c *Client) SetVolume(volume int) error {
+	return c.Call("Application.SetVolume", map[string]interface{}{"volume": volume}, nil)
 }
 
-func playFile(path string) {
+// GetVolume returns the application volume, 0-100
+func (c *Client) GetVolume() (int, error) {
+	var res struct {
+		Volume int `json:"volume"`
+	}
+	err := c.Call("Application.GetProperties", map[string]interface{}{"properties": []string{"volume"}}, &res)
+	return res.Volume, err
+}
 
-	q := fmt.Sprintf(PLAY_FILE_REQUEST_BODY, path)
+// Enqueue adds a file to the video playlist
+func (c *Client) Enqueue(file string) error {
+	return c.Call("Playlist.Add", map[string]interface{}{
+		"playlistid": videoPlaylistID,
+		"item":       map[string]string{"file": file},
+	}, nil)
+}
 
-	request[KodiOutput](q)
+func (c *Client) ActivePlayers() ([]ActivePlayerDescriptor, error) {
+	list := make([]ActivePlayerDescriptor, 0)
+	err := c.Call("Player.GetActivePlayers", nil, &list)
+	return list, err
 }
 
-func request[v KodiResponse](query string) (*v, error) {
-	fmt.Println(query)
+func (c *Client) GetItem(playerID int) (PlayerItem, error) {
+	var res PlayerGetItemResult
+	err := c.Call("Player.GetItem", map[string]interface{}{
+		"playerid":   playerID,
+		"properties": []string{"file", "title"},
+	}, &res)
+	return res.Item, err
+}
 
-	resp, err := http.Post(requestEndpoint(), "application/json", bytes.NewBuffer([]byte(query)))
-	if err != nil {
-		return nil, err
+// HasYoutubeAddon checks once whether the youtube addon is installed and enabled
+func (c *Client) HasYoutubeAddon() (bool, error) {
+	c.mu.Lock()
+	cached := c.youtubeAddon
+	c.mu.Unlock()
+	if cached != nil {
+		return *cached, nil
 	}
 
-	fmt.Println(resp.StatusCode)
-
-	// read response body
-	body, err := ioutil.ReadAll(resp.Body)
+	ok, err := c.HasAddon(YoutubeAddonID)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
 
-	fmt.Println(string(body))
+	c.mu.Lock()
+	c.youtubeAddon = &ok
+	c.mu.Unlock()
+	return ok, nil
+}
 
-	var res v
-	rb := bytes.NewReader(body)
-	err = json.NewDecoder(rb).Decode(&res)
+// HasAddon returns true if the addon is installed and enabled
+func (c *Client) HasAddon(id string) (bool, error) {
+	var res AddonDetailsResult
+	err := c.Call("Addons.GetAddonDetails", map[string]interface{}{
+		"addonid":    id,
+		"properties": []string{"enabled"},
+	}, &res)
+
+	// kodi reports a missing addon as invalid params
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) && rpcErr.Code == errInvalidParams {
+		return false, nil
+	}
 	if err != nil {
-		return nil, err
+		return false, err
 	}
 
-	return &res, nil
+	return res.Addon.Enabled, nil
 }
 
-func getPlayingVideoTitle(id int) string {
-
-	res, err := request[PlayerGetItemOutput](fmt.Sprintf(GET_ITEM_REQUEST_BODY, id))
-	if err != nil {
-		log.Printf("failed to get video title: %v\n", err)
-		return ""
-	}
-
-	return res.Result.Item.Label
+// UseIndex makes RandomFile pick from the media index instead of listing the directory each time
+func (c *Client) UseIndex(idx *Index) {
+	c.mu.Lock()
+	c.index = idx
+	c.mu.Unlock()
 }
 
-func videoIsPlaying() (bool, int) {
+// RandomFile returns a random file from a kodi directory or any directory below it
+func (c *Client) RandomFile(dir string) (string, error) {
+	c.mu.Lock()
+	idx := c.index
+	c.mu.Unlock()
+
+	if idx != nil {
+		f, err := idx.Random(dir, Query{})
+		return f.File, err
+	}
 
-	active, err := request[GetActivePlayersOutput](GET_ACTIVE_PLAYER_REQUEST_BODY)
+	files, err := c.GetDirectory(dir, "video")
 	if err != nil {
-		fmt.Printf("GET_ACTIVE_PLAYER returned an error: %v\n", err)
-		return false, -1
+		return "", err
 	}
-	if len(active.Result) == 0 {
-		return false, -1
+
+	list := make([]string, 0)
+	for _, f := range files {
+		if f.Filetype == "file" {
+			list = append(list, f.Filename)
+		}
 	}
-	if active.Result[0].Type != "video" {
-		return false, -1
+	if len(list) == 0 {
+		return "", fmt.Errorf("no files found in kodi directory: %v", dir)
 	}
 
-	return true, active.Result[0].PlayerID
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return list[c.rand.Intn(len(list))], nil
 }
 
-func requestEndpoint() string {
-	return fmt.Sprintf("%v:%v/jsonrpc", config.Config.Host, config.Config.Port)
+// GetDirectory lists a kodi directory, media is "video", "music", "pictures", "files" or "programs"
+func (c *Client) GetDirectory(dir, media string) ([]FileDescriptor, error) {
+	var res GetFileResult
+	err := c.Call("Files.GetDirectory", map[string]interface{}{"directory": dir, "media": media}, &res)
+	return res.Files, err
 }
 
-func stopPlayback() {
-	request[KodiOutput](STOP_VIDEO_REQUEST_BODY)
+func (c *Client) open(file string) error {
+	return c.Call("Player.Open", map[string]interface{}{"item": map[string]string{"file": file}}, nil)
 }
 
-/////////////// IO
-
-func mkdir(filepath string) error {
-	filepath = path.Dir(filepath)
-	if _, err := os.Stat(filepath); os.IsNotExist(err) {
-		fmt.Printf("generating directory: %v\n", filepath)
-		if err := os.Mkdir(filepath, os.ModePerm); err != nil {
-			if err != nil {
-				return err
-			}
+// videoPlayer returns the id of the active video player
+func (c *Client) videoPlayer() (int, bool, error) {
+	players, err := c.ActivePlayers()
+	if err != nil {
+		return 0, false, err
+	}
+	for _, p := range players {
+		if p.Type == "video" {
+			return p.PlayerID, true, nil
 		}
 	}
-
-	return nil
+	return 0, false, nil
 }
 
-func loadOutput[v KodiResponse](outputFile string) (*v, error) {
-
-	f, err := os.OpenFile(outputFile, os.O_RDONLY|os.O_EXCL, 0666)
-	if err == nil || errors.Is(err, os.ErrExist) {
-		fmt.Printf("Loading Cache: %v\n", outputFile)
+/////////////// JSON-RPC
 
-		body, err := ioutil.ReadAll(f)
-		if err != nil {
-			return nil, err
-		}
-
-		// decode response
-		var res v
-		rb := bytes.NewReader(body)
-		err = json.NewDecoder(rb).Decode(&res)
-		if err != nil {
-			return nil, err
-		}
+// Call sends a JSON-RPC request and decodes the result into result, which may be nil
+func (c *Client) Call(method string, params interface{}, result interface{}) error {
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	c.mu.Unlock()
 
-		return &res, nil
+	body, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: id, Method: method, Params: params})
+	if err != nil {
+		return err
 	}
 
-	return nil, errors.New(err.Error() + ":failed to load cached file: " + outputFile)
-}
-
-func saveOutput(outputFile string, body []byte) error {
-
-	// create output file
-	out, err := os.OpenFile(outputFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
-	defer out.Close()
+	req.Header.Set("Content-Type", "application/json")
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
 
-	_, err = out.Write(body)
+	resp, err := c.http.Do(req)
 	if err != nil {
-		return err
+		return fmt.Errorf("kodi request failed: %v: %v", method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("kodi rejected the username or password")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kodi request failed: %v: %v", method, resp.Status)
 	}
 
+	var res rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("failed to decode kodi response: %v: %v", method, err)
+	}
+	if res.Error != nil {
+		res.Error.Method = method
+		return res.Error
+	}
+
+	if result == nil || len(res.Result) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(res.Result, result); err != nil {
+		return fmt.Errorf("failed to decode kodi result: %v: %v", method, err)
+	}
 	return nil
 }
 
-func contains(s []int, e int) bool {
-	for _, a := range s {
-		if a == e {
-			return true
-		}
+func timeFromSeconds(seconds int) PlayerTime {
+	return PlayerTime{
+		Hours:   seconds / 3600,
+		Minutes: seconds % 3600 / 60,
+		Seconds: seconds % 60,
 	}
-	return false
 }
@@ -0,0 +1,184 @@
+package kodi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BlunterMonk/StreamNotify/pkg/player"
+	"github.com/BlunterMonk/StreamNotify/pkg/ws"
+)
+
+const (
+	DefaultWebSocketPort = "9090"
+
+	reconnectDelay    = 2 * time.Second
+	maxReconnectDelay = time.Minute
+)
+
+type notification struct {
+	Method string `json:"method"`
+	Params struct {
+		Data   json.RawMessage `json:"data"`
+		Sender string          `json:"sender"`
+	} `json:"params"`
+}
+
+// Listener keeps the player and screensaver state up to date from the notifications
+// kodi pushes over its websocket, instead of polling for them
+type Listener struct {
+	url    string
+	client *Client
+	store  *player.Store
+
+	mu        sync.Mutex
+	connected bool
+	conn      *ws.Conn
+	closed    bool
+	done      chan struct{}
+}
+
+// NewListener creates a listener for kodi at host:port, the client is used to read the
+// full status when a notification arrives and the store receives every update
+func NewListener(host, port string, client *Client, store *player.Store) *Listener {
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	if port == "" {
+		port = DefaultWebSocketPort
+	}
+
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("%v:%v", strings.TrimSuffix(host, "/"), port), Path: "/jsonrpc"}
+	return &Listener{
+		url:    u.String(),
+		client: client,
+		store:  store,
+		done:   make(chan struct{}),
+	}
+}
+
+// Screensaver returns true if kodi's screensaver is active
+func (l *Listener) Screensaver() bool {
+	return l.store.Screensaver()
+}
+
+// Connected returns true while the websocket is open
+func (l *Listener) Connected() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.connected
+}
+
+// Run listens until Close is called, reconnecting whenever the connection drops
+func (l *Listener) Run() {
+	delay := reconnectDelay
+	for {
+		err := l.listen()
+
+		l.mu.Lock()
+		wasConnected := l.connected
+		l.connected = false
+		closed := l.closed
+		l.mu.Unlock()
+		if closed {
+			return
+		}
+		if wasConnected {
+			delay = reconnectDelay
+		}
+
+		log.Printf("kodi notifications disconnected, reconnecting in %v: %v\n", delay, err)
+		select {
+		case <-time.After(delay):
+		case <-l.done:
+			return
+		}
+
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+func (l *Listener) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return
+	}
+	l.closed = true
+	close(l.done)
+	if l.conn != nil {
+		l.conn.Close()
+	}
+}
+
+func (l *Listener) listen() error {
+	conn, err := ws.Dial(l.url, nil, DefaultTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.conn = conn
+	l.connected = true
+	l.mu.Unlock()
+
+	log.Println("listening for kodi notifications:", l.url)
+
+	// anything could have changed while we were disconnected
+	l.refresh()
+
+	for {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		var n notification
+		if err := json.Unmarshal(msg, &n); err != nil || n.Method == "" {
+			continue
+		}
+		l.handle(n)
+	}
+}
+
+func (l *Listener) handle(n notification) {
+	switch n.Method {
+	case "Player.OnPlay", "Player.OnResume", "Player.OnAVStart", "Player.OnPause", "Player.OnSeek", "Player.OnAVChange":
+		l.refresh()
+	case "Player.OnStop":
+		l.store.Set(player.Status{State: player.StateStopped})
+	case "GUI.OnScreensaverActivated":
+		l.setScreensaver(true)
+	case "GUI.OnScreensaverDeactivated":
+		l.setScreensaver(false)
+	}
+}
+
+// refresh reads the full status over http, notifications don't include the file or position
+func (l *Listener) refresh() {
+	s, err := l.client.Status()
+	if err != nil {
+		log.Println("failed to get kodi status:", err)
+		return
+	}
+	l.store.Set(s)
+}
+
+// setScreensaver passes the screensaver on to the store, the scheduler treats it as the user being away
+func (l *Listener) setScreensaver(on bool) {
+	log.Println("kodi screensaver active:", on)
+	l.store.SetScreensaver(on)
+}
@@ -0,0 +1,45 @@
+package kodi
+
+import (
+	"testing"
+
+	"github.com/BlunterMonk/StreamNotify/pkg/player"
+)
+
+func TestListenerScreensaver(t *testing.T) {
+	store := player.NewStore()
+	events := store.Subscribe(4)
+	l := NewListener("localhost", "", nil, store)
+
+	l.handle(notification{Method: "GUI.OnScreensaverActivated"})
+	if !l.Screensaver() {
+		t.Error("screensaver not on")
+	}
+	if e := <-events; e.Type != player.EventScreensaverOn {
+		t.Errorf("got %v, want screensaver on", e.Type)
+	}
+
+	l.handle(notification{Method: "GUI.OnScreensaverDeactivated"})
+	if l.Screensaver() {
+		t.Error("screensaver still on")
+	}
+	if e := <-events; e.Type != player.EventScreensaverOff {
+		t.Errorf("got %v, want screensaver off", e.Type)
+	}
+}
+
+func TestListenerStop(t *testing.T) {
+	store := player.NewStore()
+	store.Set(player.Status{State: player.StatePlaying, Input: "smb://nas/bgm/song.mp4"})
+	events := store.Subscribe(4)
+	l := NewListener("http://kodi.local", "9090", nil, store)
+
+	if l.url != "ws://kodi.local:9090/jsonrpc" {
+		t.Errorf("got url %v", l.url)
+	}
+
+	l.handle(notification{Method: "Player.OnStop"})
+	if e := <-events; e.Type != player.EventStopped || e.Previous.Input != "smb://nas/bgm/song.mp4" {
+		t.Errorf("got %+v, want stopped", e)
+	}
+}
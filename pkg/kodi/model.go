@@ -1,8 +1,40 @@
 package kodi
 
-type KodiResponse interface {
-	KodiOutput | GetActivePlayersOutput | PlayerGetItemOutput
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// JSON-RPC error codes
+const (
+	errInvalidParams = -32602
+)
+
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int         `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+type rpcResponse struct {
+	ID      int             `json:"id"`
+	Version string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result"`
+	Error   *RPCError       `json:"error"`
+}
+
+// RPCError is an error object returned by kodi
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+	Method  string          `json:"-"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("kodi %v failed: %v (%d)", e.Method, e.Message, e.Code)
 }
+
 type KodiOutput struct {
 	ID      int         `json:"id"`
 	Version string      `json:"jsonrpc"`
@@ -22,44 +54,34 @@ type ActivePlayerDescriptor struct {
 type GetFileResult struct {
 	Files []FileDescriptor `json:"files"`
 }
-type FilesGetDirectoryOutput struct {
-	KodiOutput
-	Result GetFileResult `json:"result"`
-}
-type GetActivePlayersOutput struct {
-	KodiOutput
-	Result []ActivePlayerDescriptor `json:"result"`
-}
-type PlayerGetItemOutput struct {
-	KodiOutput
-	Result PlayerGetItemResult `json:"result"`
-}
 type PlayerGetItemResult struct {
 	Item PlayerItem `json:"item"`
 }
 type PlayerItem struct {
 	Label string `json:"label"`
+	Title string `json:"title"`
+	File  string `json:"file"`
 	Type  string `json:"type"`
 }
-type YoutubeSearchOutput struct {
-	Kind       string       `json:"kind"`
-	ETag       string       `json:"etag"`
-	RegionCode string       `json:"regionCode"`
-	Items      []searchItem `json:"items"`
+type PlayerProperties struct {
+	Speed     int        `json:"speed"`
+	Time      PlayerTime `json:"time"`
+	TotalTime PlayerTime `json:"totaltime"`
+}
+type PlayerTime struct {
+	Hours        int `json:"hours"`
+	Minutes      int `json:"minutes"`
+	Seconds      int `json:"seconds"`
+	Milliseconds int `json:"milliseconds"`
 }
-type searchItem struct {
-	Kind    string        `json:"kind"`
-	ETag    string        `json:"etag"`
-	VideoID videoId       `json:"id"`
-	Snippet searchSnippet `json:"snippet"`
+type AddonDetailsResult struct {
+	Addon AddonDetails `json:"addon"`
 }
-type videoId struct {
-	Kind string `json:"kind"`
-	ID   string `json:"videoId"`
+type AddonDetails struct {
+	AddonID string `json:"addonid"`
+	Enabled bool   `json:"enabled"`
 }
-type searchSnippet struct {
-	ChannelID    string `json:"channelId"`
-	ChannelTitle string `json:"channelTitle"`
-	LiveStatus   string `json:"liveBroadcastContent"`
-	PublishTime  string `json:"publishTime"`
+
+func (t PlayerTime) InSeconds() float64 {
+	return float64(t.Hours*3600+t.Minutes*60+t.Seconds) + float64(t.Milliseconds)/1000
 }
@@ -0,0 +1,294 @@
+package mpv
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/BlunterMonk/StreamNotify/pkg/player"
+)
+
+const DefaultTimeout = 5 * time.Second
+
+var (
+	ErrClosed  = errors.New("mpv connection closed")
+	ErrTimeout = errors.New("timed out waiting for mpv")
+)
+
+// properties observed for the player status, the index is the observe id
+var observed = []string{"pause", "path", "time-pos", "duration", "idle-active"}
+
+// Start launches mpv idle with its JSON IPC server on the socket
+func Start(bin, socket string, args ...string) (*exec.Cmd, error) {
+	if bin == "" {
+		bin = "mpv"
+	}
+
+	args = append([]string{
+		"--input-ipc-server=" + socket,
+		"--idle=yes",
+		"--force-window=yes",
+		"--fullscreen",
+	}, args...)
+
+	cmd := exec.Command(bin, args...)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start mpv: %v", err)
+	}
+
+	// reap the process when it exits
+	go cmd.Wait()
+	return cmd, nil
+}
+
+type request struct {
+	Command   []interface{} `json:"command"`
+	RequestID int64         `json:"request_id"`
+}
+
+type message struct {
+	// responses
+	RequestID int64           `json:"request_id"`
+	Error     string          `json:"error"`
+	Data      json.RawMessage `json:"data"`
+
+	// events
+	Event string `json:"event"`
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+}
+
+// Client talks to mpv over its JSON IPC socket, responses are matched to requests by request id
+// and observed properties are kept up to date from property-change events
+type Client struct {
+	conn    net.Conn
+	timeout time.Duration
+
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	nextID   int64
+	pending  map[int64]chan message
+	props    map[string]json.RawMessage
+	onChange func(player.Status)
+	err      error
+	done     chan struct{}
+}
+
+// Dial connects to a running mpv and starts observing the status properties,
+// the socket is a unix socket or a named pipe on windows
+func Dial(socket string, timeout time.Duration) (*Client, error) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	conn, err := dialSocket(socket, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return newClient(conn, timeout)
+}
+
+// newClient starts reading from the connection and observing the status properties
+func newClient(conn net.Conn, timeout time.Duration) (*Client, error) {
+	c := &Client{
+		conn:    conn,
+		timeout: timeout,
+		pending: make(map[int64]chan message, 0),
+		props:   make(map[string]json.RawMessage, 0),
+		done:    make(chan struct{}),
+	}
+	go c.read()
+
+	for i, name := range observed {
+		if _, err := c.Command("observe_property", i+1, name); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Done is closed when the connection to mpv is lost
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Watch sets a function called with the latest status every time an observed property changes
+func (c *Client) Watch(fn func(player.Status)) {
+	c.mu.Lock()
+	c.onChange = fn
+	c.mu.Unlock()
+}
+
+/////////////// Commands
+
+// LoadFile plays a file or url, mode is "replace" or "append-play"
+func (c *Client) LoadFile(uri, mode string) error {
+	_, err := c.Command("loadfile", uri, mode)
+	return err
+}
+
+func (c *Client) Stop() error {
+	_, err := c.Command("stop")
+	return err
+}
+
+func (c *Client) SetProperty(name string, value interface{}) error {
+	_, err := c.Command("set_property", name, value)
+	return err
+}
+
+// GetProperty decodes a property into out
+func (c *Client) GetProperty(name string, out interface{}) error {
+	data, err := c.Command("get_property", name)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// Status returns the status built from the observed properties, in the same shape as every other player
+func (c *Client) Status() player.Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status()
+}
+
+// Command sends a command and waits for mpv's response, returning its data
+func (c *Client) Command(args ...interface{}) (json.RawMessage, error) {
+	res := make(chan message, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = res
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	body, err := json.Marshal(request{Command: args, RequestID: id})
+	if err != nil {
+		return nil, err
+	}
+
+	c.writeMu.Lock()
+	c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	_, err = c.conn.Write(append(body, '\n'))
+	c.writeMu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to send mpv command: %v: %w", args[0], err)
+	}
+
+	select {
+	case m := <-res:
+		if m.Error != "success" {
+			return nil, fmt.Errorf("mpv command failed: %v: %v", args[0], m.Error)
+		}
+		return m.Data, nil
+	case <-c.done:
+		return nil, c.Err()
+	case <-time.After(c.timeout):
+		return nil, fmt.Errorf("%w: %v", ErrTimeout, args[0])
+	}
+}
+
+/////////////// Reading
+
+func (c *Client) read() {
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		var m message
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			continue
+		}
+
+		if m.Event == "" {
+			c.mu.Lock()
+			if res, ok := c.pending[m.RequestID]; ok {
+				res <- m
+			}
+			c.mu.Unlock()
+			continue
+		}
+
+		if m.Event == "property-change" {
+			c.propertyChange(m)
+		}
+	}
+
+	err := scanner.Err()
+	if err == nil {
+		err = errors.New("EOF")
+	}
+
+	c.mu.Lock()
+	c.err = fmt.Errorf("%w: %v", ErrClosed, err)
+	c.mu.Unlock()
+	close(c.done)
+}
+
+func (c *Client) propertyChange(m message) {
+	c.mu.Lock()
+	before := c.status()
+	c.props[m.Name] = m.Data
+	s := c.status()
+	fn := c.onChange
+	c.mu.Unlock()
+
+	// time-pos changes constantly, only report state and input changes
+	if fn != nil && (s.State != before.State || s.Input != before.Input) {
+		fn(s)
+	}
+}
+
+// status must be called with the lock held
+func (c *Client) status() player.Status {
+	var s player.Status
+	var pause, idle bool
+
+	json.Unmarshal(c.props["pause"], &pause)
+	json.Unmarshal(c.props["idle-active"], &idle)
+	json.Unmarshal(c.props["path"], &s.Input)
+	json.Unmarshal(c.props["time-pos"], &s.Time)
+	json.Unmarshal(c.props["duration"], &s.Length)
+
+	switch {
+	case idle || s.Input == "":
+		s = player.Status{State: player.StateStopped}
+	case pause:
+		s.State = player.StatePaused
+	default:
+		s.State = player.StatePlaying
+	}
+
+	s.VideoID = player.VideoID(s.Input)
+	return s
+}
@@ -0,0 +1,186 @@
+package mpv
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BlunterMonk/StreamNotify/pkg/player"
+)
+
+// fakeMpv answers the client's requests on the other end of a pipe,
+// handle returns the lines written back for each request
+type fakeMpv struct {
+	conn   net.Conn
+	mu     sync.Mutex
+	handle func(req request) []string
+}
+
+func (f *fakeMpv) send(lines ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, l := range lines {
+		f.conn.Write([]byte(l + "\n"))
+	}
+}
+
+func (f *fakeMpv) serve() {
+	scanner := bufio.NewScanner(f.conn)
+	for scanner.Scan() {
+		var req request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			continue
+		}
+		f.send(f.handle(req)...)
+	}
+}
+
+func reply(req request, data string) string {
+	return fmt.Sprintf(`{"request_id": %d, "error": "success", "data": %v}`, req.RequestID, data)
+}
+
+// newFake connects a client to a fake mpv, the observe requests sent while connecting are answered
+func newFake(t *testing.T, handle func(req request) []string) (*Client, *fakeMpv) {
+	client, server := net.Pipe()
+	f := &fakeMpv{conn: server, handle: func(req request) []string {
+		if req.Command[0] == "observe_property" {
+			return []string{reply(req, "null")}
+		}
+		return handle(req)
+	}}
+	go f.serve()
+
+	c, err := newClient(client, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.Close()
+		server.Close()
+	})
+	return c, f
+}
+
+func TestCommandResponses(t *testing.T) {
+	held := make(chan request, 1)
+	var f *fakeMpv
+	c, f := newFake(t, func(req request) []string {
+		if req.Command[0] == "stop" {
+			f.conn.Close()
+			return nil
+		}
+
+		switch req.Command[1] {
+		case "volume":
+			// answered after the next request
+			held <- req
+			return nil
+		case "speed":
+			first := <-held
+			return []string{
+				`{"request_id": 9999, "error": "success", "data": 1}`,
+				reply(req, "1.5"),
+				`{"event": "seek"}`,
+				reply(first, "80"),
+			}
+		}
+		return []string{fmt.Sprintf(`{"request_id": %d, "error": "property not found"}`, req.RequestID)}
+	})
+
+	volume := make(chan error, 1)
+	var v float64
+	go func() { volume <- c.GetProperty("volume", &v) }()
+	for len(held) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var speed float64
+	if err := c.GetProperty("speed", &speed); err != nil || speed != 1.5 {
+		t.Errorf("got speed %v %v, want 1.5", speed, err)
+	}
+	if err := <-volume; err != nil || v != 80 {
+		t.Errorf("got volume %v %v, want 80", v, err)
+	}
+
+	if err := c.GetProperty("missing", &v); err == nil {
+		t.Error("an error response succeeded")
+	}
+
+	// the connection closing fails the commands waiting on it
+	if _, err := c.Command("stop"); !errors.Is(err, ErrClosed) {
+		t.Errorf("got %v, want closed", err)
+	}
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Error("done wasn't closed")
+	}
+}
+
+func TestPropertyChanges(t *testing.T) {
+	c, f := newFake(t, func(req request) []string {
+		return []string{reply(req, "100")}
+	})
+
+	var changes []player.Status
+	c.Watch(func(s player.Status) { changes = append(changes, s) })
+
+	f.send(
+		`{"event": "property-change", "id": 3, "name": "time-pos", "data": null}`,
+		`{"event": "property-change", "id": 2, "name": "path", "data": "https://www.youtube.com/watch?v=abcdefghijk"}`,
+		`{"event": "property-change", "id": 4, "name": "duration", "data": 600}`,
+		`{"event": "property-change", "id": 3, "name": "time-pos", "data": 12.5}`,
+		`{"event": "property-change", "id": 1, "name": "pause", "data": true}`,
+		`{"event": "property-change", "id": 3, "name": "time-pos", "data": 13}`,
+	)
+	// answered after the events, so they've all been read
+	if _, err := c.Command("get_property", "volume"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 2 || changes[0].State != player.StatePlaying || changes[1].State != player.StatePaused {
+		t.Fatalf("got %+v, want playing then paused without the time changes", changes)
+	}
+	if changes[0].VideoID != "abcdefghijk" {
+		t.Errorf("got video id %q", changes[0].VideoID)
+	}
+	if s := c.Status(); s.Time != 13 || s.Length != 600 {
+		t.Errorf("got %+v, want the latest time", s)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		props map[string]string
+		want  player.Status
+	}{
+		{"nothing observed yet", map[string]string{}, player.Status{State: player.StateStopped}},
+		{"idle", map[string]string{"idle-active": "true", "path": `"E:/bgm/song.mp4"`}, player.Status{State: player.StateStopped}},
+		{
+			"playing",
+			map[string]string{"idle-active": "false", "pause": "false", "path": `"E:/bgm/song.mp4"`, "time-pos": "90.5", "duration": "240"},
+			player.Status{State: player.StatePlaying, Input: "E:/bgm/song.mp4", Time: 90.5, Length: 240},
+		},
+		{
+			"paused live stream",
+			map[string]string{"pause": "true", "path": `"https://youtu.be/abcdefghijk"`, "time-pos": "30", "duration": "null"},
+			player.Status{State: player.StatePaused, Input: "https://youtu.be/abcdefghijk", VideoID: "abcdefghijk", Time: 30},
+		},
+	}
+
+	for _, tt := range tests {
+		c := &Client{props: make(map[string]json.RawMessage, 0)}
+		for k, v := range tt.props {
+			c.props[k] = json.RawMessage(v)
+		}
+		if got := c.Status(); got != tt.want {
+			t.Errorf("%v: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package mpv
+
+import (
+	"errors"
+	"log"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/BlunterMonk/StreamNotify/pkg/player"
+)
+
+const connectAttempts = 5
+
+var _ player.Player = (*Player)(nil)
+var _ player.VolumeController = (*Player)(nil)
+var _ player.Seeker = (*Player)(nil)
+
+// Player plays through an mpv instance it starts itself, mpv is started again if it's closed
+type Player struct {
+	bin    string
+	socket string
+	args   []string
+
+	mu       sync.Mutex
+	client   *Client
+	cmd      *exec.Cmd
+	onChange func(player.Status)
+}
+
+// NewPlayer connects to mpv on the socket, starting it if it isn't running
+func NewPlayer(bin, socket string, args ...string) (*Player, error) {
+	if socket == "" {
+		socket = DefaultSocket()
+	}
+
+	p := &Player{bin: bin, socket: socket, args: args}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.connect(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *Player) PlayURL(url string) error {
+	return p.do(func(c *Client) error { return c.LoadFile(url, "replace") })
+}
+
+func (p *Player) PlayFile(path string) error {
+	return p.do(func(c *Client) error { return c.LoadFile(path, "replace") })
+}
+
+func (p *Player) Stop() error {
+	return p.do(func(c *Client) error { return c.Stop() })
+}
+
+func (p *Player) Status() (player.Status, error) {
+	var s player.Status
+	err := p.do(func(c *Client) error {
+		s = c.Status()
+		return nil
+	})
+	return s, err
+}
+
+func (p *Player) NowPlaying() string {
+	s, err := p.Status()
+	if err != nil || !s.State.Active() {
+		return ""
+	}
+	return s.Input
+}
+
+// Seek jumps to a position in seconds
+func (p *Player) Seek(seconds int) error {
+	return p.do(func(c *Client) error { return c.SetProperty("time-pos", seconds) })
+}
+
+// SetVolume sets the volume, 0-100
+func (p *Player) SetVolume(volume int) error {
+	return p.do(func(c *Client) error { return c.SetProperty("volume", volume) })
+}
+
+// GetVolume returns the volume, 0-100
+func (p *Player) GetVolume() (int, error) {
+	var v float64
+	err := p.do(func(c *Client) error { return c.GetProperty("volume", &v) })
+	return int(v), err
+}
+
+// Client returns the current mpv connection for commands the player interface doesn't cover
+func (p *Player) Client() (*Client, error) {
+	var client *Client
+	err := p.do(func(c *Client) error {
+		client = c
+		return nil
+	})
+	return client, err
+}
+
+// Watch sets a function called whenever the state or input changes
+func (p *Player) Watch(fn func(player.Status)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.onChange = fn
+	if p.client != nil {
+		p.client.Watch(fn)
+	}
+}
+
+func (p *Player) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.client == nil {
+		return nil
+	}
+	return p.client.Close()
+}
+
+// Quit closes mpv itself, it's started again if the player is used after this
+func (p *Player) Quit() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.client == nil {
+		return nil
+	}
+
+	// mpv closes the connection as it exits, so the quit response may never arrive
+	p.client.Command("quit")
+	err := p.client.Close()
+	p.client = nil
+	p.cmd = nil
+	return err
+}
+
+// do runs fn on a live connection, reconnecting or restarting mpv first if it was closed
+func (p *Player) do(fn func(c *Client) error) error {
+	p.mu.Lock()
+	if p.client != nil {
+		select {
+		case <-p.client.Done():
+			log.Println("mpv connection lost, restarting:", p.client.Err())
+			p.client = nil
+		default:
+		}
+	}
+	if p.client == nil {
+		if err := p.connect(); err != nil {
+			p.mu.Unlock()
+			return err
+		}
+	}
+	c := p.client
+	p.mu.Unlock()
+
+	return fn(c)
+}
+
+// connect must be called with the lock held
+func (p *Player) connect() error {
+	c, err := Dial(p.socket, DefaultTimeout)
+	if err != nil {
+		log.Println("mpv not running, starting it")
+
+		removeStaleSocket(p.socket)
+
+		if p.cmd, err = Start(p.bin, p.socket, p.args...); err != nil {
+			return err
+		}
+
+		// mpv takes a moment to create the socket
+		for i := 0; i < connectAttempts; i++ {
+			time.Sleep(time.Second)
+			if c, err = Dial(p.socket, DefaultTimeout); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return errors.New("failed to connect to mpv: " + err.Error())
+		}
+	}
+
+	c.Watch(p.onChange)
+	p.client = c
+	return nil
+}
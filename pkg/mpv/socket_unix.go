@@ -0,0 +1,26 @@
+//go:build !windows
+
+package mpv
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultSocket returns the ipc socket path used when none is configured
+func DefaultSocket() string {
+	return filepath.Join(os.TempDir(), "streamnotify-mpv.sock")
+}
+
+func dialSocket(socket string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout("unix", socket, timeout)
+}
+
+// removeStaleSocket removes a socket left behind by a crashed mpv, it refuses connections
+func removeStaleSocket(socket string) {
+	if _, err := os.Stat(socket); err == nil {
+		os.Remove(socket)
+	}
+}
@@ -0,0 +1,277 @@
+//go:build windows
+
+package mpv
+
+import (
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// mpv's ipc server is a named pipe on windows, a name without the prefix gets it added by mpv
+const pipePrefix = `\\.\pipe\`
+
+const (
+	errorPipeBusy syscall.Errno = 231
+	errorNoData   syscall.Errno = 232
+)
+
+var (
+	kernel32                = syscall.NewLazyDLL("kernel32.dll")
+	procCreateEventW        = kernel32.NewProc("CreateEventW")
+	procGetOverlappedResult = kernel32.NewProc("GetOverlappedResult")
+)
+
+// DefaultSocket returns the named pipe used when none is configured
+func DefaultSocket() string {
+	return pipePrefix + "streamnotify-mpv"
+}
+
+// pipeName returns the pipe mpv creates for the socket name
+func pipeName(socket string) string {
+	if strings.HasPrefix(socket, pipePrefix) {
+		return socket
+	}
+	return pipePrefix + socket
+}
+
+func dialSocket(socket string, timeout time.Duration) (net.Conn, error) {
+	addr := pipeAddr(pipeName(socket))
+	name, err := syscall.UTF16PtrFromString(string(addr))
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		// the read loop and commands use the pipe at the same time, which needs overlapped io,
+		// a synchronous handle would hold every write until the pending read returns
+		h, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil,
+			syscall.OPEN_EXISTING, syscall.FILE_FLAG_OVERLAPPED, 0)
+		if err == nil {
+			return newPipeConn(h, addr)
+		}
+
+		// every instance of the pipe is connected, mpv opens another one shortly
+		if err != errorPipeBusy || time.Now().After(deadline) {
+			return nil, &net.OpError{Op: "dial", Net: addr.Network(), Addr: addr, Err: err}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// removeStaleSocket does nothing, a named pipe goes away with the mpv that created it
+func removeStaleSocket(socket string) {}
+
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// pipeConn is a net.Conn over an overlapped named pipe handle
+type pipeConn struct {
+	h    syscall.Handle
+	addr pipeAddr
+
+	// one read and one write can be in flight, each waits on its own event
+	readMu  sync.Mutex
+	readEv  syscall.Handle
+	writeMu sync.Mutex
+	writeEv syscall.Handle
+
+	mu            sync.Mutex
+	closed        bool
+	inflight      sync.WaitGroup
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+func newPipeConn(h syscall.Handle, addr pipeAddr) (*pipeConn, error) {
+	readEv, err := createEvent()
+	if err != nil {
+		syscall.CloseHandle(h)
+		return nil, err
+	}
+	writeEv, err := createEvent()
+	if err != nil {
+		syscall.CloseHandle(readEv)
+		syscall.CloseHandle(h)
+		return nil, err
+	}
+
+	return &pipeConn{h: h, addr: addr, readEv: readEv, writeEv: writeEv}, nil
+}
+
+func (c *pipeConn) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	c.mu.Lock()
+	deadline := c.readDeadline
+	c.mu.Unlock()
+
+	n, err := c.do(p, c.readEv, deadline, syscall.ReadFile)
+	if err == syscall.ERROR_BROKEN_PIPE || err == errorNoData {
+		return n, io.EOF
+	}
+	return n, err
+}
+
+func (c *pipeConn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.mu.Lock()
+	deadline := c.writeDeadline
+	c.mu.Unlock()
+
+	written := 0
+	for written < len(p) {
+		n, err := c.do(p[written:], c.writeEv, deadline, syscall.WriteFile)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// do runs one overlapped read or write and waits for it, until the deadline if there is one
+func (c *pipeConn) do(p []byte, ev syscall.Handle, deadline time.Time,
+	op func(syscall.Handle, []byte, *uint32, *syscall.Overlapped) error) (int, error) {
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return 0, net.ErrClosed
+	}
+	c.inflight.Add(1)
+	c.mu.Unlock()
+	defer c.inflight.Done()
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// the kernel writes to the overlapped struct until the operation is done, it can't live on the stack
+	ov := new(syscall.Overlapped)
+	ov.HEvent = ev
+
+	var n uint32
+	if err := op(c.h, p, &n, ov); err != nil && err != syscall.ERROR_IO_PENDING {
+		return 0, c.err(err)
+	}
+
+	wait := uint32(syscall.INFINITE)
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d < 0 {
+			d = 0
+		}
+		wait = uint32(d / time.Millisecond)
+	}
+
+	timedOut := false
+	if ret, _ := syscall.WaitForSingleObject(ev, wait); ret == syscall.WAIT_TIMEOUT {
+		timedOut = true
+		syscall.CancelIoEx(c.h, ov)
+	}
+
+	// wait for the operation to finish even when it was canceled, the buffers are in use until then
+	n, err := getOverlappedResult(c.h, ov)
+	if timedOut && err == syscall.ERROR_OPERATION_ABORTED {
+		return int(n), os.ErrDeadlineExceeded
+	}
+	if err != nil {
+		return int(n), c.err(err)
+	}
+	return int(n), nil
+}
+
+// err reports an operation aborted by Close as a closed connection
+func (c *pipeConn) err(err error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	return err
+}
+
+// Close cancels the pending operations and closes the pipe once they've returned
+func (c *pipeConn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(done)
+	}()
+
+	// an operation can start between marking the pipe closed and canceling, so keep canceling until they're all done
+	for {
+		syscall.CancelIoEx(c.h, nil)
+		select {
+		case <-done:
+			syscall.CloseHandle(c.readEv)
+			syscall.CloseHandle(c.writeEv)
+			return syscall.CloseHandle(c.h)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return c.addr }
+func (c *pipeConn) RemoteAddr() net.Addr { return c.addr }
+
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *pipeConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+// createEvent returns a manual reset event for overlapped io
+func createEvent() (syscall.Handle, error) {
+	h, _, err := procCreateEventW.Call(0, 1, 0, 0)
+	if h == 0 {
+		return 0, err
+	}
+	return syscall.Handle(h), nil
+}
+
+// getOverlappedResult waits for the overlapped operation and returns the bytes it transferred
+func getOverlappedResult(h syscall.Handle, ov *syscall.Overlapped) (uint32, error) {
+	var n uint32
+	r, _, err := procGetOverlappedResult.Call(uintptr(h), uintptr(unsafe.Pointer(ov)), uintptr(unsafe.Pointer(&n)), 1)
+	if r == 0 {
+		return n, err
+	}
+	return n, nil
+}
@@ -0,0 +1,160 @@
+//go:build windows
+
+package mpv
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+var (
+	procCreateNamedPipeW = kernel32.NewProc("CreateNamedPipeW")
+	procConnectNamedPipe = kernel32.NewProc("ConnectNamedPipe")
+)
+
+// listenPipe creates a single instance of a named pipe, standing in for mpv's ipc server,
+// the server end is sent once a client connects
+func listenPipe(t *testing.T, name string) <-chan *os.File {
+	n, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// duplex, byte mode, blocking, one instance
+	h, _, err := procCreateNamedPipeW.Call(uintptr(unsafe.Pointer(n)), 3, 0, 1, 4096, 4096, 0, 0)
+	if syscall.Handle(h) == syscall.InvalidHandle {
+		t.Fatal(err)
+	}
+
+	ch := make(chan *os.File, 1)
+	go func() {
+		// fails with ERROR_PIPE_CONNECTED if the client got there first, it's connected either way
+		procConnectNamedPipe.Call(h, 0)
+		ch <- os.NewFile(h, name)
+	}()
+	return ch
+}
+
+func dialTestPipe(t *testing.T) (net.Conn, *os.File) {
+	name := fmt.Sprintf("streamnotify-test-%d-%d", os.Getpid(), time.Now().UnixNano())
+	server := listenPipe(t, pipeName(name))
+
+	// mpv is given the name without the prefix
+	conn, err := dialSocket(name, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := <-server
+	t.Cleanup(func() {
+		conn.Close()
+		f.Close()
+	})
+	return conn, f
+}
+
+func TestPipeName(t *testing.T) {
+	if got := pipeName("mpv-socket"); got != `\\.\pipe\mpv-socket` {
+		t.Errorf("got %v", got)
+	}
+	if got := pipeName(`\\.\pipe\mpv-socket`); got != `\\.\pipe\mpv-socket` {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestPipeDialMissing(t *testing.T) {
+	if _, err := dialSocket("streamnotify-test-missing", 100*time.Millisecond); err == nil {
+		t.Error("dialed a pipe nobody created")
+	}
+}
+
+// the read loop waits on the pipe while commands are written, a synchronous handle would block the writes
+func TestPipeWriteDuringRead(t *testing.T) {
+	conn, f := dialTestPipe(t)
+
+	read := make(chan string, 1)
+	go func() {
+		buf := make([]byte, 64)
+		n, _ := conn.Read(buf)
+		read <- string(buf[:n])
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	written := make(chan error, 1)
+	go func() {
+		_, err := conn.Write([]byte(`{"command": ["stop"], "request_id": 1}` + "\n"))
+		written <- err
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the write waited for the pending read")
+	}
+
+	buf := make([]byte, 64)
+	n, err := f.Read(buf)
+	if err != nil || string(buf[:n]) != `{"command": ["stop"], "request_id": 1}`+"\n" {
+		t.Errorf("server got %q %v", buf[:n], err)
+	}
+
+	f.Write([]byte(`{"request_id": 1, "error": "success"}` + "\n"))
+	if got := <-read; got != `{"request_id": 1, "error": "success"}`+"\n" {
+		t.Errorf("client got %q", got)
+	}
+}
+
+func TestPipeDeadline(t *testing.T) {
+	conn, _ := dialTestPipe(t)
+
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	start := time.Now()
+	if _, err := conn.Read(make([]byte, 64)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("got %v, want deadline exceeded", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("the read took %v", d)
+	}
+
+	// the pipe is still usable after a timed out read
+	conn.SetReadDeadline(time.Time{})
+	if _, err := conn.Write([]byte("{}\n")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPipeClose(t *testing.T) {
+	conn, f := dialTestPipe(t)
+
+	read := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(make([]byte, 64))
+		read <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	conn.Close()
+	select {
+	case err := <-read:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("got %v, want closed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("close didn't cancel the pending read")
+	}
+
+	// mpv exiting shows up as the end of the stream
+	conn, f = dialTestPipe(t)
+	f.Close()
+	if _, err := conn.Read(make([]byte, 64)); err != io.EOF {
+		t.Errorf("got %v, want EOF", err)
+	}
+}
@@ -0,0 +1,292 @@
+package multiview
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/BlunterMonk/StreamNotify/pkg/player"
+)
+
+var ErrNotPlaying = errors.New("video is not in multiview")
+
+// Tile is a window position and size in screen pixels
+type Tile struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Layout splits the screen into n tiles, one fills the screen,
+// two sit side by side and three or four make a 2x2 grid
+func Layout(n, width, height int) []Tile {
+	switch {
+	case n <= 1:
+		return []Tile{{0, 0, width, height}}
+	case n == 2:
+		w := width / 2
+		return []Tile{
+			{0, 0, w, height},
+			{w, 0, width - w, height},
+		}
+	}
+
+	w, h := width/2, height/2
+	tiles := []Tile{
+		{0, 0, w, h},
+		{w, 0, width - w, h},
+		{0, h, w, height - h},
+		{w, h, width - w, height - h},
+	}
+	if n < len(tiles) {
+		tiles = tiles[:n]
+	}
+	return tiles
+}
+
+// Stream is a live stream placed in a multiview window
+type Stream struct {
+	Channel string `json:"channel"`
+	VideoID string `json:"videoId"`
+	URL     string `json:"url"`
+}
+
+// NewPlayerFunc starts the player window for a tile, close shuts the window
+type NewPlayerFunc func(index int, tile Tile) (p player.Player, close func() error, err error)
+
+type window struct {
+	tile   Tile
+	player player.Player
+	close  func() error
+	stream Stream
+}
+
+// Manager keeps a player window per tile playing the top live streams,
+// only the focused window has audio and the rest are muted
+type Manager struct {
+	newPlayer NewPlayerFunc
+
+	mu      sync.Mutex
+	windows []*window
+	focus   string // video id of the stream with audio
+	volume  int
+}
+
+// New creates a manager for n windows tiled across the screen, windows are only opened once a stream is assigned
+func New(n, width, height int, newPlayer NewPlayerFunc) *Manager {
+	m := &Manager{
+		newPlayer: newPlayer,
+		windows:   make([]*window, 0, n),
+		volume:    100,
+	}
+
+	for _, t := range Layout(n, width, height) {
+		m.windows = append(m.windows, &window{tile: t})
+	}
+	return m
+}
+
+// Windows returns how many streams can be shown at once
+func (m *Manager) Windows() int {
+	return len(m.windows)
+}
+
+// Assign shows the streams in priority order, streams past the number of windows are left out.
+// Streams already showing keep their window, and the first stream gets audio unless the focused one is still showing.
+func (m *Manager) Assign(streams []Stream) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(streams) > len(m.windows) {
+		streams = streams[:len(m.windows)]
+	}
+
+	wanted := make(map[string]bool, len(streams))
+	for _, s := range streams {
+		wanted[s.VideoID] = true
+	}
+
+	// windows showing a stream that's no longer wanted are free
+	placed := make(map[string]bool, len(streams))
+	free := make([]*window, 0)
+	for _, w := range m.windows {
+		if w.stream.VideoID != "" && wanted[w.stream.VideoID] {
+			placed[w.stream.VideoID] = true
+			continue
+		}
+		free = append(free, w)
+	}
+
+	var first error
+	for _, s := range streams {
+		if placed[s.VideoID] {
+			continue
+		}
+
+		w := free[0]
+		free = free[1:]
+		if err := m.play(w, s); err != nil {
+			if first == nil {
+				first = err
+			}
+		}
+	}
+
+	// close windows nothing was put in
+	for _, w := range free {
+		if err := m.closeWindow(w); err != nil {
+			if first == nil {
+				first = err
+			}
+		}
+	}
+
+	if !wanted[m.focus] && len(streams) > 0 {
+		m.focus = streams[0].VideoID
+	}
+	if err := m.applyFocus(); err != nil {
+		if first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// Focus moves the audio to the window showing the video
+func (m *Manager) Focus(videoID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, w := range m.windows {
+		if w.stream.VideoID == videoID {
+			m.focus = videoID
+			return m.applyFocus()
+		}
+	}
+	return ErrNotPlaying
+}
+
+// SetVolume sets the volume of the focused window
+func (m *Manager) SetVolume(volume int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.volume = volume
+	return m.applyFocus()
+}
+
+// Streams returns the streams showing, in window order
+func (m *Manager) Streams() []Stream {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := make([]Stream, 0)
+	for _, w := range m.windows {
+		if w.stream.VideoID != "" {
+			list = append(list, w.stream)
+		}
+	}
+	return list
+}
+
+// Active reports if any window is showing a stream
+func (m *Manager) Active() bool {
+	return len(m.Streams()) > 0
+}
+
+// Stop closes every window
+func (m *Manager) Stop() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var first error
+	for _, w := range m.windows {
+		if err := m.closeWindow(w); err != nil {
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	m.focus = ""
+	return first
+}
+
+func (m *Manager) Close() error {
+	return m.Stop()
+}
+
+// play must be called with the lock held
+func (m *Manager) play(w *window, s Stream) error {
+	if w.player == nil {
+		i := m.index(w)
+		p, close, err := m.newPlayer(i, w.tile)
+		if err != nil {
+			return fmt.Errorf("failed to open multiview window %d: %w", i, err)
+		}
+		w.player, w.close = p, close
+	}
+
+	// start muted so two streams aren't heard at once before the focus is set
+	if v, ok := w.player.(player.VolumeController); ok {
+		if err := v.SetVolume(0); err != nil {
+			log.Printf("failed to mute multiview window %d: %v\n", m.index(w), err)
+		}
+	}
+
+	log.Printf("multiview window %d: %v %v\n", m.index(w), s.Channel, s.VideoID)
+	if err := w.player.PlayURL(s.URL); err != nil {
+		w.stream = Stream{}
+		return err
+	}
+	w.stream = s
+	return nil
+}
+
+// closeWindow must be called with the lock held
+func (m *Manager) closeWindow(w *window) error {
+	w.stream = Stream{}
+	if w.player == nil {
+		return nil
+	}
+
+	var err error
+	if w.close != nil {
+		err = w.close()
+	}
+	w.player, w.close = nil, nil
+	return err
+}
+
+// applyFocus must be called with the lock held
+func (m *Manager) applyFocus() error {
+	var first error
+	for _, w := range m.windows {
+		v, ok := w.player.(player.VolumeController)
+		if !ok || w.stream.VideoID == "" {
+			continue
+		}
+
+		volume := 0
+		if w.stream.VideoID == m.focus {
+			volume = m.volume
+		}
+		if err := v.SetVolume(volume); err != nil {
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+func (m *Manager) index(w *window) int {
+	for i, x := range m.windows {
+		if x == w {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,176 @@
+package multiview
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/BlunterMonk/StreamNotify/pkg/player"
+)
+
+func TestLayout(t *testing.T) {
+	tests := []struct {
+		n    int
+		want []Tile
+	}{
+		{0, []Tile{{0, 0, 1921, 1081}}},
+		{1, []Tile{{0, 0, 1921, 1081}}},
+		{2, []Tile{{0, 0, 960, 1081}, {960, 0, 961, 1081}}},
+		{3, []Tile{{0, 0, 960, 540}, {960, 0, 961, 540}, {0, 540, 960, 541}}},
+		{4, []Tile{{0, 0, 960, 540}, {960, 0, 961, 540}, {0, 540, 960, 541}, {960, 540, 961, 541}}},
+		{6, []Tile{{0, 0, 960, 540}, {960, 0, 961, 540}, {0, 540, 960, 541}, {960, 540, 961, 541}}},
+	}
+	for _, tt := range tests {
+		got := Layout(tt.n, 1921, 1081)
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%d windows: got %v, want %v", tt.n, got, tt.want)
+		}
+	}
+}
+
+// fakeWindow is a player window that remembers what it played and its volume
+type fakeWindow struct {
+	index   int
+	url     string
+	volume  int
+	closed  bool
+	muteErr error
+}
+
+func (w *fakeWindow) PlayURL(url string) error   { w.url = url; return nil }
+func (w *fakeWindow) PlayFile(path string) error { return nil }
+func (w *fakeWindow) Stop() error                { return nil }
+func (w *fakeWindow) Status() (player.Status, error) {
+	return player.Status{State: player.StatePlaying, Input: w.url}, nil
+}
+func (w *fakeWindow) NowPlaying() string      { return w.url }
+func (w *fakeWindow) GetVolume() (int, error) { return w.volume, nil }
+func (w *fakeWindow) SetVolume(volume int) error {
+	if volume == 0 && w.muteErr != nil {
+		return w.muteErr
+	}
+	w.volume = volume
+	return nil
+}
+
+type fakeScreen struct {
+	opened []*fakeWindow
+}
+
+func (s *fakeScreen) newPlayer(index int, tile Tile) (player.Player, func() error, error) {
+	w := &fakeWindow{index: index}
+	s.opened = append(s.opened, w)
+	return w, func() error { w.closed = true; return nil }, nil
+}
+
+// open returns the windows still open, by index
+func (s *fakeScreen) open() map[int]*fakeWindow {
+	open := make(map[int]*fakeWindow, 0)
+	for _, w := range s.opened {
+		if !w.closed {
+			open[w.index] = w
+		}
+	}
+	return open
+}
+
+func streams(ids ...string) []Stream {
+	list := make([]Stream, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, Stream{Channel: id, VideoID: id, URL: "https://youtu.be/" + id})
+	}
+	return list
+}
+
+func TestAssignKeepsWindows(t *testing.T) {
+	s := &fakeScreen{}
+	m := New(4, 1920, 1080, s.newPlayer)
+
+	if err := m.Assign(streams("a", "b", "c")); err != nil {
+		t.Fatal(err)
+	}
+	before := s.open()
+	if len(before) != 3 {
+		t.Fatalf("got %d windows, want 3", len(before))
+	}
+
+	// b and c keep their windows, a's window is reused for d
+	if err := m.Assign(streams("c", "d", "b")); err != nil {
+		t.Fatal(err)
+	}
+	after := s.open()
+	if after[1] != before[1] || after[2] != before[2] {
+		t.Error("streams still showing were moved")
+	}
+	if after[0].url != "https://youtu.be/d" {
+		t.Errorf("got %v in the freed window, want d", after[0].url)
+	}
+	if len(s.opened) != 3 {
+		t.Errorf("opened %d windows, want the free one reused", len(s.opened))
+	}
+}
+
+func TestAssignFreesWindows(t *testing.T) {
+	s := &fakeScreen{}
+	m := New(4, 1920, 1080, s.newPlayer)
+
+	m.Assign(streams("a", "b", "c", "d", "e"))
+	if got := len(m.Streams()); got != 4 {
+		t.Errorf("showing %d streams, want the first 4", got)
+	}
+
+	m.Assign(streams("d"))
+	open := s.open()
+	if len(open) != 1 || open[3] == nil || open[3].url != "https://youtu.be/d" {
+		t.Errorf("got windows %v, want only d's", open)
+	}
+
+	m.Assign(nil)
+	if m.Active() || len(s.open()) != 0 {
+		t.Error("windows left open")
+	}
+}
+
+func TestAssignFocus(t *testing.T) {
+	s := &fakeScreen{}
+	m := New(4, 1920, 1080, s.newPlayer)
+	m.SetVolume(70)
+
+	m.Assign(streams("a", "b"))
+	if w := s.open(); w[0].volume != 70 || w[1].volume != 0 {
+		t.Errorf("got volumes %d %d, want the first stream heard", w[0].volume, w[1].volume)
+	}
+
+	if err := m.Focus("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Focus("zz"); !errors.Is(err, ErrNotPlaying) {
+		t.Errorf("got %v, want not playing", err)
+	}
+
+	// the focus stays on b while it's showing
+	m.Assign(streams("c", "a", "b"))
+	if w := s.open(); w[1].volume != 70 || w[0].volume != 0 || w[2].volume != 0 {
+		t.Errorf("got volumes %d %d %d, want b heard", w[0].volume, w[1].volume, w[2].volume)
+	}
+
+	// b is gone, the top stream gets the audio
+	m.Assign(streams("c", "a"))
+	if w := s.open(); w[2].volume != 70 || w[0].volume != 0 {
+		t.Errorf("got volumes %d %d, want c heard", w[2].volume, w[0].volume)
+	}
+}
+
+func TestAssignMuteFails(t *testing.T) {
+	m := New(2, 1920, 1080, func(index int, tile Tile) (player.Player, func() error, error) {
+		return &fakeWindow{index: index, muteErr: errors.New("volume is stuck")}, nil, nil
+	})
+
+	// the stream still plays, the failure shows up when the other window can't be muted
+	if err := m.Assign(streams("a", "b")); err == nil {
+		t.Error("expected the mute error")
+	}
+	if len(m.Streams()) != 2 {
+		t.Errorf("got %v, want both streams showing", m.Streams())
+	}
+}
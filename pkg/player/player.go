@@ -0,0 +1,20 @@
+package player
+
+// Player is a playback backend the app can autoplay streams and ambience in
+type Player interface {
+	// PlayURL replaces whatever is playing with a stream or web URL
+	PlayURL(url string) error
+	// PlayFile replaces whatever is playing with a local file
+	PlayFile(path string) error
+	// Stop stops playback and clears anything queued
+	Stop() error
+	// Status returns the current playback status
+	Status() (Status, error)
+	// NowPlaying returns the input from the last status, empty if nothing is playing
+	NowPlaying() string
+}
+
+// Seeker is implemented by players that can jump to a position in the current video
+type Seeker interface {
+	Seek(seconds int) error
+}
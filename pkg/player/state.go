@@ -0,0 +1,216 @@
+package player
+
+import (
+	"log"
+	"regexp"
+	"sync"
+)
+
+// State is the playback state of a player, the same for every backend
+type State int
+
+const (
+	StateStopped State = iota
+	StateOpening
+	StatePlaying
+	StatePaused
+)
+
+// Active returns true if something is loaded and not stopped
+func (s State) Active() bool {
+	return s != StateStopped
+}
+
+func (s State) String() string {
+	switch s {
+	case StateStopped:
+		return "stopped"
+	case StateOpening:
+		return "opening"
+	case StatePlaying:
+		return "playing"
+	case StatePaused:
+		return "paused"
+	}
+	return "unknown"
+}
+
+// Status is what a player is currently doing
+type Status struct {
+	State   State   `json:"state"`
+	Input   string  `json:"input"`
+	VideoID string  `json:"videoId"`
+	Time    float64 `json:"time"`   // seconds
+	Length  float64 `json:"length"` // seconds, zero for live streams
+}
+
+type EventType int
+
+const (
+	EventStarted EventType = iota
+	EventPaused
+	EventStopped
+	EventInputChanged
+	EventScreensaverOn  // the user is away, reported by players with a screensaver like kodi
+	EventScreensaverOff // the user is back
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventStarted:
+		return "started"
+	case EventPaused:
+		return "paused"
+	case EventStopped:
+		return "stopped"
+	case EventInputChanged:
+		return "input-changed"
+	case EventScreensaverOn:
+		return "screensaver-on"
+	case EventScreensaverOff:
+		return "screensaver-off"
+	}
+	return "unknown"
+}
+
+// Event is published whenever the player status changes in a meaningful way
+type Event struct {
+	Type     EventType
+	Status   Status
+	Previous Status
+}
+
+// Store holds the latest player status and publishes change events,
+// it's safe to update from one goroutine and read from another
+type Store struct {
+	pub         sync.Mutex // held from a change until it's published, so events arrive in order
+	mu          sync.RWMutex
+	status      Status
+	screensaver bool
+	subs        []chan Event
+}
+
+func NewStore() *Store {
+	return &Store{}
+}
+
+// Get returns the latest status
+func (s *Store) Get() Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status
+}
+
+// Subscribe returns a channel that receives every event, events are dropped if the channel is full
+func (s *Store) Subscribe(buffer int) <-chan Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan Event, buffer)
+	s.subs = append(s.subs, ch)
+	return ch
+}
+
+// Set replaces the status and publishes the events for the change
+func (s *Store) Set(status Status) []Event {
+	if status.VideoID == "" {
+		status.VideoID = VideoID(status.Input)
+	}
+
+	s.pub.Lock()
+	defer s.pub.Unlock()
+
+	s.mu.Lock()
+	prev := s.status
+	s.status = status
+	subs := s.subs
+	s.mu.Unlock()
+
+	events := changes(prev, status)
+	publish(subs, events)
+	return events
+}
+
+// Screensaver reports if the player's screensaver is on
+func (s *Store) Screensaver() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.screensaver
+}
+
+// SetScreensaver records the player's screensaver turning on or off and publishes the change
+func (s *Store) SetScreensaver(on bool) []Event {
+	s.pub.Lock()
+	defer s.pub.Unlock()
+
+	s.mu.Lock()
+	changed := s.screensaver != on
+	s.screensaver = on
+	status := s.status
+	subs := s.subs
+	s.mu.Unlock()
+
+	if !changed {
+		return nil
+	}
+
+	t := EventScreensaverOff
+	if on {
+		t = EventScreensaverOn
+	}
+	events := []Event{{Type: t, Status: status, Previous: status}}
+	publish(subs, events)
+	return events
+}
+
+func publish(subs []chan Event, events []Event) {
+	for _, e := range events {
+		for _, ch := range subs {
+			select {
+			case ch <- e:
+			default:
+				log.Println("player event dropped:", e.Type)
+			}
+		}
+	}
+}
+
+func changes(prev, cur Status) []Event {
+	events := make([]Event, 0)
+	add := func(t EventType) {
+		events = append(events, Event{Type: t, Status: cur, Previous: prev})
+	}
+
+	if cur.Input != prev.Input && cur.Input != "" {
+		add(EventInputChanged)
+	}
+
+	if cur.State != prev.State {
+		switch cur.State {
+		case StatePlaying:
+			add(EventStarted)
+		case StatePaused:
+			add(EventPaused)
+		case StateStopped:
+			add(EventStopped)
+		}
+	}
+
+	return events
+}
+
+var (
+	videoIdSourceRegex = regexp.MustCompile("/id/([^/]*)/source")
+	videoIdWatchRegex  = regexp.MustCompile(`(?:youtube\.com/watch\?(?:.*&)?v=|youtu\.be/|youtube\.com/live/|plugin\.video\.youtube/.*[?&]video_?id=)([a-zA-Z0-9_-]{11})`)
+)
+
+// VideoID returns the youtube video ID from a watch URL, a kodi youtube addon URL or a googlevideo stream URL
+func VideoID(input string) string {
+	if m := videoIdWatchRegex.FindStringSubmatch(input); m != nil {
+		return m[1]
+	}
+	if m := videoIdSourceRegex.FindStringSubmatch(input); m != nil {
+		return m[1]
+	}
+	return ""
+}
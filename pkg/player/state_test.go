@@ -0,0 +1,176 @@
+package player
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestChanges(t *testing.T) {
+	video := "https://www.youtube.com/watch?v=abcdefghijk"
+	tests := []struct {
+		name string
+		prev Status
+		cur  Status
+		want []EventType
+	}{
+		{"start", Status{}, Status{State: StatePlaying, Input: video}, []EventType{EventInputChanged, EventStarted}},
+		{"pause", Status{State: StatePlaying, Input: video}, Status{State: StatePaused, Input: video}, []EventType{EventPaused}},
+		{"resume", Status{State: StatePaused, Input: video}, Status{State: StatePlaying, Input: video}, []EventType{EventStarted}},
+		{"stop", Status{State: StatePlaying, Input: video}, Status{}, []EventType{EventStopped}},
+		{"switch", Status{State: StatePlaying, Input: video}, Status{State: StatePlaying, Input: "song.mp3"}, []EventType{EventInputChanged}},
+		{"opening", Status{}, Status{State: StateOpening, Input: video}, []EventType{EventInputChanged}},
+		{"progress", Status{State: StatePlaying, Input: video, Time: 1}, Status{State: StatePlaying, Input: video, Time: 3}, nil},
+	}
+	for _, tt := range tests {
+		got := changes(tt.prev, tt.cur)
+		if len(got) != len(tt.want) {
+			t.Errorf("%v: got %v events, want %v", tt.name, len(got), tt.want)
+			continue
+		}
+		for i, e := range got {
+			if e.Type != tt.want[i] || e.Status != tt.cur || e.Previous != tt.prev {
+				t.Errorf("%v: got %+v, want %v", tt.name, e, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestStoreSubscribers(t *testing.T) {
+	s := NewStore()
+	a := s.Subscribe(4)
+	b := s.Subscribe(1)
+
+	s.Set(Status{State: StatePlaying, Input: "https://youtu.be/abcdefghijk"})
+	if got := s.Get().VideoID; got != "abcdefghijk" {
+		t.Errorf("got video id %q", got)
+	}
+
+	if len(a) != 2 {
+		t.Errorf("got %d events, want 2", len(a))
+	}
+	// a full subscriber drops events instead of blocking the update
+	if len(b) != 1 {
+		t.Errorf("got %d events, want 1", len(b))
+	}
+}
+
+// run with -race, the kodi listener and the scheduler update the store while the queue server reads it
+func TestStoreConcurrent(t *testing.T) {
+	s := NewStore()
+	events := s.Subscribe(1024)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				st := StatePlaying
+				if j%2 == 0 {
+					st = StatePaused
+				}
+				s.Set(Status{State: st, Input: "song.mp3", Time: float64(i*100 + j)})
+			}
+		}(i)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.Get()
+				s.Subscribe(1)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-events:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(done)
+
+	if got := s.Get(); got.Input != "song.mp3" {
+		t.Errorf("got %+v", got)
+	}
+}
+
+// every set is a new input, so each input changed event follows on from the one before
+func TestStoreEventOrder(t *testing.T) {
+	s := NewStore()
+	events := s.Subscribe(4096)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				s.Set(Status{State: StatePlaying, Input: fmt.Sprintf("song-%d-%d.mp3", i, j)})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	last := ""
+	for len(events) > 0 {
+		ev := <-events
+		if ev.Type != EventInputChanged {
+			continue
+		}
+		if ev.Previous.Input != last {
+			t.Fatalf("got a change from %v after %v, events were published out of order", ev.Previous.Input, last)
+		}
+		last = ev.Status.Input
+	}
+	if last != s.Get().Input {
+		t.Errorf("the last event was for %v, the store has %v", last, s.Get().Input)
+	}
+}
+
+func TestVideoID(t *testing.T) {
+	tests := map[string]string{
+		"https://www.youtube.com/watch?v=abcdefghijk":                          "abcdefghijk",
+		"https://www.youtube.com/watch?feature=share&v=abcdefghijk":            "abcdefghijk",
+		"https://youtu.be/abcdefghijk":                                         "abcdefghijk",
+		"https://www.youtube.com/live/abcdefghijk?si=x":                        "abcdefghijk",
+		"plugin://plugin.video.youtube/play/?video_id=abcdefghijk":             "abcdefghijk",
+		"https://rr1.googlevideo.com/videoplayback/id/abcdefghijk.1/source/yt": "abcdefghijk.1",
+		"E:/User/Videos/bgm/song.mp3":                                          "",
+	}
+	for in, want := range tests {
+		if got := VideoID(in); got != want {
+			t.Errorf("%v: got %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestStoreScreensaver(t *testing.T) {
+	s := NewStore()
+	events := s.Subscribe(4)
+
+	s.SetScreensaver(true)
+	s.SetScreensaver(true)
+	s.SetScreensaver(false)
+
+	want := []EventType{EventScreensaverOn, EventScreensaverOff}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %v", len(events), want)
+	}
+	for _, w := range want {
+		if e := <-events; e.Type != w {
+			t.Errorf("got %v, want %v", e.Type, w)
+		}
+	}
+	if s.Screensaver() {
+		t.Error("screensaver still on")
+	}
+}
@@ -0,0 +1,69 @@
+package player
+
+import (
+	"log"
+	"time"
+)
+
+// fadeStep is how often the volume changes during a fade
+const fadeStep = 100 * time.Millisecond
+
+// VolumeController is implemented by players whose volume can be changed, volume is a percentage 0-100
+type VolumeController interface {
+	SetVolume(volume int) error
+	GetVolume() (int, error)
+}
+
+// Fade moves the volume from its current level to volume over the duration, waiting between steps with sleep.
+// A duration shorter than one step sets it immediately
+func Fade(v VolumeController, volume int, d time.Duration, sleep func(time.Duration)) error {
+	from, err := v.GetVolume()
+	if err != nil {
+		return err
+	}
+
+	steps := int(d / fadeStep)
+	for i := 1; i < steps; i++ {
+		if err := v.SetVolume(from + (volume-from)*i/steps); err != nil {
+			return err
+		}
+		sleep(fadeStep)
+	}
+
+	return v.SetVolume(volume)
+}
+
+// FadeSwitch fades out whatever is playing, runs play, then fades back in to the volume
+// target returns for the volume before the switch. Players without volume control, or whose
+// volume can't be read, just run play.
+func FadeSwitch(p Player, target func(current int) int, d time.Duration, sleep func(time.Duration), play func() error) error {
+	v, ok := p.(VolumeController)
+	if !ok {
+		return play()
+	}
+
+	current, err := v.GetVolume()
+	if err != nil {
+		log.Println("failed to get the volume, switching without a fade:", err)
+		return play()
+	}
+
+	// there's nothing to fade out if nothing is playing
+	if p.NowPlaying() != "" {
+		if err := Fade(v, 0, d, sleep); err != nil {
+			return err
+		}
+	} else if err := v.SetVolume(0); err != nil {
+		return err
+	}
+
+	// whatever is still playing mustn't be left muted
+	if err := play(); err != nil {
+		if verr := v.SetVolume(target(current)); verr != nil {
+			log.Println("failed to restore the volume:", verr)
+		}
+		return err
+	}
+
+	return Fade(v, target(current), d, sleep)
+}
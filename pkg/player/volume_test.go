@@ -0,0 +1,97 @@
+package player
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakePlayer records every volume it's set to
+type fakePlayer struct {
+	playing   string
+	volume    int
+	volumes   []int
+	getErr    error
+	playErr   error
+	playedAt  int // the volume when play ran
+	playCalls int
+}
+
+func (p *fakePlayer) PlayURL(url string) error   { return nil }
+func (p *fakePlayer) PlayFile(path string) error { return nil }
+func (p *fakePlayer) Stop() error                { return nil }
+func (p *fakePlayer) Status() (Status, error)    { return Status{}, nil }
+func (p *fakePlayer) NowPlaying() string         { return p.playing }
+func (p *fakePlayer) GetVolume() (int, error)    { return p.volume, p.getErr }
+func (p *fakePlayer) SetVolume(volume int) error {
+	p.volume = volume
+	p.volumes = append(p.volumes, volume)
+	return nil
+}
+
+func (p *fakePlayer) play() error {
+	p.playCalls++
+	p.playedAt = p.volume
+	return p.playErr
+}
+
+func half(current int) int { return current / 2 }
+
+func TestFadeSwitch(t *testing.T) {
+	p := &fakePlayer{playing: "song.mp3", volume: 80}
+
+	if err := FadeSwitch(p, half, 0, time.Sleep, p.play); err != nil {
+		t.Fatal(err)
+	}
+	if p.playedAt != 0 {
+		t.Errorf("played at volume %d, want muted", p.playedAt)
+	}
+	if p.volume != 40 {
+		t.Errorf("got volume %d, want 40", p.volume)
+	}
+}
+
+func TestFadeSwitchPlayFails(t *testing.T) {
+	p := &fakePlayer{playing: "song.mp3", volume: 80, playErr: errors.New("no such file")}
+
+	if err := FadeSwitch(p, half, 0, time.Sleep, p.play); err == nil {
+		t.Fatal("expected the play error")
+	}
+	if p.volume != 40 {
+		t.Errorf("got volume %d, want it restored to 40", p.volume)
+	}
+}
+
+func TestFadeSwitchNoVolume(t *testing.T) {
+	p := &fakePlayer{playing: "song.mp3", volume: 80, getErr: errors.New("not responding")}
+
+	if err := FadeSwitch(p, half, 0, time.Sleep, p.play); err != nil {
+		t.Fatal(err)
+	}
+	if p.playCalls != 1 || len(p.volumes) != 0 {
+		t.Errorf("played %d times, set volumes %v, want one play without a fade", p.playCalls, p.volumes)
+	}
+}
+
+func TestFadeSteps(t *testing.T) {
+	p := &fakePlayer{volume: 100}
+
+	var slept time.Duration
+	if err := Fade(p, 50, 500*time.Millisecond, func(d time.Duration) { slept += d }); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int{90, 80, 70, 60, 50}
+	if len(p.volumes) != len(want) {
+		t.Fatalf("got volumes %v, want %v", p.volumes, want)
+	}
+	for i := range want {
+		if p.volumes[i] != want[i] {
+			t.Errorf("got volumes %v, want %v", p.volumes, want)
+			break
+		}
+	}
+	if slept != 4*fadeStep {
+		t.Errorf("slept %v, want a step between every change", slept)
+	}
+}
@@ -0,0 +1,117 @@
+package priority
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Explanation says what would be autoplayed and why every other channel wasn't
+type Explanation struct {
+	Plan   Plan
+	Choice Choice
+	Chosen bool
+	Lines  []Line
+}
+
+// Line is the reason for a single channel
+type Line struct {
+	Channel string
+	Tier    string // empty if the channel isn't in a tier
+	Reason  string
+}
+
+// Explain makes the same choice as Choose and gives the reason for each channel
+func (p Plan) Explain(cands []Candidate, playing string, r *rand.Rand) Explanation {
+	e := Explanation{Plan: p}
+	e.Choice, e.Chosen = p.Choose(cands, playing, r)
+
+	byName := make(map[string]Candidate, len(cands))
+	for _, c := range cands {
+		byName[c.Channel] = c
+	}
+
+	seen := make(map[string]bool, 0)
+	chosenTier := p.Tier(e.Choice.Channel)
+	for i, t := range p.Tiers {
+		for _, name := range t.Channels {
+			seen[name] = true
+			e.Lines = append(e.Lines, Line{Channel: name, Tier: t.Name, Reason: p.reason(t, i, chosenTier, name, byName[name], e)})
+		}
+	}
+
+	// channels outside the tiers only play as a random stream when nothing in a tier is live
+	rest := make([]string, 0)
+	for _, c := range cands {
+		if !seen[c.Channel] {
+			rest = append(rest, c.Channel)
+		}
+	}
+	sort.Strings(rest)
+	for _, name := range rest {
+		c := byName[name]
+		reason := "not in a tier, only played as a random stream"
+		switch {
+		case p.Never(name):
+			reason = p.never[name]
+		case !c.Live:
+			reason = "not in a tier, not live"
+		case !c.Allowed:
+			reason = "not in a tier, live but filtered from autoplay by title"
+		}
+		e.Lines = append(e.Lines, Line{Channel: name, Reason: reason})
+	}
+
+	return e
+}
+
+// reason explains a channel in a tier, c is the zero Candidate if the channel hasn't been checked
+func (p Plan) reason(t Tier, tier, chosenTier int, name string, c Candidate, e Explanation) string {
+	reasons := make([]string, 0)
+	if moved, ok := t.moved[name]; ok {
+		reasons = append(reasons, "moved here "+moved)
+	}
+
+	switch {
+	case p.Never(name):
+		reasons = append(reasons, p.never[name])
+	case !c.Live:
+		reasons = append(reasons, "not live")
+	case !c.Allowed:
+		reasons = append(reasons, fmt.Sprintf("live but filtered from autoplay by title %q", c.Title))
+	case e.Chosen && name == e.Choice.Channel:
+		reasons = append(reasons, "chosen, "+e.Choice.Reason)
+	case e.Chosen && tier > chosenTier:
+		reasons = append(reasons, fmt.Sprintf("live, but tier %q is higher", e.Choice.Tier))
+	case e.Chosen && tier == chosenTier:
+		reasons = append(reasons, "live, but "+e.Choice.Channel+" was picked in the same tier")
+	}
+	if w := t.Weights[name]; w > 0 {
+		reasons = append(reasons, fmt.Sprintf("weight %d", w))
+	}
+
+	return strings.Join(reasons, ", ")
+}
+
+func (e Explanation) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "at %v\n", e.Plan.At.Format("Mon 2006-01-02 15:04"))
+	if e.Chosen {
+		fmt.Fprintf(&b, "autoplay %v (%v): %v\n", e.Choice.Channel, e.Choice.VideoID, e.Choice.Reason)
+	} else {
+		fmt.Fprintln(&b, "no live stream in a tier, a random live stream or ambience plays instead")
+	}
+
+	for _, l := range e.Lines {
+		tier := "-"
+		if l.Tier != "" {
+			tier = l.Tier
+		}
+		fmt.Fprintf(&b, "  %-12v tier %-8v %v\n", l.Channel, tier, l.Reason)
+	}
+	for _, s := range e.Plan.Ignored {
+		fmt.Fprintln(&b, "ignored", s)
+	}
+	return b.String()
+}
@@ -0,0 +1,357 @@
+// Package priority decides which live stream gets autoplayed, from tiers of channels in the config
+// that can change by time of day and day of the week.
+package priority
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BlunterMonk/StreamNotify/pkg/config"
+	"github.com/BlunterMonk/StreamNotify/pkg/filter"
+	yt "github.com/BlunterMonk/StreamNotify/pkg/youtube"
+)
+
+// Tier is a group of channels with the same priority
+type Tier struct {
+	Name     string
+	Channels []string
+	Weights  map[string]int
+	moved    map[string]string // channels moved into the tier by an override, with the override
+}
+
+// Plan is the tiers as they apply at one moment, after overrides
+type Plan struct {
+	At      time.Time
+	Tiers   []Tier
+	Ignored []string          // overrides left out because they can't be read, with the error
+	never   map[string]string // channels that aren't autoplayed, with the reason
+}
+
+var (
+	// bad overrides are logged once, plans are made on every ambience check
+	warnMu sync.Mutex
+	warned = make(map[string]bool, 0)
+)
+
+// Candidate is a channel that could be autoplayed
+type Candidate struct {
+	Channel string
+	VideoID string
+	Title   string
+	Live    bool
+	Allowed bool // passes the autoplay filters
+}
+
+// Choice is the stream picked to autoplay and why
+type Choice struct {
+	Channel string
+	VideoID string
+	Tier    string
+	Reason  string
+}
+
+// Current returns the plan for the priority rules in the config at the given time
+func Current(now time.Time) Plan {
+	cfg := config.Get()
+	return NewPlan(cfg.PriorityRules, cfg.Priority, now)
+}
+
+// NewPlan applies the overrides that are active at now, legacy is the comma separated priority list
+// used when there are no tiers
+func NewPlan(c config.PriorityConfig, legacy string, now time.Time) Plan {
+	p := Plan{At: now, never: make(map[string]string, 0)}
+
+	if len(c.Tiers) > 0 {
+		for i, t := range c.Tiers {
+			name := t.Name
+			if name == "" {
+				name = fmt.Sprint(i + 1)
+			}
+			p.Tiers = append(p.Tiers, Tier{Name: name, Channels: trim(t.Channels), Weights: t.Weights})
+		}
+	} else {
+		for _, name := range trim(strings.Split(legacy, ",")) {
+			p.Tiers = append(p.Tiers, Tier{Name: fmt.Sprint(len(p.Tiers) + 1), Channels: []string{name}})
+		}
+	}
+
+	for _, name := range trim(c.Never) {
+		p.never[name] = "never autoplayed"
+	}
+
+	applied := make(map[string]bool, 0)
+	for _, o := range c.Overrides {
+		active, err := Active(o, now)
+		if err != nil {
+			p.ignore(o, err)
+			continue
+		}
+		if !active {
+			continue
+		}
+
+		for _, name := range trim(o.Channels) {
+			if applied[name] {
+				continue
+			}
+			applied[name] = true
+
+			if o.Never {
+				p.never[name] = "not autoplayed " + Describe(o)
+				continue
+			}
+			p.move(name, o)
+		}
+	}
+
+	return p
+}
+
+// ignore records an override that can't be applied, logging it the first time it's seen
+func (p *Plan) ignore(o config.OverrideConfig, err error) {
+	msg := fmt.Sprintf("override for %v %v: %v", strings.Join(o.Channels, ","), Describe(o), err)
+	p.Ignored = append(p.Ignored, msg)
+
+	warnMu.Lock()
+	defer warnMu.Unlock()
+	if !warned[msg] {
+		warned[msg] = true
+		log.Println("ignoring priority", msg)
+	}
+}
+
+// move takes the channel out of its tier and puts it in the override's tier
+func (p *Plan) move(name string, o config.OverrideConfig) {
+	weight := 0
+	for i := range p.Tiers {
+		t := &p.Tiers[i]
+		for j, c := range t.Channels {
+			if c == name {
+				weight = t.Weights[name]
+				t.Channels = append(t.Channels[:j:j], t.Channels[j+1:]...)
+				break
+			}
+		}
+	}
+
+	i := p.tierIndex(o.Tier)
+	if i < 0 {
+		p.Tiers = append(p.Tiers, Tier{Name: o.Tier})
+		i = len(p.Tiers) - 1
+	}
+
+	t := &p.Tiers[i]
+	t.Channels = append(t.Channels, name)
+	if weight > 0 && t.Weights[name] == 0 {
+		weights := make(map[string]int, len(t.Weights)+1)
+		for k, v := range t.Weights {
+			weights[k] = v
+		}
+		weights[name] = weight
+		t.Weights = weights
+	}
+	if t.moved == nil {
+		t.moved = make(map[string]string, 0)
+	}
+	t.moved[name] = Describe(o)
+}
+
+func (p Plan) tierIndex(name string) int {
+	for i, t := range p.Tiers {
+		if t.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Tier returns the index of the channel's tier, 0 is the highest, -1 if it isn't in one
+func (p Plan) Tier(channel string) int {
+	for i, t := range p.Tiers {
+		for _, c := range t.Channels {
+			if c == channel {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Never reports if the channel is kept from being autoplayed
+func (p Plan) Never(channel string) bool {
+	_, ok := p.never[channel]
+	return ok
+}
+
+// Channels returns every channel in a tier, in tier order
+func (p Plan) Channels() []string {
+	list := make([]string, 0)
+	for _, t := range p.Tiers {
+		list = append(list, t.Channels...)
+	}
+	return list
+}
+
+// Choose picks a stream from the highest tier with a playable one, at random by weight within the tier.
+// The playing channel is kept if it's in that tier so streams in the same tier don't keep replacing each other.
+func (p Plan) Choose(cands []Candidate, playing string, r *rand.Rand) (Choice, bool) {
+	for _, t := range p.Tiers {
+		list := p.playable(t, cands)
+		if len(list) == 0 {
+			continue
+		}
+
+		for _, c := range list {
+			if c.Channel == playing {
+				return Choice{Channel: c.Channel, VideoID: c.VideoID, Tier: t.Name,
+					Reason: fmt.Sprintf("already playing, highest live tier %q", t.Name)}, true
+			}
+		}
+
+		if len(list) == 1 {
+			c := list[0]
+			return Choice{Channel: c.Channel, VideoID: c.VideoID, Tier: t.Name,
+				Reason: fmt.Sprintf("only live stream in the highest live tier %q", t.Name)}, true
+		}
+
+		total := 0
+		for _, c := range list {
+			total += weight(t, c.Channel)
+		}
+		n := r.Intn(total)
+		for _, c := range list {
+			w := weight(t, c.Channel)
+			if n < w {
+				return Choice{Channel: c.Channel, VideoID: c.VideoID, Tier: t.Name,
+					Reason: fmt.Sprintf("picked with weight %d of %d in the highest live tier %q", w, total, t.Name)}, true
+			}
+			n -= w
+		}
+	}
+
+	return Choice{}, false
+}
+
+// Ranked returns the playable channels in priority order, heavier channels first within a tier
+func (p Plan) Ranked(cands []Candidate) []string {
+	list := make([]string, 0)
+	for _, t := range p.Tiers {
+		tier := p.playable(t, cands)
+		for i := 1; i < len(tier); i++ {
+			for j := i; j > 0 && weight(t, tier[j].Channel) > weight(t, tier[j-1].Channel); j-- {
+				tier[j], tier[j-1] = tier[j-1], tier[j]
+			}
+		}
+		for _, c := range tier {
+			list = append(list, c.Channel)
+		}
+	}
+	return list
+}
+
+// playable returns the candidates in the tier that are live and allowed to autoplay, in tier order
+func (p Plan) playable(t Tier, cands []Candidate) []Candidate {
+	list := make([]Candidate, 0)
+	for _, name := range t.Channels {
+		for _, c := range cands {
+			if c.Channel == name && c.Live && c.Allowed && !p.Never(name) {
+				list = append(list, c)
+			}
+		}
+	}
+	return list
+}
+
+func weight(t Tier, channel string) int {
+	if w := t.Weights[channel]; w > 0 {
+		return w
+	}
+	return 1
+}
+
+// Candidates returns every channel's live stream, checked against the autoplay filters
+func Candidates(streamInfo map[string]yt.VideoDetails) []Candidate {
+	list := make([]Candidate, 0, len(streamInfo))
+	for name, v := range streamInfo {
+		d := v.VideoDetails
+		list = append(list, Candidate{
+			Channel: name,
+			VideoID: d.VideoID,
+			Title:   d.Title,
+			Live:    d.IsLive,
+			Allowed: filter.Allowed(name, d.Title, filter.AutoPlay),
+		})
+	}
+	return list
+}
+
+// Active reports if the override applies at the given time, an override with a start or end
+// that isn't a "15:04" time is never active and returns an error
+func Active(o config.OverrideConfig, now time.Time) (bool, error) {
+	start, err := clock(o.Start, 0)
+	if err != nil {
+		return false, fmt.Errorf("bad start time %q", o.Start)
+	}
+	end, err := clock(o.End, 24*60)
+	if err != nil {
+		return false, fmt.Errorf("bad end time %q", o.End)
+	}
+
+	if len(o.Days) > 0 {
+		day := strings.ToLower(now.Weekday().String()[:3])
+		found := false
+		for _, d := range o.Days {
+			if len(d) >= 3 && strings.ToLower(strings.TrimSpace(d)[:3]) == day {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+
+	m := now.Hour()*60 + now.Minute()
+	if start <= end {
+		return m >= start && m < end, nil
+	}
+	return m >= start || m < end, nil
+}
+
+// clock returns the minutes into the day of a "15:04" time
+func clock(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Describe returns when the override applies, for explanations
+func Describe(o config.OverrideConfig) string {
+	when := "all day"
+	if o.Start != "" || o.End != "" {
+		when = fmt.Sprintf("%v-%v", o.Start, o.End)
+	}
+	if len(o.Days) > 0 {
+		when += " on " + strings.Join(o.Days, ",")
+	}
+	return "by override " + when
+}
+
+func trim(list []string) []string {
+	out := make([]string, 0, len(list))
+	for _, s := range list {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
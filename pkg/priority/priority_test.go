@@ -0,0 +1,92 @@
+package priority
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BlunterMonk/StreamNotify/pkg/config"
+)
+
+// a monday
+var noon = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+func TestActive(t *testing.T) {
+	tests := []struct {
+		name   string
+		o      config.OverrideConfig
+		active bool
+		err    bool
+	}{
+		{"all day", config.OverrideConfig{}, true, false},
+		{"inside", config.OverrideConfig{Start: "11:00", End: "13:00"}, true, false},
+		{"outside", config.OverrideConfig{Start: "13:00", End: "14:00"}, false, false},
+		{"past midnight", config.OverrideConfig{Start: "22:00", End: "13:00"}, true, false},
+		{"open end", config.OverrideConfig{Start: "11:30"}, true, false},
+		{"other day", config.OverrideConfig{Days: []string{"tue", "Wednesday"}}, false, false},
+		{"same day", config.OverrideConfig{Days: []string{"Monday"}, Start: "11:00"}, true, false},
+		{"bad start", config.OverrideConfig{Start: "noon", End: "13:00"}, false, true},
+		{"bad end", config.OverrideConfig{Start: "11:00", End: "25:00"}, false, true},
+	}
+	for _, tt := range tests {
+		active, err := Active(tt.o, noon)
+		if active != tt.active || (err != nil) != tt.err {
+			t.Errorf("%v: got %v, %v, want %v, error %v", tt.name, active, err, tt.active, tt.err)
+		}
+	}
+}
+
+func TestBadOverrideIgnored(t *testing.T) {
+	c := config.PriorityConfig{
+		Tiers: []config.TierConfig{{Name: "main", Channels: []string{"doki"}}},
+		Overrides: []config.OverrideConfig{
+			{Channels: []string{"doki"}, Never: true, Start: "9pm", End: "23:00"},
+		},
+	}
+
+	p := NewPlan(c, "", noon)
+	if p.Never("doki") {
+		t.Error("applied an override with a bad time")
+	}
+	if len(p.Ignored) != 1 || !strings.Contains(p.Ignored[0], `bad start time "9pm"`) {
+		t.Errorf("got ignored %q", p.Ignored)
+	}
+
+	e := p.Explain(nil, "", rand.New(rand.NewSource(1)))
+	if !strings.Contains(e.String(), "ignored override for doki") {
+		t.Errorf("the explanation doesn't mention the bad override:\n%v", e)
+	}
+}
+
+func TestExplainChannelNotChecked(t *testing.T) {
+	c := config.PriorityConfig{
+		Tiers: []config.TierConfig{
+			{Name: "main", Channels: []string{"doki"}},
+			{Name: "rest", Channels: []string{"mint"}, Weights: map[string]int{"mint": 3}},
+		},
+		Overrides: []config.OverrideConfig{
+			{Channels: []string{"mint"}, Tier: "main", Start: "11:00", End: "13:00"},
+		},
+		Never: []string{"eva"},
+	}
+	c.Tiers[1].Channels = append(c.Tiers[1].Channels, "eva")
+
+	// neither mint nor eva were checked, so they aren't candidates
+	cands := []Candidate{{Channel: "doki", VideoID: "abcdefghijk", Live: true, Allowed: true}}
+	e := NewPlan(c, "", noon).Explain(cands, "", rand.New(rand.NewSource(1)))
+
+	reasons := make(map[string]string, 0)
+	for _, l := range e.Lines {
+		reasons[l.Channel] = l.Reason
+	}
+	if r := reasons["mint"]; !strings.HasPrefix(r, "moved here by override 11:00-13:00") || !strings.Contains(r, "weight 3") {
+		t.Errorf("got mint %q, want it moved with its weight", r)
+	}
+	if r := reasons["eva"]; r != "never autoplayed" {
+		t.Errorf("got eva %q, want never autoplayed", r)
+	}
+	if r := reasons["doki"]; !strings.HasPrefix(r, "chosen") {
+		t.Errorf("got doki %q, want chosen", r)
+	}
+}
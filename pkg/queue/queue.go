@@ -0,0 +1,160 @@
+package queue
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("video is not in the queue")
+
+// Entry is a live stream waiting to play
+type Entry struct {
+	Channel string    `json:"channel"`
+	VideoID string    `json:"videoId"`
+	Title   string    `json:"title"`
+	Added   time.Time `json:"added"`
+}
+
+// Queue holds live streams lined up behind the current one
+type Queue struct {
+	mu      sync.Mutex
+	current Entry
+	entries []Entry
+}
+
+func New() *Queue {
+	return &Queue{entries: make([]Entry, 0)}
+}
+
+// Push adds a stream to the back of the queue, returning false if it's already queued or playing
+func (q *Queue) Push(e Entry) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if e.VideoID == q.current.VideoID || q.index(e.VideoID) >= 0 {
+		return false
+	}
+	if e.Added.IsZero() {
+		e.Added = time.Now()
+	}
+
+	q.entries = append(q.entries, e)
+	return true
+}
+
+// Next removes the first stream from the queue and makes it the current one
+func (q *Queue) Next() (Entry, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.entries) == 0 {
+		return Entry{}, false
+	}
+
+	q.current = q.entries[0]
+	q.entries = q.entries[1:]
+	return q.current, true
+}
+
+// Current returns the stream last started from the queue or with SetCurrent
+func (q *Queue) Current() Entry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.current
+}
+
+// SetCurrent records a stream that was started outside the queue, taking it out of the queue
+func (q *Queue) SetCurrent(e Entry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if i := q.index(e.VideoID); i >= 0 {
+		q.entries = append(q.entries[:i], q.entries[i+1:]...)
+	}
+	q.current = e
+}
+
+// List returns a copy of the queued streams in play order
+func (q *Queue) List() []Entry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	list := make([]Entry, len(q.entries))
+	copy(list, q.entries)
+	return list
+}
+
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.entries)
+}
+
+// Move puts a queued stream at a new position, 0 plays next
+func (q *Queue) Move(videoID string, index int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := q.index(videoID)
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	e := q.entries[i]
+	q.entries = append(q.entries[:i], q.entries[i+1:]...)
+
+	if index < 0 {
+		index = 0
+	}
+	if index > len(q.entries) {
+		index = len(q.entries)
+	}
+
+	q.entries = append(q.entries[:index], append([]Entry{e}, q.entries[index:]...)...)
+	return nil
+}
+
+// Remove takes a stream out of the queue
+func (q *Queue) Remove(videoID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := q.index(videoID)
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	q.entries = append(q.entries[:i], q.entries[i+1:]...)
+	return nil
+}
+
+// Prune drops every queued stream that isn't live anymore, returning the dropped streams
+func (q *Queue) Prune(live func(Entry) bool) []Entry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	kept := make([]Entry, 0, len(q.entries))
+	dropped := make([]Entry, 0)
+	for _, e := range q.entries {
+		if live(e) {
+			kept = append(kept, e)
+		} else {
+			dropped = append(dropped, e)
+		}
+	}
+
+	q.entries = kept
+	return dropped
+}
+
+func (q *Queue) index(videoID string) int {
+	for i, e := range q.entries {
+		if e.VideoID == videoID {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,227 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DefaultAddr is where the running app listens for queue commands, only on localhost
+const DefaultAddr = "localhost:4290"
+
+// ControlHeader must be set on every request. A web page can't add it to a cross-origin request
+// without a CORS preflight, which the server never allows, so pages in the browser can't send commands.
+const ControlHeader = "X-StreamNotify"
+
+// State is the current stream and everything queued behind it
+type State struct {
+	Current Entry   `json:"current"`
+	Entries []Entry `json:"entries"`
+}
+
+// Server lets the queue be viewed and changed while the app is running.
+// Skips are passed to the app through Skips since only it can control the player.
+type Server struct {
+	queue *Queue
+	skips chan struct{}
+	srv   *http.Server
+}
+
+func NewServer(addr string, q *Queue) *Server {
+	s := &Server{
+		queue: q,
+		skips: make(chan struct{}, 1),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/queue", s.handleList)
+	mux.HandleFunc("/queue/skip", s.handleSkip)
+	mux.HandleFunc("/queue/move", s.handleMove)
+	mux.HandleFunc("/queue/remove", s.handleRemove)
+	s.srv = &http.Server{Addr: addr, Handler: guard(mux)}
+
+	return s
+}
+
+// Skips receives a value every time the current stream should be skipped
+func (s *Server) Skips() <-chan struct{} {
+	return s.skips
+}
+
+func (s *Server) ListenAndServe() error {
+	err := s.srv.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) Close() error {
+	return s.srv.Close()
+}
+
+// guard rejects requests that could come from a web page: ones without the control header,
+// from another origin, or for a host other than this one
+func guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(ControlHeader) != "1" {
+			http.Error(w, "missing "+ControlHeader+" header", http.StatusForbidden)
+			return
+		}
+		if !localHost(r) {
+			http.Error(w, "invalid host", http.StatusForbidden)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				http.Error(w, "cross-origin requests are not allowed", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// localHost reports if the request is for a loopback host on the port the server is bound to.
+// A page whose domain is rebound to 127.0.0.1 is same origin with itself, but still sends its own domain as the host
+func localHost(r *http.Request) bool {
+	host, port, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		return false
+	}
+	if host != "localhost" && host != "127.0.0.1" && host != "::1" {
+		return false
+	}
+
+	local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return false
+	}
+	_, bound, err := net.SplitHostPort(local.String())
+	return err == nil && port == bound
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.writeState(w)
+}
+
+func (s *Server) handleSkip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.queue.Len() == 0 {
+		http.Error(w, "the queue is empty", http.StatusConflict)
+		return
+	}
+
+	// a skip that's already waiting covers this one too
+	select {
+	case s.skips <- struct{}{}:
+	default:
+	}
+	s.writeState(w)
+}
+
+func (s *Server) handleMove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	index, err := strconv.Atoi(r.FormValue("index"))
+	if err != nil {
+		http.Error(w, "invalid index", http.StatusBadRequest)
+		return
+	}
+	if err := s.queue.Move(r.FormValue("video"), index); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	s.writeState(w)
+}
+
+func (s *Server) handleRemove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := s.queue.Remove(r.FormValue("video")); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	s.writeState(w)
+}
+
+func (s *Server) writeState(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(State{Current: s.queue.Current(), Entries: s.queue.List()})
+}
+
+// Client sends queue commands to a running app
+type Client struct {
+	addr   string
+	client *http.Client
+}
+
+func NewClient(addr string) *Client {
+	return &Client{addr: addr, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (c *Client) List() (State, error) {
+	return c.do(http.MethodGet, "/queue", nil)
+}
+
+// Skip stops the current stream and plays the next one in the queue
+func (c *Client) Skip() (State, error) {
+	return c.do(http.MethodPost, "/queue/skip", nil)
+}
+
+// Move puts a queued stream at a new position, 0 plays next
+func (c *Client) Move(videoID string, index int) (State, error) {
+	return c.do(http.MethodPost, "/queue/move", url.Values{"video": {videoID}, "index": {strconv.Itoa(index)}})
+}
+
+func (c *Client) Remove(videoID string) (State, error) {
+	return c.do(http.MethodPost, "/queue/remove", url.Values{"video": {videoID}})
+}
+
+func (c *Client) do(method, path string, form url.Values) (State, error) {
+	var st State
+
+	u := fmt.Sprintf("http://%v%v", c.addr, path)
+	if form != nil {
+		u += "?" + form.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return st, err
+	}
+	req.Header.Set(ControlHeader, "1")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return st, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return st, fmt.Errorf("%v: %s", resp.Status, msg)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&st)
+	return st, err
+}
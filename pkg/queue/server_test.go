@@ -0,0 +1,127 @@
+package queue
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T) (*Server, *httptest.Server, *Client) {
+	q := New()
+	q.Push(Entry{Channel: "doki", VideoID: "abcdefghijk", Title: "karaoke"})
+	q.Push(Entry{Channel: "mint", VideoID: "bcdefghijkl", Title: "zatsudan"})
+
+	s := NewServer("", q)
+	ts := httptest.NewServer(s.srv.Handler)
+	t.Cleanup(ts.Close)
+
+	return s, ts, NewClient(strings.TrimPrefix(ts.URL, "http://"))
+}
+
+func TestClientCommands(t *testing.T) {
+	s, _, c := newTestServer(t)
+
+	st, err := c.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Entries) != 2 {
+		t.Fatalf("got %+v", st)
+	}
+
+	st, err = c.Move("bcdefghijkl", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Entries[0].VideoID != "bcdefghijkl" {
+		t.Errorf("got %+v, want mint first", st.Entries)
+	}
+
+	if _, err := c.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-s.Skips():
+	default:
+		t.Error("skip wasn't passed on")
+	}
+
+	if _, err := c.Remove("nope"); err == nil {
+		t.Error("removed a video that isn't queued")
+	}
+}
+
+// a page open in the browser can post a form to localhost, it mustn't change the queue
+func TestRejectsBrowserRequests(t *testing.T) {
+	s, ts, _ := newTestServer(t)
+
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(ts.URL, "http://"))
+	control := map[string]string{ControlHeader: "1"}
+
+	tests := []struct {
+		name   string
+		host   string
+		header map[string]string
+	}{
+		{"no header", "", nil},
+		{"wrong value", "", map[string]string{ControlHeader: "yes"}},
+		{"foreign origin", "", map[string]string{ControlHeader: "1", "Origin": "https://evil.example"}},
+		{"bad origin", "", map[string]string{ControlHeader: "1", "Origin": "::"}},
+		// a page on a domain rebound to 127.0.0.1 sends its own domain as the host, and as the origin
+		{"rebound domain", "evil.example:" + port, map[string]string{ControlHeader: "1", "Origin": "http://evil.example:" + port}},
+		{"rebound domain without origin", "evil.example:" + port, control},
+		{"other port", "localhost:1", control},
+		{"no port", "localhost", control},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/queue/remove?video=abcdefghijk", nil)
+		if tt.host != "" {
+			req.Host = tt.host
+		}
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%v: got %v, want forbidden", tt.name, resp.Status)
+		}
+	}
+
+	if s.queue.Len() != 2 {
+		t.Errorf("queue changed, %d left", s.queue.Len())
+	}
+
+	// the same origin is fine, the client doesn't send one
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/queue", nil)
+	req.Header.Set(ControlHeader, "1")
+	req.Header.Set("Origin", ts.URL)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("same origin: got %v", resp.Status)
+	}
+
+	// every loopback name for the bound port is fine
+	for _, host := range []string{"localhost", "127.0.0.1", "[::1]"} {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/queue", nil)
+		req.Host = host + ":" + port
+		req.Header.Set(ControlHeader, "1")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%v: got %v", host, resp.Status)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package recorder
+
+import (
+	"os"
+	"os/exec"
+)
+
+// newGroup does nothing, an interrupt only goes to the process it's sent to
+func newGroup(cmd *exec.Cmd) {}
+
+// interrupt asks the process to exit the way ctrl+c would
+func interrupt(p *os.Process) error {
+	return p.Signal(os.Interrupt)
+}
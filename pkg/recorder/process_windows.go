@@ -0,0 +1,28 @@
+//go:build windows
+
+package recorder
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+const ctrlBreakEvent = 1
+
+var procGenerateConsoleCtrlEvent = syscall.NewLazyDLL("kernel32.dll").NewProc("GenerateConsoleCtrlEvent")
+
+// newGroup starts the process in its own process group so it can be sent ctrl+break without it reaching us
+func newGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// interrupt sends ctrl+break to the process group, windows has no interrupt signal.
+// it fails when there's no console to send it through
+func interrupt(p *os.Process) error {
+	r, _, err := procGenerateConsoleCtrlEvent.Call(ctrlBreakEvent, uintptr(p.Pid))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
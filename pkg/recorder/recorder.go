@@ -0,0 +1,542 @@
+package recorder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Streamlink = "streamlink"
+	YtDlp      = "yt-dlp"
+	Ffmpeg     = "ffmpeg"
+
+	DefaultTemplate = "{channel}/{date}_{time}_{title}_{id}.ts"
+
+	// files are written with this suffix and renamed when the process exits
+	partSuffix = ".part"
+	// lists the recordings in the folder that were written here, nothing else is ever deleted
+	manifestName = ".recordings.json"
+
+	// how long the tool has to close the file after being asked to stop
+	stopTimeout = 30 * time.Second
+
+	minRestartDelay = 5 * time.Second
+	maxRestartDelay = 5 * time.Minute
+	// a process that ran this long is treated as healthy and its next restart isn't delayed further
+	healthyRun = 10 * time.Minute
+)
+
+var unsafeChars = regexp.MustCompile(`[<>:"/\\|?*\x00-\x1f]+`)
+
+// Stream is a live stream that can be recorded
+type Stream struct {
+	Channel string
+	VideoID string
+	Title   string
+	Keep    bool // the channel couldn't be checked, a recording of the stream carries on but none is started
+}
+
+// Recording is a stream being recorded, a restarted recording is split into numbered files
+type Recording struct {
+	Channel  string    `json:"channel"`
+	VideoID  string    `json:"videoId"`
+	Title    string    `json:"title"`
+	Path     string    `json:"path"`
+	Started  time.Time `json:"started"`
+	Restarts int       `json:"restarts"`
+}
+
+// Options sets up how streams are recorded
+type Options struct {
+	Tool     string // "streamlink", "yt-dlp" or "ffmpeg"
+	Bin      string // path to the tool, defaults to the tool on the PATH
+	Dir      string // recordings folder
+	Template string // file path under Dir, see expand for the placeholders
+	Quality  string // quality passed to streamlink or yt-dlp, defaults to best
+	MaxBytes int64  // finished recordings are deleted oldest first once they add up to more, 0 keeps everything
+
+	// Resolve returns a direct stream url, ffmpeg can't read youtube watch pages so it's required for ffmpeg
+	Resolve func(videoID string) (string, error)
+}
+
+// Recorder records live streams to disk, restarting the recording if the process dies while the stream is live
+type Recorder struct {
+	opts Options
+
+	mu   sync.Mutex
+	jobs map[string]*job // keyed by video id
+	wg   sync.WaitGroup
+
+	manifestMu sync.Mutex
+	owned      map[string]bool // finished recordings, slash separated paths under Dir
+}
+
+type job struct {
+	rec  Recording
+	stop chan struct{}
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.Writer     // ffmpeg's stdin, it's stopped by sending q
+	exited chan struct{} // closed when cmd exits
+}
+
+func New(opts Options) (*Recorder, error) {
+	switch opts.Tool {
+	case Streamlink, YtDlp:
+	case Ffmpeg:
+		if opts.Resolve == nil {
+			return nil, errors.New("recording with ffmpeg needs a stream resolver")
+		}
+	default:
+		return nil, fmt.Errorf("unknown recorder tool: %v", opts.Tool)
+	}
+
+	if opts.Bin == "" {
+		opts.Bin = opts.Tool
+	}
+	if opts.Template == "" {
+		opts.Template = DefaultTemplate
+	}
+	if opts.Quality == "" {
+		opts.Quality = "best"
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{
+		opts:  opts,
+		jobs:  make(map[string]*job, 0),
+		owned: make(map[string]bool, 0),
+	}
+	if err := r.loadManifest(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Update starts recording streams that went live and finishes recordings of streams that aren't in the list anymore
+func (r *Recorder) Update(live []Stream) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	wanted := make(map[string]bool, len(live))
+	for _, s := range live {
+		_, ok := r.jobs[s.VideoID]
+		if s.Keep && !ok {
+			continue
+		}
+
+		wanted[s.VideoID] = true
+		if ok {
+			continue
+		}
+
+		j := &job{
+			rec: Recording{
+				Channel: s.Channel,
+				VideoID: s.VideoID,
+				Title:   s.Title,
+				Path:    filepath.Join(r.opts.Dir, expand(r.opts.Template, s, time.Now())),
+				Started: time.Now(),
+			},
+			stop: make(chan struct{}),
+		}
+		r.jobs[s.VideoID] = j
+
+		log.Println("recording live stream:", s.Channel, j.rec.Path)
+		r.wg.Add(1)
+		go r.run(j)
+	}
+
+	for id, j := range r.jobs {
+		if wanted[id] {
+			continue
+		}
+
+		log.Println("stream ended, finishing recording:", j.rec.Channel, j.rec.Path)
+		delete(r.jobs, id)
+		j.finish()
+	}
+}
+
+// Active returns the recordings in progress
+func (r *Recorder) Active() []Recording {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := make([]Recording, 0, len(r.jobs))
+	for _, j := range r.jobs {
+		j.mu.Lock()
+		list = append(list, j.rec)
+		j.mu.Unlock()
+	}
+
+	sort.Slice(list, func(a, b int) bool { return list[a].Started.Before(list[b].Started) })
+	return list
+}
+
+// Close finishes every recording and waits for the processes to exit
+func (r *Recorder) Close() error {
+	r.Update(nil)
+	r.wg.Wait()
+	return nil
+}
+
+// run records until the job is stopped, restarting the tool with backoff whenever it exits early
+func (r *Recorder) run(j *job) {
+	defer r.wg.Done()
+	// the last part counts once it's finished
+	defer r.prune()
+
+	delay := minRestartDelay
+	for part := 0; ; part++ {
+		// other recordings may have finished while this one was running
+		r.prune()
+
+		started := time.Now()
+		if err := r.record(j, part); err != nil {
+			log.Printf("recording of %v stopped: %v\n", j.rec.Channel, err)
+		}
+
+		select {
+		case <-j.stop:
+			return
+		default:
+		}
+
+		if time.Since(started) > healthyRun {
+			delay = minRestartDelay
+		}
+
+		log.Printf("restarting recording of %v in %v\n", j.rec.Channel, delay)
+		select {
+		case <-j.stop:
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
+
+		j.mu.Lock()
+		j.rec.Restarts++
+		j.mu.Unlock()
+	}
+}
+
+// record runs the tool once, writing to a part file that's renamed when it exits
+func (r *Recorder) record(j *job, part int) error {
+	path := partPath(j.rec.Path, part)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	args, err := r.args(j.rec.VideoID, path+partSuffix)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(r.opts.Bin, args...)
+	newGroup(cmd)
+
+	// an interrupted ffmpeg can leave the file without its index, it closes it properly when it reads q
+	var stdin io.Writer
+	if r.opts.Tool == Ffmpeg {
+		if stdin, err = cmd.StdinPipe(); err != nil {
+			return err
+		}
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	exited := make(chan struct{})
+	j.mu.Lock()
+	j.cmd = cmd
+	j.stdin = stdin
+	j.exited = exited
+	j.mu.Unlock()
+
+	// the recording may have been finished while the process was starting
+	select {
+	case <-j.stop:
+		stopProcess(cmd.Process, stdin, exited)
+	default:
+	}
+
+	err = cmd.Wait()
+	close(exited)
+
+	j.mu.Lock()
+	j.cmd = nil
+	j.stdin = nil
+	j.exited = nil
+	j.mu.Unlock()
+
+	kept, ferr := finalize(path)
+	if ferr != nil {
+		log.Println("failed to finalize recording:", ferr)
+	}
+	if kept {
+		r.own(path)
+	}
+	return err
+}
+
+func (r *Recorder) args(videoID, out string) ([]string, error) {
+	watch := "https://www.youtube.com/watch?v=" + videoID
+
+	switch r.opts.Tool {
+	case Streamlink:
+		return []string{"--force", "--output", out, watch, r.opts.Quality}, nil
+	case YtDlp:
+		return []string{"--no-part", "--no-playlist", "-f", r.opts.Quality, "-o", out, watch}, nil
+	}
+
+	u, err := r.opts.Resolve(videoID)
+	if err != nil {
+		return nil, err
+	}
+	return []string{"-hide_banner", "-loglevel", "error", "-y", "-i", u, "-c", "copy",
+		"-f", ffmpegFormat(strings.TrimSuffix(out, partSuffix)), out}, nil
+}
+
+// prune deletes the oldest finished recordings until they're under the size limit,
+// only files in the manifest are counted or deleted so nothing else in the folder is touched
+func (r *Recorder) prune() {
+	if r.opts.MaxBytes <= 0 {
+		return
+	}
+
+	r.manifestMu.Lock()
+	defer r.manifestMu.Unlock()
+
+	type file struct {
+		name string
+		size int64
+		mod  time.Time
+	}
+
+	var total int64
+	files := make([]file, 0, len(r.owned))
+	changed := false
+	for name := range r.owned {
+		info, err := os.Stat(filepath.Join(r.opts.Dir, filepath.FromSlash(name)))
+		if errors.Is(err, os.ErrNotExist) {
+			// deleted by hand
+			delete(r.owned, name)
+			changed = true
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		total += info.Size()
+		files = append(files, file{name, info.Size(), info.ModTime()})
+	}
+
+	sort.Slice(files, func(a, b int) bool { return files[a].mod.Before(files[b].mod) })
+	for _, f := range files {
+		if total <= r.opts.MaxBytes {
+			break
+		}
+
+		path := filepath.Join(r.opts.Dir, filepath.FromSlash(f.name))
+		log.Println("recordings folder is full, deleting:", path)
+		if err := os.Remove(path); err != nil {
+			log.Println("failed to delete recording:", err)
+			continue
+		}
+		delete(r.owned, f.name)
+		changed = true
+		total -= f.size
+	}
+
+	if changed {
+		if err := r.saveManifest(); err != nil {
+			log.Println("failed to save the recordings manifest:", err)
+		}
+	}
+}
+
+// own adds a finished recording to the manifest
+func (r *Recorder) own(path string) {
+	name, err := filepath.Rel(r.opts.Dir, path)
+	if err != nil {
+		log.Println("recording is outside the recordings folder:", err)
+		return
+	}
+
+	r.manifestMu.Lock()
+	defer r.manifestMu.Unlock()
+
+	r.owned[filepath.ToSlash(name)] = true
+	if err := r.saveManifest(); err != nil {
+		log.Println("failed to save the recordings manifest:", err)
+	}
+}
+
+func (r *Recorder) loadManifest() error {
+	b, err := os.ReadFile(filepath.Join(r.opts.Dir, manifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0)
+	if err := json.Unmarshal(b, &names); err != nil {
+		return fmt.Errorf("failed to read the recordings manifest: %w", err)
+	}
+	for _, name := range names {
+		r.owned[name] = true
+	}
+	return nil
+}
+
+// saveManifest must be called with manifestMu held
+func (r *Recorder) saveManifest() error {
+	names := make([]string, 0, len(r.owned))
+	for name := range r.owned {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b, err := json.MarshalIndent(names, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// written next to the manifest and renamed so a crash can't leave it half written
+	f, err := os.CreateTemp(r.opts.Dir, manifestName+"*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(r.opts.Dir, manifestName))
+}
+
+// finish stops the recording process and waits for it to exit, the file is finalized by run
+func (j *job) finish() {
+	close(j.stop)
+
+	j.mu.Lock()
+	cmd, stdin, exited := j.cmd, j.stdin, j.exited
+	j.mu.Unlock()
+
+	if cmd != nil && cmd.Process != nil {
+		stopProcess(cmd.Process, stdin, exited)
+	}
+}
+
+// stopProcess asks the tool to exit so it can close the file cleanly, killing it if it hasn't exited in time.
+// ffmpeg is sent q on stdin, the others an interrupt or ctrl+break on windows
+func stopProcess(p *os.Process, stdin io.Writer, exited <-chan struct{}) {
+	var err error
+	if stdin != nil {
+		_, err = io.WriteString(stdin, "q")
+	} else {
+		err = interrupt(p)
+	}
+	if err != nil {
+		log.Println("failed to stop the recording cleanly, killing it:", err)
+		p.Kill()
+		return
+	}
+
+	go func() {
+		select {
+		case <-exited:
+		case <-time.After(stopTimeout):
+			log.Println("the recording didn't stop, killing it")
+			p.Kill()
+		}
+	}()
+}
+
+// finalize renames the part file to the recording name, empty files are removed.
+// it returns whether there's a recording left
+func finalize(path string) (bool, error) {
+	info, err := os.Stat(path + partSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if info.Size() == 0 {
+		return false, os.Remove(path + partSuffix)
+	}
+	if err := os.Rename(path+partSuffix, path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// partPath numbers the files of a restarted recording, the first part keeps the plain name
+func partPath(path string, part int) string {
+	if part == 0 {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%v_%d%v", strings.TrimSuffix(path, ext), part+1, ext)
+}
+
+// expand fills in the template placeholders: {channel}, {id}, {title}, {date} and {time}
+func expand(template string, s Stream, t time.Time) string {
+	r := strings.NewReplacer(
+		"{channel}", safeName(s.Channel),
+		"{id}", safeName(s.VideoID),
+		"{title}", safeName(s.Title),
+		"{date}", t.Format("2006-01-02"),
+		"{time}", t.Format("150405"),
+	)
+	return filepath.FromSlash(r.Replace(template))
+}
+
+// safeName makes text usable in a file name on every os
+func safeName(s string) string {
+	s = strings.TrimSpace(unsafeChars.ReplaceAllString(s, "_"))
+	if r := []rune(s); len(r) > 80 {
+		s = string(r[:80])
+	}
+	return strings.TrimRight(s, ". ")
+}
+
+func ffmpegFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mkv":
+		return "matroska"
+	case ".mp4":
+		return "mp4"
+	case ".flv":
+		return "flv"
+	}
+	return "mpegts"
+}
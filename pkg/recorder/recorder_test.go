@@ -0,0 +1,219 @@
+package recorder
+
+import (
+	"bufio"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the test binary stands in for the recording tool when this is set, see fakeTool
+const fakeToolEnv = "RECORDER_FAKE_TOOL"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeToolEnv) != "" {
+		os.Exit(fakeTool(os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// fakeTool writes to the output file until it's asked to stop the way the real tool would be,
+// then marks the file as finished
+func fakeTool(args []string) int {
+	out := args[len(args)-1]
+	if os.Getenv(fakeToolEnv) == Streamlink {
+		out = args[2]
+	}
+	if err := os.WriteFile(out, []byte("recording\n"), 0644); err != nil {
+		return 1
+	}
+
+	switch os.Getenv(fakeToolEnv) {
+	case Ffmpeg:
+		r := bufio.NewReader(os.Stdin)
+		for {
+			b, err := r.ReadByte()
+			if err != nil {
+				return 1
+			}
+			if b == 'q' {
+				break
+			}
+		}
+	default:
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt)
+		<-c
+	}
+
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 1
+	}
+	defer f.Close()
+	f.WriteString("finished\n")
+	return 0
+}
+
+// fakeOptions records into a temp folder with the test binary standing in for the tool
+func fakeOptions(t *testing.T, tool string) Options {
+	t.Setenv(fakeToolEnv, tool)
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Options{
+		Tool:     tool,
+		Bin:      exe,
+		Dir:      t.TempDir(),
+		Template: "{channel}/{id}.mp4",
+		Resolve:  func(videoID string) (string, error) { return "https://rr1.googlevideo.com/" + videoID, nil },
+	}
+}
+
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	for start := time.Now(); !done(); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 10*time.Second {
+			t.Fatal(what)
+		}
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestStopsGracefully(t *testing.T) {
+	for _, tool := range []string{Ffmpeg, Streamlink} {
+		t.Run(tool, func(t *testing.T) {
+			opts := fakeOptions(t, tool)
+			r, err := New(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r.Update([]Stream{{Channel: "Some Channel", VideoID: "abcdefghijk"}})
+			path := filepath.Join(opts.Dir, "Some Channel", "abcdefghijk.mp4")
+			waitFor(t, "the recording didn't start", func() bool { return exists(path + partSuffix) })
+
+			r.Close()
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != "recording\nfinished\n" {
+				t.Errorf("got %q, want the tool to have finished the file", b)
+			}
+			if !r.owned["Some Channel/abcdefghijk.mp4"] {
+				t.Errorf("got manifest %v, want the recording in it", r.owned)
+			}
+		})
+	}
+}
+
+// a channel that failed to load keeps its recording going, splitting the file would lose part of the stream
+func TestKeepRecording(t *testing.T) {
+	opts := fakeOptions(t, Streamlink)
+	r, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	r.Update([]Stream{{Channel: "doki", VideoID: "dokidokidok"}})
+	path := filepath.Join(opts.Dir, "doki", "dokidokidok.mp4")
+	waitFor(t, "the recording didn't start", func() bool { return exists(path + partSuffix) })
+
+	r.Update([]Stream{{Channel: "doki", VideoID: "dokidokidok", Keep: true}, {Channel: "mint", VideoID: "mintmintmin", Keep: true}})
+	if got := r.Active(); len(got) != 1 || got[0].VideoID != "dokidokidok" {
+		t.Errorf("got %+v, want doki still recording and mint not started", got)
+	}
+	if exists(path) {
+		t.Error("the recording was finished")
+	}
+}
+
+// finished recordings are pruned as a new one starts, not only once it's done
+func TestPruneBeforeRecording(t *testing.T) {
+	opts := fakeOptions(t, Streamlink)
+	opts.MaxBytes = 150
+	old := filepath.Join(opts.Dir, "doki", "old.mp4")
+	os.MkdirAll(filepath.Dir(old), 0755)
+	os.WriteFile(old, []byte(strings.Repeat("a", 100)), 0644)
+	mod := time.Now().Add(-time.Hour)
+	os.Chtimes(old, mod, mod)
+	os.WriteFile(filepath.Join(opts.Dir, "doki", "recent.mp4"), []byte(strings.Repeat("a", 100)), 0644)
+
+	r, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.own(old)
+	r.own(filepath.Join(opts.Dir, "doki", "recent.mp4"))
+
+	r.Update([]Stream{{Channel: "doki", VideoID: "dokidokidok"}})
+	waitFor(t, "the old recording wasn't pruned", func() bool { return !exists(old) })
+	if len(r.Active()) != 1 {
+		t.Error("the recording stopped")
+	}
+}
+
+func TestPruneOnlyOwned(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, size int, age time.Duration) string {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(strings.Repeat("a", size)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mod := time.Now().Add(-age)
+		os.Chtimes(path, mod, mod)
+		return path
+	}
+
+	r, err := New(Options{Tool: Streamlink, Dir: dir, MaxBytes: 250})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the user's own files are older and larger than any recording
+	notes := write("notes.txt", 1000, 48*time.Hour)
+	old := write("a/old.ts", 100, 3*time.Hour)
+	mid := write("a/mid.ts", 100, 2*time.Hour)
+	recent := write("b/recent.ts", 100, time.Hour)
+	live := write("b/live.ts"+partSuffix, 1000, 0)
+	for _, path := range []string{old, mid, recent} {
+		r.own(path)
+	}
+
+	r.prune()
+
+	for path, want := range map[string]bool{notes: true, old: false, mid: true, recent: true, live: true} {
+		if _, err := os.Stat(path); (err == nil) != want {
+			t.Errorf("%v: exists %v, want %v", path, err == nil, want)
+		}
+	}
+
+	// the manifest is read back by the next recorder
+	r, err = New(Options{Tool: Streamlink, Dir: dir, MaxBytes: 150})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.owned) != 2 || !r.owned["a/mid.ts"] || !r.owned["b/recent.ts"] {
+		t.Errorf("got manifest %v", r.owned)
+	}
+	r.prune()
+	if _, err := os.Stat(mid); err == nil {
+		t.Error("the oldest recording wasn't deleted")
+	}
+	if _, err := os.Stat(notes); err != nil {
+		t.Error("deleted a file the recorder didn't write")
+	}
+}
@@ -0,0 +1,108 @@
+package resolve
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/BlunterMonk/StreamNotify/pkg/player"
+)
+
+var _ player.Player = (*Player)(nil)
+var _ player.VolumeController = (*Player)(nil)
+var _ player.Seeker = (*Player)(nil)
+
+var ErrNotSupported = errors.New("the player doesn't support this")
+
+// Player plays youtube videos through a resolved stream url instead of the watch page,
+// falling back to the watch url if resolving fails
+type Player struct {
+	player   player.Player
+	resolver *Resolver
+	ladder   []string
+}
+
+// NewPlayer wraps p, ladder is the default quality ladder
+func NewPlayer(p player.Player, r *Resolver, ladder []string) *Player {
+	return &Player{player: p, resolver: r, ladder: ladder}
+}
+
+// Player returns the wrapped player
+func (p *Player) Player() player.Player {
+	return p.player
+}
+
+func (p *Player) PlayURL(url string) error {
+	return p.PlayURLQuality(url, p.ladder)
+}
+
+// PlayURLQuality plays a youtube url at the first available quality in the ladder
+func (p *Player) PlayURLQuality(url string, ladder []string) error {
+	id := player.VideoID(url)
+	if id == "" {
+		return p.player.PlayURL(url)
+	}
+
+	res, err := p.resolver.Resolve(id, ladder)
+	if err != nil {
+		log.Println("failed to resolve stream, playing the watch url:", err)
+		return p.player.PlayURL(url)
+	}
+
+	log.Printf("resolved %v at %v, expires %v\n", id, res.Quality, res.Expires.Format("15:04"))
+	return p.player.PlayURL(res.URL)
+}
+
+func (p *Player) PlayFile(path string) error {
+	return p.player.PlayFile(path)
+}
+
+func (p *Player) Stop() error {
+	return p.player.Stop()
+}
+
+// Status maps the resolved url being played back to its video
+func (p *Player) Status() (player.Status, error) {
+	s, err := p.player.Status()
+	if err != nil {
+		return s, err
+	}
+
+	if id, ok := p.resolver.VideoID(s.Input); ok {
+		s.VideoID = id
+	}
+	return s, nil
+}
+
+func (p *Player) NowPlaying() string {
+	return p.player.NowPlaying()
+}
+
+func (p *Player) SetVolume(volume int) error {
+	if v, ok := p.player.(player.VolumeController); ok {
+		return v.SetVolume(volume)
+	}
+	return fmt.Errorf("%w: volume", ErrNotSupported)
+}
+
+func (p *Player) GetVolume() (int, error) {
+	if v, ok := p.player.(player.VolumeController); ok {
+		return v.GetVolume()
+	}
+	return 0, fmt.Errorf("%w: volume", ErrNotSupported)
+}
+
+func (p *Player) Seek(seconds int) error {
+	if s, ok := p.player.(player.Seeker); ok {
+		return s.Seek(seconds)
+	}
+	return fmt.Errorf("%w: seek", ErrNotSupported)
+}
+
+func (p *Player) Close() error {
+	if c, ok := p.player.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package resolve
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	YtDlp      = "yt-dlp"
+	Streamlink = "streamlink"
+
+	DefaultTimeout = 30 * time.Second
+
+	// resolved urls without an expiry in them are kept this long
+	defaultTTL = time.Hour
+	// urls are resolved again this long before they expire so playback doesn't start on a dying url
+	expiryMargin = 5 * time.Minute
+	// how long after expiring a url can still be mapped back to its video
+	mappingTTL = 12 * time.Hour
+)
+
+var (
+	// DefaultLadder is tried in order when no qualities are given
+	DefaultLadder = []string{"1080p", "720p", "480p", "best"}
+
+	ErrNoQuality = errors.New("none of the qualities are available")
+	ErrNoTool    = errors.New("the stream resolver can't be run")
+
+	// googlevideo urls carry their expiry as a query value or a path segment in hls manifests
+	expirePathRegex = regexp.MustCompile(`/expire/(\d+)/`)
+	heightRegex     = regexp.MustCompile(`^(\d+)p`)
+)
+
+// Resolution is a direct stream url for a video
+type Resolution struct {
+	VideoID string    `json:"videoId"`
+	Quality string    `json:"quality"`
+	URL     string    `json:"url"`
+	Expires time.Time `json:"expires"`
+}
+
+// Resolver gets direct stream urls from yt-dlp or streamlink, results are cached until the url expires
+type Resolver struct {
+	Timeout time.Duration
+
+	tool string
+	bin  string
+
+	mu    sync.Mutex
+	cache map[string]Resolution // keyed by video id and quality
+	byURL map[string]Resolution
+}
+
+// New creates a resolver for the tool, "yt-dlp" or "streamlink", bin defaults to the tool name on the PATH
+func New(tool, bin string) (*Resolver, error) {
+	if tool != YtDlp && tool != Streamlink {
+		return nil, fmt.Errorf("unknown stream resolver: %v", tool)
+	}
+	if bin == "" {
+		bin = tool
+	}
+
+	return &Resolver{
+		Timeout: DefaultTimeout,
+		tool:    tool,
+		bin:     bin,
+		cache:   make(map[string]Resolution, 0),
+		byURL:   make(map[string]Resolution, 0),
+	}, nil
+}
+
+// Resolve returns a direct url for the video at the first available quality in the ladder
+func (r *Resolver) Resolve(videoID string, ladder []string) (Resolution, error) {
+	if len(ladder) == 0 {
+		ladder = DefaultLadder
+	}
+
+	var last error
+	for _, q := range ladder {
+		if res, ok := r.cached(videoID, q); ok {
+			return res, nil
+		}
+
+		u, err := r.run(videoID, q)
+		if err != nil {
+			// without the tool no quality will work
+			if errors.Is(err, ErrNoTool) {
+				return Resolution{}, err
+			}
+			last = err
+			continue
+		}
+
+		res := Resolution{
+			VideoID: videoID,
+			Quality: q,
+			URL:     u,
+			Expires: expiry(u, time.Now()),
+		}
+		r.store(res)
+		return res, nil
+	}
+
+	return Resolution{}, fmt.Errorf("%w: %v: %v", ErrNoQuality, videoID, last)
+}
+
+// VideoID returns the video a resolved url came from
+func (r *Resolver) VideoID(u string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res, ok := r.byURL[u]
+	return res.VideoID, ok
+}
+
+func (r *Resolver) cached(videoID, quality string) (Resolution, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res, ok := r.cache[videoID+"/"+quality]
+	if !ok {
+		return res, false
+	}
+	if time.Now().After(res.Expires.Add(-expiryMargin)) {
+		delete(r.cache, videoID+"/"+quality)
+		return res, false
+	}
+	return res, true
+}
+
+func (r *Resolver) store(res Resolution) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// forget expired urls so the maps don't grow forever, a url can keep playing
+	// after it expires so the mapping back to the video is kept a while longer
+	now := time.Now()
+	for k, v := range r.cache {
+		if now.After(v.Expires) {
+			delete(r.cache, k)
+		}
+	}
+	for u, v := range r.byURL {
+		if now.After(v.Expires.Add(mappingTTL)) {
+			delete(r.byURL, u)
+		}
+	}
+
+	r.cache[res.VideoID+"/"+res.Quality] = res
+	r.byURL[res.URL] = res
+}
+
+// run calls the tool for one quality, returning the first url it prints
+func (r *Resolver) run(videoID, quality string) (string, error) {
+	watch := "https://www.youtube.com/watch?v=" + videoID
+
+	var cmd *exec.Cmd
+	switch r.tool {
+	case YtDlp:
+		cmd = exec.Command(r.bin, "--no-warnings", "--no-playlist", "-g", "-f", ytDlpFormat(quality), watch)
+	case Streamlink:
+		cmd = exec.Command(r.bin, "--stream-url", watch, quality)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNoTool, err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return "", fmt.Errorf("%v %v failed: %v: %v", r.tool, quality, err, strings.TrimSpace(stderr.String()))
+		}
+	case <-time.After(r.Timeout):
+		cmd.Process.Kill()
+		return "", fmt.Errorf("%v %v timed out", r.tool, quality)
+	}
+
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "http://") || strings.HasPrefix(line, "https://") {
+			return line, nil
+		}
+	}
+
+	// streamlink prints errors to stdout with a zero exit code in some versions
+	return "", fmt.Errorf("%v %v returned no url: %v", r.tool, quality, strings.TrimSpace(stdout.String()))
+}
+
+// ytDlpFormat turns a streamlink style quality like 720p into a yt-dlp format
+func ytDlpFormat(quality string) string {
+	if m := heightRegex.FindStringSubmatch(quality); m != nil {
+		return fmt.Sprintf("best[height<=%v]", m[1])
+	}
+	return quality
+}
+
+// expiry reads the expiry out of a googlevideo url
+func expiry(u string, now time.Time) time.Time {
+	var s string
+	if m := expirePathRegex.FindStringSubmatch(u); m != nil {
+		s = m[1]
+	} else if p, err := url.Parse(u); err == nil {
+		s = p.Query().Get("expire")
+	}
+
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil && sec > 0 {
+		return time.Unix(sec, 0)
+	}
+	return now.Add(defaultTTL)
+}
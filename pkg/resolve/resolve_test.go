@@ -0,0 +1,228 @@
+package resolve
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the test binary stands in for yt-dlp and streamlink when this is set, see fakeTool
+const fakeToolEnv = "RESOLVE_FAKE_TOOL"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeToolEnv) != "" {
+		os.Exit(fakeTool(os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// fakeTool logs its arguments and prints a url for the qualities it has,
+// the quality is yt-dlp's format or streamlink's last argument
+func fakeTool(args []string) int {
+	if f, err := os.OpenFile(os.Getenv("RESOLVE_FAKE_LOG"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644); err == nil {
+		fmt.Fprintln(f, strings.Join(args, " "))
+		f.Close()
+	}
+
+	if os.Getenv(fakeToolEnv) == "hang" {
+		time.Sleep(time.Minute)
+		return 0
+	}
+
+	quality := args[len(args)-1]
+	for i, a := range args {
+		if a == "-f" {
+			quality = args[i+1]
+		}
+	}
+
+	for _, q := range strings.Split(os.Getenv("RESOLVE_FAKE_HAVE"), ",") {
+		if q == quality {
+			fmt.Println("[info] some chatter before the url")
+			fmt.Printf("https://rr1.googlevideo.com/videoplayback?expire=%v&q=%v\n", os.Getenv("RESOLVE_FAKE_EXPIRE"), quality)
+			return 0
+		}
+	}
+	fmt.Fprintln(os.Stderr, "ERROR: requested format not available")
+	return 1
+}
+
+// newFake returns a resolver running the fake tool and a func returning the calls it made
+func newFake(t *testing.T, tool, mode, have string, expire time.Time) (*Resolver, func() []string) {
+	log := filepath.Join(t.TempDir(), "calls")
+	t.Setenv(fakeToolEnv, mode)
+	t.Setenv("RESOLVE_FAKE_LOG", log)
+	t.Setenv("RESOLVE_FAKE_HAVE", have)
+	t.Setenv("RESOLVE_FAKE_EXPIRE", fmt.Sprint(expire.Unix()))
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := New(tool, exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r, func() []string {
+		b, _ := os.ReadFile(log)
+		return strings.Split(strings.TrimSpace(string(b)), "\n")
+	}
+}
+
+func TestResolveLadder(t *testing.T) {
+	expire := time.Now().Add(6 * time.Hour).Truncate(time.Second)
+
+	t.Run(YtDlp, func(t *testing.T) {
+		r, calls := newFake(t, YtDlp, "ok", "best[height<=480]", expire)
+
+		res, err := r.Resolve("abcdefghijk", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Quality != "480p" || !res.Expires.Equal(expire) {
+			t.Errorf("got %+v, want 480p expiring %v", res, expire)
+		}
+		if !strings.HasPrefix(res.URL, "https://rr1.googlevideo.com/") {
+			t.Errorf("got url %v", res.URL)
+		}
+
+		got := calls()
+		if len(got) != 3 {
+			t.Fatalf("got calls %q, want 1080p, 720p then 480p", got)
+		}
+		want := "--no-warnings --no-playlist -g -f best[height<=1080] https://www.youtube.com/watch?v=abcdefghijk"
+		if got[0] != want {
+			t.Errorf("got %q, want %q", got[0], want)
+		}
+	})
+
+	t.Run(Streamlink, func(t *testing.T) {
+		r, calls := newFake(t, Streamlink, "ok", "best", expire)
+
+		res, err := r.Resolve("abcdefghijk", []string{"720p", "best"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Quality != "best" {
+			t.Errorf("got %v, want best", res.Quality)
+		}
+		if got := calls(); len(got) != 2 || got[0] != "--stream-url https://www.youtube.com/watch?v=abcdefghijk 720p" {
+			t.Errorf("got calls %q", got)
+		}
+	})
+}
+
+func TestResolveNoQuality(t *testing.T) {
+	r, calls := newFake(t, YtDlp, "ok", "", time.Now().Add(time.Hour))
+
+	_, err := r.Resolve("abcdefghijk", []string{"720p", "best"})
+	if !errors.Is(err, ErrNoQuality) || !strings.Contains(err.Error(), "not available") {
+		t.Errorf("got %v, want no quality with the tool's error", err)
+	}
+	if got := calls(); len(got) != 2 {
+		t.Errorf("got calls %q, want every quality tried", got)
+	}
+}
+
+func TestResolveNoTool(t *testing.T) {
+	r, err := New(YtDlp, filepath.Join(t.TempDir(), "missing-yt-dlp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.Resolve("abcdefghijk", nil)
+	if !errors.Is(err, ErrNoTool) || errors.Is(err, ErrNoQuality) {
+		t.Errorf("got %v, want no tool without trying the rest of the ladder", err)
+	}
+
+	if _, err := New("vlc", ""); err == nil {
+		t.Error("created a resolver for an unknown tool")
+	}
+}
+
+func TestResolveTimeout(t *testing.T) {
+	r, calls := newFake(t, YtDlp, "hang", "", time.Now())
+	r.Timeout = 200 * time.Millisecond
+
+	start := time.Now()
+	_, err := r.Resolve("abcdefghijk", []string{"720p"})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("got %v, want timed out", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("took %v, the tool wasn't killed", d)
+	}
+	if got := calls(); len(got) != 1 {
+		t.Errorf("got calls %q", got)
+	}
+}
+
+func TestResolveCache(t *testing.T) {
+	r, calls := newFake(t, YtDlp, "ok", "best[height<=720]", time.Now().Add(6*time.Hour))
+
+	first, err := r.Resolve("abcdefghijk", []string{"720p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := r.Resolve("abcdefghijk", []string{"720p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second || len(calls()) != 1 {
+		t.Errorf("resolved again with a cached url, calls %q", calls())
+	}
+
+	if id, ok := r.VideoID(first.URL); !ok || id != "abcdefghijk" {
+		t.Errorf("got %v %v, want the url mapped to its video", id, ok)
+	}
+	if _, ok := r.VideoID("https://www.youtube.com/watch?v=abcdefghijk"); ok {
+		t.Error("mapped a url that wasn't resolved")
+	}
+
+	// a url this close to expiring is resolved again
+	t.Setenv("RESOLVE_FAKE_EXPIRE", fmt.Sprint(time.Now().Add(expiryMargin/2).Unix()))
+	r.Resolve("zyxwvutsrqp", []string{"720p"})
+	r.Resolve("zyxwvutsrqp", []string{"720p"})
+	if got := calls(); len(got) != 3 {
+		t.Errorf("got calls %q, want the expiring url resolved twice", got)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		url  string
+		want time.Time
+	}{
+		{"https://rr1.googlevideo.com/videoplayback?expire=1792411200&itag=22", time.Unix(1792411200, 0)},
+		{"https://manifest.googlevideo.com/api/manifest/hls_playlist/expire/1792411200/ei/abc/index.m3u8", time.Unix(1792411200, 0)},
+		{"https://rr1.googlevideo.com/videoplayback?itag=22", now.Add(defaultTTL)},
+		{"https://rr1.googlevideo.com/videoplayback?expire=soon", now.Add(defaultTTL)},
+		{"https://rr1.googlevideo.com/videoplayback?expire=0", now.Add(defaultTTL)},
+	}
+	for _, tt := range tests {
+		if got := expiry(tt.url, now); !got.Equal(tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestYtDlpFormat(t *testing.T) {
+	tests := map[string]string{
+		"1080p":  "best[height<=1080]",
+		"720p60": "best[height<=720]",
+		"best":   "best",
+		"worst":  "worst",
+	}
+	for q, want := range tests {
+		if got := ytDlpFormat(q); got != want {
+			t.Errorf("%v: got %v, want %v", q, got, want)
+		}
+	}
+}
@@ -0,0 +1,562 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BlunterMonk/StreamNotify/pkg/chatwatch"
+	"github.com/BlunterMonk/StreamNotify/pkg/config"
+	"github.com/BlunterMonk/StreamNotify/pkg/filter"
+	"github.com/BlunterMonk/StreamNotify/pkg/multiview"
+	"github.com/BlunterMonk/StreamNotify/pkg/player"
+	"github.com/BlunterMonk/StreamNotify/pkg/priority"
+	"github.com/BlunterMonk/StreamNotify/pkg/queue"
+	"github.com/BlunterMonk/StreamNotify/pkg/recorder"
+	yt "github.com/BlunterMonk/StreamNotify/pkg/youtube"
+)
+
+// QualityPlayer is a player that can pick the stream quality, like one using a stream resolver
+type QualityPlayer interface {
+	PlayURLQuality(url string, ladder []string) error
+}
+
+// AmbienceSource is a player with its own media library, like kodi, where the music dir lives
+type AmbienceSource interface {
+	RandomFile(dir string) (string, error)
+}
+
+// checkAmbience plays the highest priority live stream, or a random one, or ambience if nothing is live
+func (e *Engine) checkAmbience() {
+	e.wanted = false
+	e.autoplay()
+
+	// a switch that stopped being wanted starts its grace period over next time
+	if !e.wanted {
+		e.pending = ""
+	}
+}
+
+func (e *Engine) autoplay() {
+	plan := priority.Current(e.clock.Now())
+	current := e.store.Get()
+	on := current.State.Active()
+	np := current.Input
+
+	// if a video is playing, find out what video
+	if on {
+		log.Printf("Now Playing (%v): %v\n", e.origin, np)
+
+		// reset sleep timer if a new video starts playing after quiet hours were triggered,
+		// nothing autoplays during quiet hours so it was played manually when staying up later than normal
+		if e.sleeping {
+			e.sleeping = false
+			return
+		}
+	}
+
+	e.applyVolumeSchedule()
+
+	// Do not attempt to play anything during quiet hours
+	if e.quietHours() {
+		return
+	}
+
+	// with several priority streams live at once, show them side by side
+	if e.mv != nil {
+		if e.updateMultiview(current, plan) {
+			return
+		}
+	}
+
+	// a stream started from the queue isn't replaced by a higher priority one, that waits in the queue instead
+	if qc := e.streams.Current(); qc.VideoID != "" && qc.VideoID == e.queued && qc.VideoID == current.VideoID && e.isLive(qc) {
+		log.Println("playing queued stream:", qc.Channel, qc.Title)
+		e.enqueueLive(plan, qc.VideoID)
+		return
+	}
+
+	log.Println("attempting to play priority live stream")
+
+	// the highest tier with a live stream wins, see the explain command
+	if c, ok := plan.Choose(priority.Candidates(e.streamInfo), e.playingChannel(current), e.rand); ok {
+		// don't try to play the same video
+		if strings.Contains(current.VideoID, c.VideoID) {
+			log.Println("video already playing:", c.VideoID)
+			e.enqueueLive(plan, c.VideoID)
+			return
+		}
+
+		if on && !e.canPreempt(current, plan, plan.Tier(c.Channel)) {
+			log.Printf("not replacing %v playback with %v (preempt: %q)\n", e.origin, c.Channel, config.Get().Preempt.Manual)
+			return
+		}
+		if on && !e.settled(c.VideoID) {
+			return
+		}
+
+		log.Printf("autoplaying %v: %v\n", c.Channel, c.Reason)
+		e.rememberAmbience(current)
+		e.playYoutubeVideo(c.Channel, c.VideoID)
+		e.streams.SetCurrent(queueEntry(c.Channel, e.streamInfo[c.Channel]))
+		e.enqueueLive(plan, c.VideoID)
+		return
+	}
+
+	log.Println("no priority streams available, attempting to play a low priority stream")
+
+	// a live stream that's playing is kept, anything else can make way for a random live stream
+	live := e.playingChannel(current) != ""
+	if on && !e.canPreempt(current, plan, -1) {
+		log.Printf("not replacing %v playback (preempt: %q)\n", e.origin, config.Get().Preempt.Manual)
+		return
+	}
+
+	if !on || !live {
+		// if no one on the priority list is streaming
+		// just play the first live channel found
+		// by randomizing the order of low priority channels registered
+		name, vid := e.selectRandomLiveStream(plan)
+		if config.Get().RandomizeStreams && vid.VideoDetails.VideoID != "" {
+			if on && !e.settled(vid.VideoDetails.VideoID) {
+				return
+			}
+			e.rememberAmbience(current)
+			e.playYoutubeVideo(name, vid.VideoDetails.VideoID)
+			return
+		}
+
+		log.Println("no live streams, playing ambient music")
+
+		// If no streams were found just play some BGM
+		if !on && !e.resumeAmbience() {
+			if _, err := e.playAmbienceMV(config.Get().MusicDir); err != nil {
+				log.Println(err.Error())
+			}
+		}
+	} else {
+		log.Println("nothing to play.")
+	}
+}
+
+// quietHours reports if the clock is inside the configured quiet hours
+func (e *Engine) quietHours() bool {
+	cfg := config.Get()
+	return InHours(e.clock.Now(), cfg.QuietStartTime, cfg.QuietEndTime)
+}
+
+// InHours reports if now is between the start and end times, given as "15:04"
+func InHours(now time.Time, s, e string) bool {
+	yyyy, mm, dd := now.Date()
+	now = time.Date(yyyy, mm, dd, now.Hour(), now.Minute(), now.Second(), 0, time.UTC)
+
+	qs, err := time.ParseInLocation("2006-01-02T15:04:05", fmt.Sprintf("%d-%02d-%02dT%s:00", yyyy, mm, dd, s), time.UTC)
+	if err != nil {
+		log.Println("invalid start time:", err)
+	}
+	qe, err := time.ParseInLocation("2006-01-02T15:04:05", fmt.Sprintf("%d-%02d-%02dT%s:00", yyyy, mm, dd, e), time.UTC)
+	if err != nil {
+		log.Println("invalid end time:", err)
+	}
+	if qs.Before(qe) {
+		return qs.Before(now) && qe.After(now)
+	}
+
+	return qe.Before(now) && qs.After(now)
+}
+
+func (e *Engine) multiviewActive() bool {
+	return e.mv != nil && e.mv.Active()
+}
+
+func (e *Engine) stopPlayback() {
+	log.Println("Stop Playback")
+
+	if err := e.client.Stop(); err != nil {
+		log.Printf("Error stopping playback: %v\n", err)
+	}
+}
+
+func (e *Engine) playYoutubeVideo(channel, videoID string) {
+	log.Println("Play Youtube Video:", videoID)
+
+	youtubeURL := fmt.Sprintf("https://www.youtube.com/watch?v=%s", videoID)
+	e.lastSwitch = e.clock.Now()
+	e.queued = ""
+	e.started(youtubeURL)
+	err := player.FadeSwitch(e.client, e.volumeTarget(liveVolume(channel)), fadeDuration(), e.clock.Sleep, func() error {
+		if q, ok := e.client.(QualityPlayer); ok {
+			return q.PlayURLQuality(youtubeURL, qualityLadder(channel))
+		}
+		return e.client.PlayURL(youtubeURL)
+	})
+	if err != nil {
+		log.Println("failed to play video:", err)
+		return
+	}
+
+	log.Println("Player is streaming the video.")
+}
+
+func (e *Engine) playAmbienceMV(dir string) (string, error) {
+	var videoPath string
+	var err error
+
+	if src, ok := e.client.(AmbienceSource); ok {
+		videoPath, err = src.RandomFile(dir)
+	} else {
+		videoPath, err = e.loadRandomLocalVideo(dir)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	log.Println("Playing Ambience MV:", videoPath)
+	e.started(videoPath)
+	err = player.FadeSwitch(e.client, e.volumeTarget(config.Get().Volume.Ambience), fadeDuration(), e.clock.Sleep, func() error {
+		return e.client.PlayFile(videoPath)
+	})
+	if err != nil {
+		return "", err
+	}
+	return videoPath, nil
+}
+
+func (e *Engine) loadRandomLocalVideo(dir string) (string, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no videos in %v", dir)
+	}
+
+	n := e.rand.Intn(len(files))
+	videoPath := strings.ReplaceAll(fmt.Sprintf("%s/%s", dir, files[n].Name()), "/", "\\")
+	log.Println("random video chosen:", n, videoPath)
+	return videoPath, nil
+}
+
+// selectRandomLiveStream picks any live stream that's allowed to autoplay
+func (e *Engine) selectRandomLiveStream(plan priority.Plan) (string, yt.VideoDetails) {
+	keys := make([]string, 0, len(e.streamInfo))
+	for k := range e.streamInfo {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, i := range e.rand.Perm(len(keys)) {
+		k := keys[i]
+		v := e.streamInfo[k]
+		if !v.VideoDetails.IsLive || plan.Never(k) || !filter.Allowed(k, v.VideoDetails.Title, filter.AutoPlay) {
+			continue
+		}
+
+		return k, v
+	}
+
+	return "", yt.VideoDetails{}
+}
+
+// enqueueLive queues every live priority stream that's allowed to autoplay, except the one playing
+func (e *Engine) enqueueLive(plan priority.Plan, playing string) {
+	for _, name := range plan.Ranked(priority.Candidates(e.streamInfo)) {
+		v := e.streamInfo[name]
+		if v.VideoDetails.VideoID == playing {
+			continue
+		}
+
+		if e.streams.Push(queueEntry(name, v)) {
+			log.Println("queued live stream:", name, v.VideoDetails.Title)
+		}
+	}
+}
+
+// playingChannel returns the channel whose live stream is playing, empty if it isn't one of theirs
+func (e *Engine) playingChannel(current player.Status) string {
+	if current.VideoID == "" {
+		return ""
+	}
+	for name, v := range e.streamInfo {
+		if v.VideoDetails.IsLive && v.VideoDetails.VideoID == current.VideoID {
+			return name
+		}
+	}
+	return ""
+}
+
+// updateMultiview puts the top live priority streams in the multiview windows,
+// returning false if fewer than two are live and the main player should be used instead
+func (e *Engine) updateMultiview(current player.Status, plan priority.Plan) bool {
+	live := plan.Ranked(priority.Candidates(e.streamInfo))
+	if len(live) < 2 {
+		if e.mv.Active() {
+			log.Println("fewer than two priority streams live, closing multiview")
+			if err := e.mv.Stop(); err != nil {
+				log.Println("failed to close multiview:", err)
+			}
+		}
+		return false
+	}
+
+	// the main player makes way for the multiview windows
+	if current.State.Active() {
+		if !e.canPreempt(current, plan, plan.Tier(live[0])) {
+			log.Printf("not replacing %v playback with multiview (preempt: %q)\n", e.origin, config.Get().Preempt.Manual)
+			return true
+		}
+		if !e.settled("multiview") {
+			return true
+		}
+
+		e.rememberAmbience(current)
+		e.lastSwitch = e.clock.Now()
+		e.stopPlayback()
+	}
+
+	list := make([]multiview.Stream, 0, len(live))
+	for _, name := range live {
+		vid := e.streamInfo[name].VideoDetails.VideoID
+		list = append(list, multiview.Stream{
+			Channel: name,
+			VideoID: vid,
+			URL:     fmt.Sprintf("https://www.youtube.com/watch?v=%s", vid),
+		})
+	}
+	if len(list) > e.mv.Windows() {
+		list = list[:e.mv.Windows()]
+	}
+
+	// the focused window plays at the live volume of the top channel
+	if v := liveVolume(list[0].Channel); v > 0 {
+		e.mv.SetVolume(e.eveningVolume(v))
+	} else {
+		e.mv.SetVolume(e.eveningVolume(100))
+	}
+	if err := e.mv.Assign(list); err != nil {
+		log.Println("multiview error:", err)
+	}
+	return true
+}
+
+// playNext plays the first queued stream that's still live, returning false if there wasn't one
+func (e *Engine) playNext() bool {
+	for {
+		q, ok := e.streams.Next()
+		if !ok {
+			return false
+		}
+		if !e.isLive(q) {
+			log.Println("queued stream ended:", q.Channel, q.Title)
+			continue
+		}
+
+		e.playYoutubeVideo(q.Channel, q.VideoID)
+		e.queued = q.VideoID
+		return true
+	}
+}
+
+func queueEntry(channel string, v yt.VideoDetails) queue.Entry {
+	return queue.Entry{Channel: channel, VideoID: v.VideoDetails.VideoID, Title: v.VideoDetails.Title}
+}
+
+// isLive reports if the queued stream is still the channel's current live stream.
+// A channel that couldn't be checked keeps its stream, it was live at the last check or it'd be gone from the queue
+func (e *Engine) isLive(q queue.Entry) bool {
+	v := e.streamInfo[q.Channel]
+	return (v.VideoDetails.IsLive || v.Stale) && v.VideoDetails.VideoID == q.VideoID
+}
+
+// rememberAmbience saves the ambience that's playing so it can be resumed after a live stream
+func (e *Engine) rememberAmbience(current player.Status) {
+	if !config.Get().ResumeAmbience || !current.State.Active() {
+		return
+	}
+	if current.Input == "" || current.VideoID != "" || strings.HasPrefix(current.Input, "http") {
+		return
+	}
+
+	log.Printf("interrupting ambience at %vs: %v\n", int(current.Time), current.Input)
+	e.interrupted = &current
+}
+
+// resumeAmbience plays the interrupted ambience from where it stopped, minus the rewind,
+// returning false if there was nothing to resume
+func (e *Engine) resumeAmbience() bool {
+	if e.interrupted == nil || !config.Get().ResumeAmbience {
+		return false
+	}
+
+	s := *e.interrupted
+	e.interrupted = nil
+
+	pos := int(s.Time) - config.Get().ResumeRewind
+	log.Printf("resuming ambience at %vs: %v\n", pos, s.Input)
+	e.started(s.Input)
+	err := player.FadeSwitch(e.client, e.volumeTarget(config.Get().Volume.Ambience), fadeDuration(), e.clock.Sleep, func() error {
+		if err := e.client.PlayFile(s.Input); err != nil {
+			return err
+		}
+		return e.seekWhenPlaying(pos)
+	})
+	if err != nil {
+		log.Println("failed to resume ambience:", err)
+		return false
+	}
+	return true
+}
+
+// seekWhenPlaying waits for the player to open the video before seeking, seeks sent while it's opening are lost
+func (e *Engine) seekWhenPlaying(seconds int) error {
+	sk, ok := e.client.(player.Seeker)
+	if !ok || seconds <= 0 {
+		return nil
+	}
+
+	for i := 0; i < 20; i++ {
+		s, err := e.client.Status()
+		if err == nil && s.State == player.StatePlaying && s.Length > 0 {
+			return sk.Seek(seconds)
+		}
+		e.clock.Sleep(250 * time.Millisecond)
+	}
+
+	return errors.New("timed out waiting for the video to open")
+}
+
+// liveVolume returns the volume profile for a channel's live streams
+func liveVolume(channel string) int {
+	vc := config.Get().Volume
+	if v, ok := vc.Channels[channel]; ok {
+		return v
+	}
+	return vc.Live
+}
+
+// volumeTarget returns the volume to fade in to after a switch,
+// the current volume is kept if the profile isn't set
+func (e *Engine) volumeTarget(profile int) func(current int) int {
+	return func(current int) int {
+		v := current
+		if profile > 0 {
+			v = profile
+		}
+		return e.eveningVolume(v)
+	}
+}
+
+// eveningVolume caps the volume during the evening hours
+func (e *Engine) eveningVolume(v int) int {
+	vc := config.Get().Volume
+	if vc.Evening <= 0 || vc.EveningStart == "" || vc.EveningEnd == "" {
+		return v
+	}
+	if v > vc.Evening && InHours(e.clock.Now(), vc.EveningStart, vc.EveningEnd) {
+		return vc.Evening
+	}
+	return v
+}
+
+func fadeDuration() time.Duration {
+	return time.Duration(config.Get().Volume.Fade) * time.Second
+}
+
+// applyVolumeSchedule fades down to the evening volume if whatever is playing is louder
+func (e *Engine) applyVolumeSchedule() {
+	v, ok := e.client.(player.VolumeController)
+	if !ok || e.client.NowPlaying() == "" {
+		return
+	}
+
+	current, err := v.GetVolume()
+	if err != nil {
+		log.Println("failed to get volume:", err)
+		return
+	}
+
+	if target := e.eveningVolume(current); target < current {
+		log.Println("evening hours, lowering volume to", target)
+		if err := player.Fade(v, target, fadeDuration(), e.clock.Sleep); err != nil {
+			log.Println("failed to lower volume:", err)
+		}
+	}
+}
+
+// qualityLadder returns the stream qualities to try for a channel
+func qualityLadder(channel string) []string {
+	rc := config.Get().Resolver
+	if q, ok := rc.Channels[channel]; ok && len(q) > 0 {
+		return q
+	}
+	return rc.Quality
+}
+
+// ChatRules returns the chat rules from the config
+func ChatRules() chatwatch.Rules {
+	c := config.Get().Chat
+	return chatwatch.Rules{
+		Keywords:   c.Keywords,
+		Owner:      c.Owner,
+		Moderators: c.Moderators,
+		Users:      c.Users,
+	}
+}
+
+// watchChat watches the chat of the stream that's playing, the multiview streams,
+// and every live priority stream if the config asks for it
+func (e *Engine) watchChat(current player.Status) {
+	if e.chat == nil {
+		return
+	}
+	if ChatRules().Empty() {
+		e.chat.Update(nil)
+		return
+	}
+
+	watched := make(map[string]bool, 0)
+	if current.State.Active() && current.VideoID != "" {
+		watched[current.VideoID] = true
+	}
+	if e.mv != nil {
+		for _, s := range e.mv.Streams() {
+			watched[s.VideoID] = true
+		}
+	}
+	if config.Get().Chat.AllPriority {
+		for _, name := range priority.Current(e.clock.Now()).Channels() {
+			watched[e.streamInfo[name].VideoDetails.VideoID] = true
+		}
+	}
+
+	list := make([]chatwatch.Stream, 0)
+	for name, v := range e.streamInfo {
+		if v.VideoDetails.IsLive && watched[v.VideoDetails.VideoID] {
+			list = append(list, chatwatch.Stream{Channel: name, VideoID: v.VideoDetails.VideoID})
+		}
+	}
+	e.chat.Update(list)
+}
+
+// recordable returns the live streams of the channels set to be recorded,
+// a channel that couldn't be checked keeps recording the stream it had
+func recordable(streamInfo map[string]yt.VideoDetails) []recorder.Stream {
+	list := make([]recorder.Stream, 0)
+	for _, name := range config.Get().Recorder.Channels {
+		v := streamInfo[name]
+		if !(v.VideoDetails.IsLive || v.Stale) || filter.Ignored(name, v.VideoDetails.Title) {
+			continue
+		}
+		list = append(list, recorder.Stream{
+			Channel: name,
+			VideoID: v.VideoDetails.VideoID,
+			Title:   v.VideoDetails.Title,
+			Keep:    v.Stale,
+		})
+	}
+	return list
+}
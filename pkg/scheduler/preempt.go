@@ -0,0 +1,147 @@
+package scheduler
+
+import (
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/BlunterMonk/StreamNotify/pkg/config"
+	"github.com/BlunterMonk/StreamNotify/pkg/player"
+	"github.com/BlunterMonk/StreamNotify/pkg/priority"
+)
+
+// Origin is who started what's playing
+type Origin int
+
+const (
+	OriginNone Origin = iota
+	OriginAuto
+	OriginManual
+)
+
+const defaultIdleMinutes = 60
+
+func (o Origin) String() string {
+	switch o {
+	case OriginNone:
+		return "nothing"
+	case OriginAuto:
+		return "autoplay"
+	case OriginManual:
+		return "manual"
+	}
+	return "unknown"
+}
+
+// Origin returns who started what's playing
+func (e *Engine) Origin() Origin {
+	return e.origin
+}
+
+// started records what the engine is about to play, so the player picking it up isn't mistaken for the user
+func (e *Engine) started(input string) {
+	e.expect = input
+	e.origin = OriginAuto
+}
+
+// classify works out who started the new input. Anything the engine didn't ask for is the user's,
+// unless it shows up right after a switch, since some players report a different input than they were given.
+func (e *Engine) classify(s player.Status) {
+	if e.expect != "" && sameInput(s, e.expect) || e.clock.Now().Sub(e.lastSwitch) <= switchGrace {
+		e.origin = OriginAuto
+		return
+	}
+
+	if e.origin != OriginManual {
+		log.Println("playback started by hand:", s.Input)
+	}
+	e.origin = OriginManual
+	e.lastActivity = e.clock.Now()
+}
+
+// sameInput reports if the player status is playing the input, youtube videos are compared by id
+func sameInput(s player.Status, input string) bool {
+	if id := player.VideoID(input); id != "" {
+		return s.VideoID == id
+	}
+
+	a, b := normPath(s.Input), normPath(input)
+	if a == "" || b == "" {
+		return false
+	}
+	return a == b || strings.HasSuffix(a, b) || strings.HasSuffix(b, a)
+}
+
+// normPath strips the differences players add to file paths, like file:// urls and escaping
+func normPath(p string) string {
+	if u, err := url.PathUnescape(p); err == nil {
+		p = u
+	}
+	p = strings.ToLower(strings.ReplaceAll(p, "\\", "/"))
+	p = strings.TrimPrefix(p, "file://")
+	return strings.TrimLeft(p, "/")
+}
+
+// canPreempt reports if the preempt policy lets autoplay replace what's playing with a stream in the given tier,
+// -1 for a stream that isn't in a tier
+func (e *Engine) canPreempt(current player.Status, plan priority.Plan, tier int) bool {
+	if e.origin != OriginManual || !current.State.Active() {
+		return true
+	}
+
+	pc := config.Get().Preempt
+	switch strings.ToLower(pc.Manual) {
+	case "always":
+		return true
+	case "higher":
+		if tier < 0 {
+			return false
+		}
+		cur := -1
+		if ch := e.playingChannel(current); ch != "" {
+			cur = plan.Tier(ch)
+		}
+		return cur < 0 || tier < cur
+	case "idle":
+		if e.store.Screensaver() {
+			return true
+		}
+		idle := time.Duration(pc.IdleMinutes) * time.Minute
+		if pc.IdleMinutes <= 0 {
+			idle = defaultIdleMinutes * time.Minute
+		}
+		return e.clock.Now().Sub(e.lastActivity) >= idle
+	}
+	return false
+}
+
+// settled reports if the engine has wanted to switch to target for the whole grace period,
+// the ambience check is brought forward so the switch happens as the grace period ends
+func (e *Engine) settled(target string) bool {
+	e.wanted = true
+
+	grace := time.Duration(config.Get().Preempt.Grace) * time.Second
+	if grace <= 0 {
+		return true
+	}
+
+	now := e.clock.Now()
+	if e.pending != target {
+		log.Printf("switching to %v in %v unless something changes\n", target, grace)
+		e.pending = target
+		e.pendingSince = now
+		e.wake(now.Add(grace))
+		return false
+	}
+	return now.Sub(e.pendingSince) >= grace
+}
+
+// wake runs the ambience check at t if it isn't due before then
+func (e *Engine) wake(t time.Time) {
+	for _, task := range e.tasks {
+		if task.name == "ambience" && t.Before(task.next) {
+			task.next = t
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/BlunterMonk/StreamNotify/pkg/config"
+	"github.com/BlunterMonk/StreamNotify/pkg/player"
+	"github.com/BlunterMonk/StreamNotify/pkg/priority"
+	yt "github.com/BlunterMonk/StreamNotify/pkg/youtube"
+)
+
+// doki is in the top tier, mint and nene share the second, koko isn't in one
+var preemptTiers = config.PriorityConfig{Tiers: []config.TierConfig{
+	{Channels: []string{"doki"}},
+	{Channels: []string{"mint", "nene"}},
+}}
+
+const preemptTiersJSON = `"priorityRules": {"tiers": [{"channels": ["doki"]}, {"channels": ["mint", "nene"]}]}`
+
+func TestCanPreempt(t *testing.T) {
+	file := player.Status{State: player.StatePlaying, Input: "E:/videos/mine.mp4"}
+	mint := player.Status{State: player.StatePlaying, Input: watch("mintmintmin"), VideoID: "mintmintmin"}
+	koko := player.Status{State: player.StatePlaying, Input: watch("kokokokokok"), VideoID: "kokokokokok"}
+
+	tests := []struct {
+		name        string
+		manual      string
+		idleMinutes int
+		origin      Origin
+		current     player.Status
+		idle        time.Duration // since the user last did something
+		screensaver bool
+		tier        int
+		want        bool
+	}{
+		{"autoplayed", "never", 0, OriginAuto, file, 0, false, 0, true},
+		{"nothing playing", "never", 0, OriginManual, player.Status{}, 0, false, 0, true},
+		{"never", "never", 0, OriginManual, file, 24 * time.Hour, true, 0, false},
+		{"unset is never", "", 0, OriginManual, file, 24 * time.Hour, true, 0, false},
+		{"always", "always", 0, OriginManual, file, 0, false, -1, true},
+		{"always any case", "Always", 0, OriginManual, file, 0, false, -1, true},
+		{"higher over a file", "higher", 0, OriginManual, file, 0, false, 1, true},
+		{"higher untiered over a file", "higher", 0, OriginManual, file, 0, false, -1, false},
+		{"higher over a lower tier", "higher", 0, OriginManual, mint, 0, false, 0, true},
+		{"higher over the same tier", "higher", 0, OriginManual, mint, 0, false, 1, false},
+		{"higher over an untiered stream", "higher", 0, OriginManual, koko, 0, false, 1, true},
+		{"idle default not yet", "idle", 0, OriginManual, file, 59 * time.Minute, false, 0, false},
+		{"idle default", "idle", 0, OriginManual, file, time.Hour, false, 0, true},
+		{"idle minutes not yet", "idle", 5, OriginManual, file, 4 * time.Minute, false, 0, false},
+		{"idle minutes", "idle", 5, OriginManual, file, 5 * time.Minute, false, 0, true},
+		{"idle screensaver", "idle", 5, OriginManual, file, 0, true, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useConfig(t, fmt.Sprintf(`{"preempt": {"manual": %q, "idleMinutes": %d}}`, tt.manual, tt.idleMinutes))
+			e, _, _ := newEngine(&fakePlayer{}, nil)
+			e.streamInfo = map[string]yt.VideoDetails{"mint": liveStream("mintmintmin"), "koko": liveStream("kokokokokok")}
+			e.origin = tt.origin
+			e.lastActivity = start.Add(-tt.idle)
+			e.store.SetScreensaver(tt.screensaver)
+
+			plan := priority.NewPlan(preemptTiers, "", start)
+			if got := e.canPreempt(tt.current, plan, tt.tier); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name       string
+		expect     string
+		sinceStart time.Duration // since a live stream was last started
+		status     player.Status
+		want       Origin
+	}{
+		{"nothing asked for", "", time.Hour, player.Status{Input: "E:/videos/mine.mp4"}, OriginManual},
+		{"asked for", "E:/bgm/song.mp4", time.Hour, player.Status{Input: "E:/bgm/song.mp4"}, OriginAuto},
+		{"reported as a url", `E:\bgm\my song.mp4`, time.Hour, player.Status{Input: "file:///e:/bgm/my%20song.mp4"}, OriginAuto},
+		{"video by id", watch("dokidokidok"), time.Hour, player.Status{Input: "https://rr1.googlevideo.com/videoplayback", VideoID: "dokidokidok"}, OriginAuto},
+		{"another video", watch("dokidokidok"), time.Hour, player.Status{Input: watch("mintmintmin"), VideoID: "mintmintmin"}, OriginManual},
+		{"during the switch", watch("dokidokidok"), switchGrace, player.Status{Input: "E:/videos/mine.mp4"}, OriginAuto},
+		{"after the switch", watch("dokidokidok"), switchGrace + time.Second, player.Status{Input: "E:/videos/mine.mp4"}, OriginManual},
+	}
+
+	for _, tt := range tests {
+		e, clock, _ := newEngine(&fakePlayer{}, nil)
+		clock.Set(start.Add(time.Hour))
+		e.expect = tt.expect
+		e.lastSwitch = clock.Now().Add(-tt.sinceStart)
+
+		e.classify(tt.status)
+		if e.origin != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.name, e.origin, tt.want)
+		}
+		// only the user's changes count as activity
+		if active := e.lastActivity.Equal(clock.Now()); active != (tt.want == OriginManual) {
+			t.Errorf("%v: got last activity %v", tt.name, e.lastActivity)
+		}
+	}
+}
+
+func TestSettled(t *testing.T) {
+	type call struct {
+		at     time.Duration
+		target string
+		want   bool
+	}
+	tests := []struct {
+		name  string
+		grace int
+		calls []call
+	}{
+		{"no grace", 0, []call{{0, "doki", true}}},
+		{"grace boundary", 30, []call{{0, "doki", false}, {29 * time.Second, "doki", false}, {30 * time.Second, "doki", true}}},
+		{"new target starts over", 30, []call{{0, "doki", false}, {20 * time.Second, "mint", false}, {40 * time.Second, "mint", false}, {50 * time.Second, "mint", true}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useConfig(t, fmt.Sprintf(`{"ambienceTimer": 1, "preempt": {"grace": %d}}`, tt.grace))
+			e, clock, _ := newEngine(&fakePlayer{}, nil)
+
+			for _, c := range tt.calls {
+				clock.Set(start.Add(c.at))
+				if got := e.settled(c.target); got != c.want {
+					t.Errorf("%v at %v: got %v, want %v", c.target, c.at, got, c.want)
+				}
+			}
+			if !e.wanted {
+				t.Error("the switch wasn't marked as wanted")
+			}
+
+			// the ambience check is brought forward to the end of the grace period
+			due := e.pendingSince.Add(time.Duration(tt.grace) * time.Second)
+			if ambience := e.tasks[3]; tt.grace > 0 && ambience.next.After(due) {
+				t.Errorf("got the next ambience check at %v, want by %v", ambience.next, due)
+			}
+		})
+	}
+}
+
+// manualEngine starts an engine with the user already watching what playing is
+func manualEngine(t *testing.T, cfg string, playing player.Status, live map[string]yt.VideoDetails) (*Engine, *ManualClock, *fakePlayer) {
+	t.Helper()
+	useConfig(t, cfg)
+	p := &fakePlayer{status: playing}
+	e, clock, _ := newEngine(p, live)
+
+	e.Step()
+	if e.Origin() != OriginManual {
+		t.Fatalf("got %v, want the video the user started to be manual", e.Origin())
+	}
+	return e, clock, p
+}
+
+func TestPreemptPolicies(t *testing.T) {
+	tests := []struct {
+		manual string
+		want   bool
+	}{
+		{"never", false},
+		{"higher", true},
+		{"idle", false},
+		{"always", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.manual, func(t *testing.T) {
+			cfg := fmt.Sprintf(`{"liveTimer": 1, "quietTimer": 2, "ambienceTimer": 1, "quietStartTime": "03:00", "quietEndTime": "08:00",
+				%v, "preempt": {"manual": %q}}`, preemptTiersJSON, tt.manual)
+			file := player.Status{State: player.StatePlaying, Input: "E:/videos/mine.mp4"}
+			e, clock, p := manualEngine(t, cfg, file, map[string]yt.VideoDetails{"doki": liveStream("dokidokidok")})
+
+			stepUntil(e, clock, start.Add(5*time.Minute))
+			if got := len(p.played) == 1 && p.played[0] == watch("dokidokidok"); got != tt.want {
+				t.Errorf("got %v, want replaced %v", p.played, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreemptIdle(t *testing.T) {
+	cfg := fmt.Sprintf(`{"liveTimer": 1, "quietTimer": 2, "ambienceTimer": 1, "quietStartTime": "03:00", "quietEndTime": "08:00",
+		%v, "preempt": {"manual": "idle", "idleMinutes": 5}}`, preemptTiersJSON)
+	file := player.Status{State: player.StatePlaying, Input: "E:/videos/mine.mp4"}
+	e, clock, p := manualEngine(t, cfg, file, map[string]yt.VideoDetails{"doki": liveStream("dokidokidok")})
+
+	// pausing and resuming counts as activity
+	stepUntil(e, clock, start.Add(3*time.Minute))
+	p.status.State = player.StatePaused
+	stepUntil(e, clock, start.Add(3*time.Minute+10*time.Second))
+	p.status.State = player.StatePlaying
+	stepUntil(e, clock, start.Add(8*time.Minute+30*time.Second))
+	if len(p.played) != 0 {
+		t.Fatalf("got %v, want the video kept until 5 minutes after it was resumed", p.played)
+	}
+
+	stepUntil(e, clock, start.Add(9*time.Minute+30*time.Second))
+	if len(p.played) != 1 || p.played[0] != watch("dokidokidok") {
+		t.Errorf("got %v, want doki once the user was idle", p.played)
+	}
+}
+
+func TestPreemptHigher(t *testing.T) {
+	cfg := fmt.Sprintf(`{"liveTimer": 1, "quietTimer": 2, "ambienceTimer": 1, "quietStartTime": "03:00", "quietEndTime": "08:00",
+		"randomizeStreams": true, %v, "preempt": {"manual": "higher"}}`, preemptTiersJSON)
+
+	t.Run("same tier", func(t *testing.T) {
+		mint := player.Status{State: player.StatePlaying, Input: watch("mintmintmin"), VideoID: "mintmintmin"}
+		live := map[string]yt.VideoDetails{"mint": liveStream("mintmintmin"), "nene": liveStream("nenenenenen")}
+		e, clock, p := manualEngine(t, cfg, mint, live)
+
+		stepUntil(e, clock, start.Add(5*time.Minute))
+		if len(p.played) != 0 {
+			t.Fatalf("got %v, want mint kept over a stream in the same tier", p.played)
+		}
+
+		live["doki"] = liveStream("dokidokidok")
+		stepUntil(e, clock, start.Add(7*time.Minute))
+		if len(p.played) != 1 || p.played[0] != watch("dokidokidok") {
+			t.Errorf("got %v, want doki in the higher tier to replace mint", p.played)
+		}
+	})
+
+	t.Run("untiered", func(t *testing.T) {
+		file := player.Status{State: player.StatePlaying, Input: "E:/videos/mine.mp4"}
+		e, clock, p := manualEngine(t, cfg, file, map[string]yt.VideoDetails{"koko": liveStream("kokokokokok")})
+
+		stepUntil(e, clock, start.Add(5*time.Minute))
+		if len(p.played) != 0 {
+			t.Errorf("got %v, want a random stream to leave the video alone", p.played)
+		}
+	})
+}
+
+// autoplay doesn't switch back and forth between live streams in the same tier
+func TestEqualTierKept(t *testing.T) {
+	useConfig(t, fmt.Sprintf(`{"liveTimer": 1, "quietTimer": 2, "ambienceTimer": 1, "quietStartTime": "03:00", "quietEndTime": "08:00", %v}`, preemptTiersJSON))
+	p := &fakePlayer{}
+	e, clock, _ := newEngine(p, map[string]yt.VideoDetails{"mint": liveStream("mintmintmin"), "nene": liveStream("nenenenenen")})
+
+	stepUntil(e, clock, start.Add(30*time.Minute))
+	if len(p.played) != 1 {
+		t.Errorf("got %v, want the first stream picked kept", p.played)
+	}
+}
+
+func TestPreemptGrace(t *testing.T) {
+	cfg := fmt.Sprintf(`{"liveTimer": 1, "quietTimer": 2, "ambienceTimer": 1, "quietStartTime": "03:00", "quietEndTime": "08:00",
+		%v, "preempt": {"manual": "always", "grace": 30}}`, preemptTiersJSON)
+	file := player.Status{State: player.StatePlaying, Input: "E:/videos/mine.mp4"}
+	e, clock, p := manualEngine(t, cfg, file, map[string]yt.VideoDetails{"doki": liveStream("dokidokidok")})
+
+	// first wanted at the ambience check a minute in
+	stepUntil(e, clock, start.Add(89*time.Second))
+	if len(p.played) != 0 {
+		t.Fatalf("got %v, want the switch held for the grace period", p.played)
+	}
+
+	stepUntil(e, clock, start.Add(90*time.Second))
+	if len(p.played) != 1 || p.played[0] != watch("dokidokidok") {
+		t.Errorf("got %v, want the switch as the grace period ends", p.played)
+	}
+}
@@ -0,0 +1,344 @@
+// Package scheduler decides what plays and when: it polls the player, checks the channels for live streams,
+// and switches between live streams, the queue and ambience on a timer.
+package scheduler
+
+import (
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/BlunterMonk/StreamNotify/pkg/chatwatch"
+	"github.com/BlunterMonk/StreamNotify/pkg/config"
+	"github.com/BlunterMonk/StreamNotify/pkg/filter"
+	"github.com/BlunterMonk/StreamNotify/pkg/multiview"
+	"github.com/BlunterMonk/StreamNotify/pkg/player"
+	"github.com/BlunterMonk/StreamNotify/pkg/queue"
+	"github.com/BlunterMonk/StreamNotify/pkg/recorder"
+	yt "github.com/BlunterMonk/StreamNotify/pkg/youtube"
+)
+
+const (
+	// how often the player is polled for its status
+	statusInterval = 2 * time.Second
+
+	// stop events this soon after starting a stream are from replacing the old video
+	switchGrace = 10 * time.Second
+)
+
+// StatusProvider returns the current status of every tracked channel
+type StatusProvider interface {
+	ChannelStatus() map[string]yt.VideoDetails
+}
+
+// Notifier tells the user a channel went live
+type Notifier interface {
+	Notify(channel string, v yt.VideoDetails)
+}
+
+// Recorder records the live streams it's given, stopping the ones that are left out
+type Recorder interface {
+	Update(live []recorder.Stream)
+}
+
+// ChatWatcher watches the chat of the streams it's given
+type ChatWatcher interface {
+	Update(streams []chatwatch.Stream)
+}
+
+// Multiview shows several streams at once in their own windows
+type Multiview interface {
+	Windows() int
+	Assign(streams []multiview.Stream) error
+	SetVolume(volume int) error
+	Streams() []multiview.Stream
+	Active() bool
+	Stop() error
+}
+
+// Options are the parts the engine works with, the optional ones are left nil to turn them off
+type Options struct {
+	Clock    Clock          // defaults to the system clock
+	Rand     *rand.Rand     // picks between streams, defaults to one seeded from the clock
+	Status   StatusProvider // required
+	Notifier Notifier       // required
+	Player   player.Player  // required
+
+	Store     *player.Store   // shared with anything else pushing player changes, like the kodi listener
+	Queue     *queue.Queue    // live streams waiting behind the current one
+	Skips     <-chan struct{} // skip requests for the queue
+	Multiview Multiview
+	Recorder  Recorder
+	Chat      ChatWatcher
+
+	// Reload is called before every live check to pick up config changes
+	Reload func()
+}
+
+// Engine runs the schedule, either in real time with Run or one step at a time with Step
+type Engine struct {
+	clock    Clock
+	rand     *rand.Rand
+	status   StatusProvider
+	notifier Notifier
+	client   player.Player
+	store    *player.Store
+	events   <-chan player.Event
+	streams  *queue.Queue
+	skips    <-chan struct{}
+	mv       Multiview
+	rec      Recorder
+	chat     ChatWatcher
+	reload   func()
+
+	tasks []*task
+
+	// state
+	streamInfo  map[string]yt.VideoDetails
+	sleeping    bool
+	interrupted *player.Status // ambience cut off by a live stream, resumed when the stream ends
+	lastSwitch  time.Time      // when a live stream was last started, stops right after are part of the switch
+	queued      string         // video the queue last started, autoplay leaves it playing
+
+	origin       Origin    // who started what's playing
+	expect       string    // input the engine last played
+	lastActivity time.Time // when the user last started, paused or resumed something
+
+	pending      string    // switch waiting out the grace period
+	pendingSince time.Time // when the pending switch was first wanted
+	wanted       bool      // the last ambience check wanted a switch
+}
+
+// task is a piece of the schedule that runs every interval, the interval is read each time so config reloads apply
+type task struct {
+	name     string
+	interval func() time.Duration
+	run      func()
+	next     time.Time
+}
+
+func New(opts Options) *Engine {
+	e := &Engine{
+		clock:      opts.Clock,
+		rand:       opts.Rand,
+		status:     opts.Status,
+		notifier:   opts.Notifier,
+		client:     opts.Player,
+		store:      opts.Store,
+		streams:    opts.Queue,
+		skips:      opts.Skips,
+		mv:         opts.Multiview,
+		rec:        opts.Recorder,
+		chat:       opts.Chat,
+		reload:     opts.Reload,
+		streamInfo: make(map[string]yt.VideoDetails, 0),
+	}
+	if e.clock == nil {
+		e.clock = SystemClock{}
+	}
+	if e.rand == nil {
+		e.rand = rand.New(rand.NewSource(e.clock.Now().UnixNano()))
+	}
+	if e.store == nil {
+		e.store = player.NewStore()
+	}
+	if e.streams == nil {
+		e.streams = queue.New()
+	}
+	e.events = e.store.Subscribe(16)
+
+	// everything but the ambience runs right away, same as on startup
+	now := e.clock.Now()
+	e.tasks = []*task{
+		{name: "status", interval: func() time.Duration { return statusInterval }, run: e.pollStatus, next: now},
+		{name: "live", interval: minutes(func() int { return config.Get().LiveTimer }, 1), run: e.checkLive, next: now},
+		{name: "quiet", interval: minutes(func() int { return config.Get().QuietTimer }, 2), run: e.checkQuiet, next: now},
+		{name: "ambience", interval: minutes(func() int { return config.Get().AmbienceTimer }, 1), run: e.checkAmbience},
+	}
+	e.tasks[3].next = now.Add(e.tasks[3].interval())
+
+	return e
+}
+
+// minutes turns a timer in the config into an interval, timer is called every time since
+// a reload replaces the whole config. A missing timer uses the default
+func minutes(timer func() int, def int) func() time.Duration {
+	return func() time.Duration {
+		if v := timer(); v > 0 {
+			return time.Duration(v) * time.Minute
+		}
+		return time.Duration(def) * time.Minute
+	}
+}
+
+// Step handles waiting player events and skips, runs every task that's due,
+// and returns when the next task is due. Simulations set a ManualClock to that time and step again.
+func (e *Engine) Step() time.Time {
+	e.drain()
+
+	for _, t := range e.tasks {
+		if e.clock.Now().Before(t.next) {
+			continue
+		}
+		// set before running so the task can bring itself forward
+		t.next = e.clock.Now().Add(t.interval())
+		t.run()
+		e.drain()
+	}
+
+	return e.nextDue()
+}
+
+// Run steps the engine in real time until stop is closed
+func (e *Engine) Run(stop <-chan struct{}) {
+	for {
+		next := e.Step()
+
+		timer := time.NewTimer(next.Sub(e.clock.Now()))
+		select {
+		case <-timer.C:
+		case ev := <-e.events:
+			e.handleEvent(ev)
+		case <-e.skips:
+			e.skip()
+		case <-stop:
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+	}
+}
+
+// Store returns the player status the engine works from
+func (e *Engine) Store() *player.Store {
+	return e.store
+}
+
+// StreamInfo returns the channel status from the last live check
+func (e *Engine) StreamInfo() map[string]yt.VideoDetails {
+	return e.streamInfo
+}
+
+// Sleeping reports if playback was stopped for quiet hours
+func (e *Engine) Sleeping() bool {
+	return e.sleeping
+}
+
+func (e *Engine) nextDue() time.Time {
+	next := e.tasks[0].next
+	for _, t := range e.tasks[1:] {
+		if t.next.Before(next) {
+			next = t.next
+		}
+	}
+	return next
+}
+
+// drain handles the player events and skips that are waiting, without blocking
+func (e *Engine) drain() {
+	for {
+		select {
+		case ev := <-e.events:
+			e.handleEvent(ev)
+		case <-e.skips:
+			e.skip()
+		default:
+			return
+		}
+	}
+}
+
+func (e *Engine) pollStatus() {
+	s, err := e.client.Status()
+	if err != nil {
+		log.Println("Error getting player status:", err)
+		return
+	}
+	e.store.Set(s)
+}
+
+func (e *Engine) handleEvent(ev player.Event) {
+	switch ev.Type {
+	case player.EventInputChanged, player.EventStopped:
+		e.watchChat(ev.Status)
+	}
+
+	switch ev.Type {
+	case player.EventInputChanged:
+		e.classify(ev.Status)
+		log.Printf("Now Playing (%v): %v\n", e.origin, ev.Status.Input)
+	case player.EventPaused:
+		e.lastActivity = e.clock.Now()
+	case player.EventStarted:
+		if ev.Previous.State == player.StatePaused {
+			e.lastActivity = e.clock.Now()
+		}
+	case player.EventScreensaverOff:
+		e.lastActivity = e.clock.Now()
+	case player.EventScreensaverOn:
+		// the user is away, check right away if autoplay can take over
+		e.wake(e.clock.Now())
+	case player.EventStopped:
+		log.Println("playback stopped:", ev.Previous.Input)
+		e.origin = OriginNone
+
+		// play the next queued stream once the current one is over, or pick the ambience back up
+		if ev.Previous.VideoID != "" && e.clock.Now().Sub(e.lastSwitch) > switchGrace && !e.multiviewActive() &&
+			!e.sleeping && !e.quietHours() {
+			if !e.playNext() {
+				e.resumeAmbience()
+			}
+		}
+	}
+}
+
+func (e *Engine) skip() {
+	log.Println("skipping to the next queued stream")
+	if !e.playNext() {
+		log.Println("no queued streams are live")
+	}
+}
+
+func (e *Engine) checkLive() {
+	if e.reload != nil {
+		e.reload()
+	}
+	e.streamInfo = e.status.ChannelStatus()
+	if e.rec != nil {
+		e.rec.Update(recordable(e.streamInfo))
+	}
+	e.watchChat(e.store.Get())
+
+	for _, q := range e.streams.Prune(e.isLive) {
+		log.Println("stream ended, removed from the queue:", q.Channel, q.Title)
+	}
+
+	for k, v := range e.streamInfo {
+		on := v.VideoDetails.IsLive
+		if !on || !filter.Allowed(k, v.VideoDetails.Title, filter.Notify) {
+			continue
+		}
+
+		e.notifier.Notify(k, v)
+	}
+}
+
+// checkQuiet halts all playback during quiet hours
+func (e *Engine) checkQuiet() {
+	if !e.quietHours() {
+		return
+	}
+
+	if e.store.Get().State.Active() {
+		log.Println("quiet hours, stopping all playback")
+		e.stopPlayback()
+		e.sleeping = true
+	}
+	if e.multiviewActive() {
+		log.Println("quiet hours, closing multiview")
+		e.mv.Stop()
+		e.sleeping = true
+	}
+
+	// the ambience check reads the stored status, it mustn't see the stopped video as a new one
+	e.pollStatus()
+}
@@ -0,0 +1,336 @@
+package scheduler
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/BlunterMonk/StreamNotify/pkg/config"
+	"github.com/BlunterMonk/StreamNotify/pkg/player"
+	"github.com/BlunterMonk/StreamNotify/pkg/queue"
+	yt "github.com/BlunterMonk/StreamNotify/pkg/youtube"
+)
+
+var start = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+// useConfig replaces the config with cfg, the config file is loaded back after the test
+func useConfig(t *testing.T, cfg string) {
+	t.Helper()
+
+	t.Cleanup(config.LoadConfig)
+	if err := config.Use([]byte(cfg)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type fakeStatus struct {
+	checks []time.Time
+	clock  Clock
+	live   map[string]yt.VideoDetails
+}
+
+func (s *fakeStatus) ChannelStatus() map[string]yt.VideoDetails {
+	s.checks = append(s.checks, s.clock.Now())
+	return s.live
+}
+
+type fakeNotifier struct{}
+
+func (fakeNotifier) Notify(channel string, v yt.VideoDetails) {}
+
+// fakePlayer opens whatever it's given after a few status polls
+type fakePlayer struct {
+	status    player.Status
+	openAfter int
+	polls     int
+	volume    int
+	played    []string
+	seeks     []int
+}
+
+func (p *fakePlayer) play(input string) error {
+	p.played = append(p.played, input)
+	p.status = player.Status{State: player.StateOpening, Input: input, VideoID: player.VideoID(input)}
+	p.polls = 0
+	return nil
+}
+
+func (p *fakePlayer) PlayURL(url string) error   { return p.play(url) }
+func (p *fakePlayer) PlayFile(path string) error { return p.play(path) }
+func (p *fakePlayer) Stop() error                { p.status = player.Status{}; return nil }
+func (p *fakePlayer) NowPlaying() string         { return p.status.Input }
+func (p *fakePlayer) GetVolume() (int, error)    { return p.volume, nil }
+func (p *fakePlayer) SetVolume(volume int) error { p.volume = volume; return nil }
+func (p *fakePlayer) Seek(seconds int) error     { p.seeks = append(p.seeks, seconds); return nil }
+
+// RandomFile always picks the same ambience so it's known which file should be resumed
+func (p *fakePlayer) RandomFile(dir string) (string, error) { return dir + "/song.mp4", nil }
+
+func (p *fakePlayer) Status() (player.Status, error) {
+	p.polls++
+	if p.status.State == player.StateOpening && p.polls >= p.openAfter {
+		p.status.State = player.StatePlaying
+		p.status.Length = 600
+	}
+	return p.status, nil
+}
+
+func liveStream(id string) yt.VideoDetails {
+	var v yt.VideoDetails
+	v.VideoDetails.VideoID = id
+	v.VideoDetails.Title = "stream"
+	v.VideoDetails.IsLive = true
+	return v
+}
+
+func newEngine(p *fakePlayer, live map[string]yt.VideoDetails) (*Engine, *ManualClock, *fakeStatus) {
+	clock := NewManualClock(start)
+	status := &fakeStatus{clock: clock, live: live}
+	e := New(Options{
+		Clock:    clock,
+		Rand:     rand.New(rand.NewSource(1)),
+		Status:   status,
+		Notifier: fakeNotifier{},
+		Player:   p,
+	})
+	return e, clock, status
+}
+
+// stepUntil steps the engine, jumping the clock to each step, until the next step is after until
+func stepUntil(e *Engine, clock *ManualClock, until time.Time) {
+	for {
+		next := e.Step()
+		if next.After(until) {
+			return
+		}
+		if next.After(clock.Now()) {
+			clock.Set(next)
+		}
+	}
+}
+
+func TestTimersFollowReload(t *testing.T) {
+	useConfig(t, `{"liveTimer": 1, "quietTimer": 2, "ambienceTimer": 1, "quietStartTime": "03:00", "quietEndTime": "08:00"}`)
+	e, clock, status := newEngine(&fakePlayer{}, nil)
+
+	if next := e.Step(); !next.Equal(start.Add(statusInterval)) {
+		t.Errorf("got next step at %v, want the status poll", next.Sub(start))
+	}
+
+	stepUntil(e, clock, start.Add(3*time.Minute))
+	useConfig(t, `{"liveTimer": 5, "quietTimer": 2, "ambienceTimer": 1, "quietStartTime": "03:00", "quietEndTime": "08:00"}`)
+	stepUntil(e, clock, start.Add(12*time.Minute))
+
+	want := []time.Duration{0, time.Minute, 2 * time.Minute, 3 * time.Minute, 4 * time.Minute, 9 * time.Minute}
+	if len(status.checks) != len(want) {
+		t.Fatalf("got %d live checks, want %d", len(status.checks), len(want))
+	}
+	for i, w := range want {
+		if got := status.checks[i].Sub(start); got != w {
+			t.Errorf("check %d: got %v, want %v", i, got, w)
+		}
+	}
+}
+
+func TestFadeUsesClock(t *testing.T) {
+	// a volume section without the fade, as saved before fading was added, keeps the 2s default
+	useConfig(t, `{"liveTimer": 1, "quietTimer": 2, "ambienceTimer": 1, "quietStartTime": "03:00", "quietEndTime": "08:00",
+		"priority": "doki", "volume": {"live": 80}}`)
+	p := &fakePlayer{volume: 80}
+	e, clock, _ := newEngine(p, map[string]yt.VideoDetails{"doki": liveStream("abcdefghijk")})
+
+	stepUntil(e, clock, start.Add(time.Minute-time.Second))
+	if len(p.played) != 0 {
+		t.Fatalf("played %v before the ambience check", p.played)
+	}
+
+	wall := time.Now()
+	due := start.Add(time.Minute)
+	clock.Set(due)
+	e.Step()
+
+	if len(p.played) != 1 || p.played[0] != "https://www.youtube.com/watch?v=abcdefghijk" {
+		t.Errorf("got %v, want the live stream played", p.played)
+	}
+	if p.volume != 80 {
+		t.Errorf("got volume %v, want it faded back to 80", p.volume)
+	}
+	// nothing was playing so there's no fade out, the fade in waits 19 steps
+	if got := clock.Now().Sub(due); got != 19*100*time.Millisecond {
+		t.Errorf("the fade took %v on the clock, want 1.9s", got)
+	}
+	if d := time.Since(wall); d > time.Second {
+		t.Errorf("the fade took %v of real time", d)
+	}
+}
+
+func TestSeekWhenPlaying(t *testing.T) {
+	p := &fakePlayer{openAfter: 3}
+	e, clock, _ := newEngine(p, nil)
+	p.PlayFile("E:/bgm/song.mp4")
+
+	if err := e.seekWhenPlaying(90); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.seeks) != 1 || p.seeks[0] != 90 {
+		t.Errorf("got seeks %v, want 90", p.seeks)
+	}
+	if got := clock.Now().Sub(start); got != 500*time.Millisecond {
+		t.Errorf("waited %v on the clock, want two polls", got)
+	}
+
+	// a video that never opens gives up after 5s on the clock
+	p.openAfter = 1000
+	p.PlayFile("E:/bgm/stuck.mp4")
+	wall := time.Now()
+	if err := e.seekWhenPlaying(90); err == nil {
+		t.Error("seeked a video that didn't open")
+	}
+	if got := clock.Now().Sub(start); got != 5500*time.Millisecond {
+		t.Errorf("waited %v on the clock, want 5s more", got-500*time.Millisecond)
+	}
+	if d := time.Since(wall); d > time.Second {
+		t.Errorf("waited %v of real time", d)
+	}
+}
+
+func TestResumeAmbience(t *testing.T) {
+	// resumeAmbience and resumeRewind are left to their defaults
+	useConfig(t, `{"liveTimer": 1, "quietTimer": 2, "ambienceTimer": 1, "quietStartTime": "03:00", "quietEndTime": "08:00",
+		"priority": "doki", "musicDir": "E:/bgm"}`)
+	p := &fakePlayer{openAfter: 2}
+	live := map[string]yt.VideoDetails{}
+	e, clock, _ := newEngine(p, live)
+
+	stepUntil(e, clock, start.Add(90*time.Second))
+	if len(p.played) != 1 || p.played[0] != "E:/bgm/song.mp4" {
+		t.Fatalf("got %v, want the ambience played", p.played)
+	}
+	p.status.Time = 120
+
+	live["doki"] = liveStream("abcdefghijk")
+	stepUntil(e, clock, start.Add(150*time.Second))
+	if len(p.played) != 2 || p.played[1] != "https://www.youtube.com/watch?v=abcdefghijk" {
+		t.Fatalf("got %v, want the live stream to replace the ambience", p.played)
+	}
+
+	delete(live, "doki")
+	p.status = player.Status{}
+	stepUntil(e, clock, start.Add(170*time.Second))
+
+	if len(p.played) != 3 || p.played[2] != "E:/bgm/song.mp4" {
+		t.Fatalf("got %v, want the ambience played again after the stream", p.played)
+	}
+	if len(p.seeks) != 1 || p.seeks[0] != 115 {
+		t.Errorf("got seeks %v, want where it was cut off minus the 5s rewind", p.seeks)
+	}
+}
+
+// staleStream is a channel that couldn't be checked, its last known stream isn't reported as live
+func staleStream(id string) yt.VideoDetails {
+	v := liveStream(id)
+	v.VideoDetails.IsLive = false
+	v.Stale = true
+	return v
+}
+
+func watch(id string) string {
+	return "https://www.youtube.com/watch?v=" + id
+}
+
+const queueConfig = `{"liveTimer": 1, "quietTimer": 2, "ambienceTimer": 1, "quietStartTime": "03:00", "quietEndTime": "08:00",
+	"priority": "doki,mint"}`
+
+func TestQueueAdvance(t *testing.T) {
+	useConfig(t, queueConfig)
+	p := &fakePlayer{}
+	live := map[string]yt.VideoDetails{"doki": liveStream("dokidokidok"), "mint": liveStream("mintmintmin")}
+	e, clock, _ := newEngine(p, live)
+
+	stepUntil(e, clock, start.Add(90*time.Second))
+	if len(p.played) != 1 || p.played[0] != watch("dokidokidok") {
+		t.Fatalf("got %v, want the highest priority stream", p.played)
+	}
+	if q := e.streams.List(); len(q) != 1 || q[0].VideoID != "mintmintmin" {
+		t.Fatalf("got queue %+v, want mint waiting", q)
+	}
+
+	// mint's channel failing to load doesn't drop it from the queue
+	live["mint"] = staleStream("mintmintmin")
+	stepUntil(e, clock, start.Add(150*time.Second))
+	if e.streams.Len() != 1 {
+		t.Fatal("a stream was pruned from the queue over a failed check")
+	}
+
+	// doki's stream ends, the queue moves on
+	delete(live, "doki")
+	p.status = player.Status{}
+	stepUntil(e, clock, start.Add(160*time.Second))
+	if len(p.played) != 2 || p.played[1] != watch("mintmintmin") {
+		t.Fatalf("got %v, want the queued stream after the first ended", p.played)
+	}
+	if e.streams.Len() != 0 || e.streams.Current().VideoID != "mintmintmin" {
+		t.Errorf("got queue %+v current %+v", e.streams.List(), e.streams.Current())
+	}
+
+	// once it's checked and has ended it's pruned
+	live["mint"] = liveStream("minsnextone")
+	e.streams.Push(queue.Entry{Channel: "mint", VideoID: "mintmintmin"})
+	stepUntil(e, clock, start.Add(4*time.Minute))
+	for _, q := range e.streams.List() {
+		if q.VideoID == "mintmintmin" {
+			t.Error("an ended stream was left in the queue")
+		}
+	}
+}
+
+func TestQueueSkip(t *testing.T) {
+	useConfig(t, queueConfig)
+	p := &fakePlayer{}
+	live := map[string]yt.VideoDetails{"doki": liveStream("dokidokidok"), "mint": liveStream("mintmintmin")}
+	clock := NewManualClock(start)
+	skips := make(chan struct{}, 1)
+	e := New(Options{
+		Clock:    clock,
+		Rand:     rand.New(rand.NewSource(1)),
+		Status:   &fakeStatus{clock: clock, live: live},
+		Notifier: fakeNotifier{},
+		Player:   p,
+		Skips:    skips,
+	})
+
+	stepUntil(e, clock, start.Add(90*time.Second))
+	skips <- struct{}{}
+	stepUntil(e, clock, start.Add(100*time.Second))
+	if len(p.played) != 2 || p.played[1] != watch("mintmintmin") {
+		t.Fatalf("got %v, want the skip to play the queued stream", p.played)
+	}
+
+	// the higher priority stream waits in the queue instead of replacing the one skipped to
+	stepUntil(e, clock, start.Add(5*time.Minute))
+	if len(p.played) != 2 {
+		t.Errorf("got %v, want the stream from the queue left playing", p.played)
+	}
+	if q := e.streams.List(); len(q) != 1 || q[0].VideoID != "dokidokidok" {
+		t.Errorf("got queue %+v, want doki waiting", q)
+	}
+}
+
+// a stream autoplay started isn't protected like one from the queue, a higher priority stream replaces it
+func TestQueuePreemptAutoplayed(t *testing.T) {
+	useConfig(t, queueConfig)
+	p := &fakePlayer{}
+	live := map[string]yt.VideoDetails{"mint": liveStream("mintmintmin")}
+	e, clock, _ := newEngine(p, live)
+
+	stepUntil(e, clock, start.Add(90*time.Second))
+	if len(p.played) != 1 || e.streams.Current().VideoID != "mintmintmin" {
+		t.Fatalf("got %v current %+v, want mint autoplayed", p.played, e.streams.Current())
+	}
+
+	live["doki"] = liveStream("dokidokidok")
+	stepUntil(e, clock, start.Add(150*time.Second))
+	if len(p.played) != 2 || p.played[1] != watch("dokidokidok") {
+		t.Errorf("got %v, want doki to replace mint", p.played)
+	}
+}
@@ -0,0 +1,290 @@
+package thumbcache
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// largest single thumbnail we'll accept, anything bigger isn't a thumbnail
+	maxImageSize = 10 << 20
+
+	downloadTimeout = 30 * time.Second
+)
+
+var (
+	ErrNoImages    = errors.New("no thumbnails available")
+	ErrNotAnImage  = errors.New("downloaded thumbnail is not an image")
+	ErrImageTooBig = errors.New("downloaded thumbnail is too large")
+)
+
+// Image is a single resolution of a thumbnail
+type Image struct {
+	URL    string
+	Width  int
+	Height int
+}
+
+// Cache stores downloaded thumbnails on disk and evicts the least recently used
+// files once the total size goes over the limit
+type Cache struct {
+	dir      string
+	maxBytes int64
+	client   *http.Client
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List               // front is most recently used
+	entries map[string]*list.Element // filename -> element
+}
+
+type entry struct {
+	name string
+	size int64
+}
+
+// New creates a cache in dir, files left from previous runs are kept and ordered by modification time
+func New(dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	c := &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		client:   &http.Client{Timeout: downloadTimeout},
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element, 0),
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type existing struct {
+		name string
+		size int64
+		mod  time.Time
+	}
+	found := make([]existing, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		// remove anything left half written
+		if strings.HasSuffix(f.Name(), ".tmp") {
+			os.Remove(filepath.Join(dir, f.Name()))
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		found = append(found, existing{f.Name(), info.Size(), info.ModTime()})
+	}
+
+	// oldest first so the newest end up at the front
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].mod.Before(found[j].mod)
+	})
+	for _, f := range found {
+		c.add(f.name, f.size)
+	}
+
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+
+	return c, nil
+}
+
+// Best picks the smallest image that covers the target size,
+// or the largest one available if none are big enough
+func Best(images []Image, width, height int) (Image, bool) {
+	if len(images) == 0 {
+		return Image{}, false
+	}
+
+	var best, largest Image
+	found := false
+	for _, img := range images {
+		if img.URL == "" {
+			continue
+		}
+		if img.Width*img.Height > largest.Width*largest.Height || largest.URL == "" {
+			largest = img
+		}
+		if img.Width >= width && img.Height >= height {
+			if !found || img.Width*img.Height < best.Width*best.Height {
+				best = img
+				found = true
+			}
+		}
+	}
+
+	if found {
+		return best, true
+	}
+	return largest, largest.URL != ""
+}
+
+// Get returns the path to a cached thumbnail for the key at the best resolution
+// for the target size, downloading it if needed
+func (c *Cache) Get(key string, images []Image, width, height int) (string, error) {
+	img, ok := Best(images, width, height)
+	if !ok {
+		return "", ErrNoImages
+	}
+
+	base := fmt.Sprintf("%v_%vx%v", sanitize(key), img.Width, img.Height)
+
+	c.mu.Lock()
+	for _, ext := range []string{".jpg", ".png", ".webp", ".gif"} {
+		if el, ok := c.entries[base+ext]; ok {
+			// a file deleted from outside the cache is downloaded again
+			fn := filepath.Join(c.dir, base+ext)
+			if _, err := os.Stat(fn); err != nil {
+				c.remove(el)
+				continue
+			}
+
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+
+			now := time.Now()
+			os.Chtimes(fn, now, now)
+			return filepath.ToSlash(fn), nil
+		}
+	}
+	c.mu.Unlock()
+
+	name, size, err := c.download(img.URL, base)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.add(name, size)
+	c.evict()
+	c.mu.Unlock()
+
+	return filepath.ToSlash(filepath.Join(c.dir, name)), nil
+}
+
+// download writes the image to a temp file and only renames it into place once it's complete and valid
+func (c *Cache) download(url, base string) (string, int64, error) {
+	resp, err := c.client.Get(url)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("failed to download thumbnail: %v: %v", url, resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, "image/") {
+		return "", 0, fmt.Errorf("%w: %v: %v", ErrNotAnImage, url, ct)
+	}
+
+	tmp, err := os.CreateTemp(c.dir, base+"-*.tmp")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	// check the first bytes of the body, some errors come back as html with an image content type
+	head := make([]byte, 512)
+	n, err := io.ReadFull(resp.Body, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		tmp.Close()
+		return "", 0, err
+	}
+	head = head[:n]
+
+	ext := extension(http.DetectContentType(head))
+	if ext == "" {
+		tmp.Close()
+		return "", 0, fmt.Errorf("%w: %v", ErrNotAnImage, url)
+	}
+
+	size, err := io.Copy(tmp, io.MultiReader(bytes.NewReader(head), io.LimitReader(resp.Body, maxImageSize)))
+	if err != nil {
+		tmp.Close()
+		return "", 0, err
+	}
+	if size >= maxImageSize {
+		tmp.Close()
+		return "", 0, fmt.Errorf("%w: %v", ErrImageTooBig, url)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, err
+	}
+
+	name := base + ext
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, name)); err != nil {
+		return "", 0, err
+	}
+
+	return name, size, nil
+}
+
+// add must be called with the lock held
+func (c *Cache) add(name string, size int64) {
+	if el, ok := c.entries[name]; ok {
+		c.size -= el.Value.(*entry).size
+		c.lru.Remove(el)
+	}
+	c.entries[name] = c.lru.PushFront(&entry{name, size})
+	c.size += size
+}
+
+// evict must be called with the lock held, the most recent file is always kept
+func (c *Cache) evict() {
+	for c.maxBytes > 0 && c.size > c.maxBytes && c.lru.Len() > 1 {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove must be called with the lock held
+func (c *Cache) remove(el *list.Element) {
+	e := el.Value.(*entry)
+
+	c.lru.Remove(el)
+	delete(c.entries, e.name)
+	c.size -= e.size
+	os.Remove(filepath.Join(c.dir, e.name))
+}
+
+func extension(contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/webp":
+		return ".webp"
+	case "image/gif":
+		return ".gif"
+	}
+	return ""
+}
+
+func sanitize(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == '.' {
+			return '_'
+		}
+		return r
+	}, key)
+}
@@ -0,0 +1,219 @@
+package thumbcache
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// png is a body http.DetectContentType sees as a png, size bytes long
+func png(size int) []byte {
+	b := []byte("\x89PNG\r\n\x1a\n")
+	return append(b, bytes.Repeat([]byte{0}, size-len(b))...)
+}
+
+// server serves the bodies by path and counts the requests for each
+type server struct {
+	mu     sync.Mutex
+	bodies map[string][]byte
+	types  map[string]string
+	gets   map[string]int
+}
+
+func newServer(t *testing.T) (*server, *httptest.Server) {
+	s := &server{bodies: map[string][]byte{}, types: map[string]string{}, gets: map[string]int{}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.gets[r.URL.Path]++
+		body, ok := s.bodies[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if ct := s.types[r.URL.Path]; ct != "" {
+			w.Header().Set("Content-Type", ct)
+		}
+		if r.URL.Path == "/partial.png" {
+			// promise more than is sent so the download fails halfway
+			w.Header().Set("Content-Length", "100000")
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+func (s *server) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gets[path]
+}
+
+// files lists the names in dir
+func files(t *testing.T, dir string) []string {
+	list, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(list))
+	for _, f := range list {
+		names = append(names, f.Name())
+	}
+	return names
+}
+
+func TestBest(t *testing.T) {
+	images := []Image{
+		{"https://i.ytimg.com/vi/a/default.jpg", 120, 90},
+		{"https://i.ytimg.com/vi/a/maxresdefault.jpg", 1280, 720},
+		{"https://i.ytimg.com/vi/a/hqdefault.jpg", 480, 360},
+		{"", 1920, 1080},
+		{"https://i.ytimg.com/vi/a/mqdefault.jpg", 320, 180},
+	}
+
+	tests := []struct {
+		width, height int
+		want          string
+	}{
+		{100, 80, "default"},
+		{320, 180, "mqdefault"},
+		{400, 200, "hqdefault"},
+		{640, 360, "maxresdefault"},
+		// nothing covers it, the largest with a url is used
+		{1920, 1080, "maxresdefault"},
+	}
+	for _, tt := range tests {
+		img, ok := Best(images, tt.width, tt.height)
+		if !ok || !strings.HasSuffix(img.URL, "/"+tt.want+".jpg") {
+			t.Errorf("%vx%v: got %v %v, want %v", tt.width, tt.height, img.URL, ok, tt.want)
+		}
+	}
+
+	if _, ok := Best(nil, 320, 180); ok {
+		t.Error("picked an image from none")
+	}
+	if _, ok := Best([]Image{{"", 320, 180}}, 320, 180); ok {
+		t.Error("picked an image without a url")
+	}
+}
+
+func TestGetCached(t *testing.T) {
+	s, ts := newServer(t)
+	s.bodies["/a.png"] = png(1000)
+	c, err := New(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := []Image{{ts.URL + "/a.png", 320, 180}}
+
+	fn, err := c.Get("a", images, 320, 180)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(fn) != "a_320x180.png" {
+		t.Errorf("got %v, want the extension from the body", fn)
+	}
+	if _, err := c.Get("a", images, 320, 180); err != nil || s.count("/a.png") != 1 {
+		t.Errorf("got %v after %v downloads, want the cached file", err, s.count("/a.png"))
+	}
+
+	// a file deleted from outside is downloaded again
+	os.Remove(fn)
+	if _, err := c.Get("a", images, 320, 180); err != nil || s.count("/a.png") != 2 {
+		t.Errorf("got %v after %v downloads, want the missing file downloaded again", err, s.count("/a.png"))
+	}
+	if _, err := os.Stat(fn); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetNotAnImage(t *testing.T) {
+	s, ts := newServer(t)
+	s.bodies["/page.jpg"] = []byte("<html><body>error</body></html>")
+	s.types["/page.jpg"] = "image/jpeg"
+	s.bodies["/page.html"] = png(1000)
+	s.types["/page.html"] = "text/html"
+	dir := t.TempDir()
+	c, err := New(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/page.jpg", "/page.html"} {
+		if _, err := c.Get("a", []Image{{ts.URL + path, 320, 180}}, 320, 180); !errors.Is(err, ErrNotAnImage) {
+			t.Errorf("%v: got %v, want not an image", path, err)
+		}
+	}
+	if got := files(t, dir); len(got) != 0 {
+		t.Errorf("left %v behind", got)
+	}
+}
+
+func TestGetPartial(t *testing.T) {
+	s, ts := newServer(t)
+	s.bodies["/partial.png"] = png(1000)
+	dir := t.TempDir()
+
+	// a temp file left by a crash is cleaned up
+	os.WriteFile(filepath.Join(dir, "a_320x180-123.tmp"), png(1000), 0644)
+	c, err := New(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Get("a", []Image{{ts.URL + "/partial.png", 320, 180}}, 320, 180); err == nil {
+		t.Error("a download cut off halfway succeeded")
+	}
+	if got := files(t, dir); len(got) != 0 {
+		t.Errorf("left %v behind, want nothing until the download is complete", got)
+	}
+}
+
+func TestEvict(t *testing.T) {
+	s, ts := newServer(t)
+	for _, key := range []string{"a", "b", "c"} {
+		s.bodies["/"+key+".png"] = png(1000)
+	}
+	dir := t.TempDir()
+	c, err := New(dir, 2500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(key string) {
+		t.Helper()
+		if _, err := c.Get(key, []Image{{ts.URL + "/" + key + ".png", 320, 180}}, 320, 180); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get("a")
+	get("b")
+	get("a")
+	get("c")
+
+	got := strings.Join(files(t, dir), " ")
+	if got != "a_320x180.png c_320x180.png" {
+		t.Errorf("got %v, want the least recently used evicted", got)
+	}
+
+	// a new cache picks up the files, a smaller limit evicts the older one
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "a_320x180.png"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(dir, 1500); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(files(t, dir), " "); got != "c_320x180.png" {
+		t.Errorf("got %v after reopening, want the oldest evicted", got)
+	}
+}
@@ -0,0 +1,259 @@
+package vlc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultHTTPAddr = "localhost:8080"
+
+// Backend is a connection to VLC, either through the RC socket or the HTTP interface
+type Backend interface {
+	Add(uri string) error
+	Enqueue(uri string) error
+	Clear() error
+	Play() error
+	Pause() error
+	Stop() error
+	Next() error
+	Seek(seconds int) error
+	Volume(volume int) error
+	GetVolume() (int, error)
+	Status() (Status, error)
+	Playlist() ([]PlaylistItem, error)
+	Close() error
+}
+
+var (
+	_ Backend = (*Client)(nil)
+	_ Backend = (*HTTPClient)(nil)
+	_ Backend = (*Supervisor)(nil)
+)
+
+// HTTPClient talks to VLC's built in web interface, it needs the http interface
+// enabled with a password (vlc --extraintf http --http-password <password>)
+type HTTPClient struct {
+	addr     string
+	password string
+	client   *http.Client
+}
+
+type httpStatus struct {
+	State       string  `json:"state"`
+	Time        float64 `json:"time"`
+	Length      float64 `json:"length"`
+	Volume      float64 `json:"volume"`
+	CurrentPlID int     `json:"currentplid"`
+}
+
+type httpPlaylistNode struct {
+	ID       string             `json:"id"`
+	Name     string             `json:"name"`
+	URI      string             `json:"uri"`
+	Duration float64            `json:"duration"`
+	Current  string             `json:"current"`
+	Type     string             `json:"type"`
+	Children []httpPlaylistNode `json:"children"`
+}
+
+// DialHTTP checks that the web interface is reachable and the password is accepted
+func DialHTTP(addr, password string, timeout time.Duration) (*HTTPClient, error) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	c := &HTTPClient{
+		addr:     addr,
+		password: password,
+		client:   &http.Client{Timeout: timeout},
+	}
+
+	var s httpStatus
+	if err := c.request("", nil, &s); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *HTTPClient) Close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+/////////////// Commands
+
+func (c *HTTPClient) Add(uri string) error {
+	return c.command("in_play", url.Values{"input": {uri}})
+}
+
+func (c *HTTPClient) Enqueue(uri string) error {
+	return c.command("in_enqueue", url.Values{"input": {uri}})
+}
+
+func (c *HTTPClient) Clear() error {
+	return c.command("pl_empty", nil)
+}
+
+func (c *HTTPClient) Play() error {
+	return c.command("pl_play", nil)
+}
+
+// Pause toggles pause
+func (c *HTTPClient) Pause() error {
+	return c.command("pl_pause", nil)
+}
+
+func (c *HTTPClient) Stop() error {
+	return c.command("pl_stop", nil)
+}
+
+func (c *HTTPClient) Next() error {
+	return c.command("pl_next", nil)
+}
+
+// Seek jumps to a position in seconds
+func (c *HTTPClient) Seek(seconds int) error {
+	return c.command("seek", url.Values{"val": {strconv.Itoa(seconds)}})
+}
+
+// Volume sets the volume, 0-512 where 256 is 100%
+func (c *HTTPClient) Volume(volume int) error {
+	return c.command("volume", url.Values{"val": {strconv.Itoa(volume)}})
+}
+
+func (c *HTTPClient) GetVolume() (int, error) {
+	var s httpStatus
+	if err := c.request("", nil, &s); err != nil {
+		return 0, err
+	}
+	return int(s.Volume), nil
+}
+
+// Status returns the current playback status, the input comes from the current playlist item
+func (c *HTTPClient) Status() (Status, error) {
+	var s httpStatus
+	if err := c.request("", nil, &s); err != nil {
+		return Status{}, err
+	}
+
+	st := Status{
+		Volume: int(s.Volume),
+		Time:   s.Time,
+		Length: s.Length,
+	}
+
+	switch s.State {
+	case "playing":
+		st.State = StatePlaying
+	case "paused":
+		st.State = StatePaused
+	case "stopped":
+		st.State = StateEnded
+	}
+
+	if s.CurrentPlID >= 0 {
+		var root httpPlaylistNode
+		if err := c.get("/requests/playlist.json", nil, &root); err != nil {
+			return st, err
+		}
+		if item, ok := findPlaylistItem(root, strconv.Itoa(s.CurrentPlID)); ok {
+			st.Input = item.URI
+		}
+	}
+
+	return st, nil
+}
+
+// Playlist returns the items in the playlist, not the media library
+func (c *HTTPClient) Playlist() ([]PlaylistItem, error) {
+	var root httpPlaylistNode
+	if err := c.get("/requests/playlist.json", nil, &root); err != nil {
+		return nil, err
+	}
+
+	list := make([]PlaylistItem, 0)
+	for _, node := range root.Children {
+		if node.Name != "Playlist" {
+			continue
+		}
+		for _, item := range node.Children {
+			id, _ := strconv.Atoi(item.ID)
+			list = append(list, PlaylistItem{
+				ID:       id,
+				Name:     item.Name,
+				Duration: item.Duration,
+				Current:  item.Current == "current",
+			})
+		}
+	}
+
+	return list, nil
+}
+
+/////////////// Requests
+
+func (c *HTTPClient) command(cmd string, params url.Values) error {
+	var s httpStatus
+	return c.request(cmd, params, &s)
+}
+
+func (c *HTTPClient) request(cmd string, params url.Values, out interface{}) error {
+	if params == nil {
+		params = url.Values{}
+	}
+	if cmd != "" {
+		params.Set("command", cmd)
+	}
+	return c.get("/requests/status.json", params, out)
+}
+
+func (c *HTTPClient) get(path string, params url.Values, out interface{}) error {
+	u := url.URL{Scheme: "http", Host: c.addr, Path: path}
+	if params != nil {
+		// vlc expects %20 rather than + for spaces in uris
+		u.RawQuery = strings.ReplaceAll(params.Encode(), "+", "%20")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth("", c.password)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vlc http request failed: %v: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("vlc http password rejected")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("vlc http request failed: %v: %v", path, resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode vlc response: %v: %v", path, err)
+	}
+
+	return nil
+}
+
+func findPlaylistItem(node httpPlaylistNode, id string) (httpPlaylistNode, bool) {
+	if node.ID == id && node.Type == "leaf" {
+		return node, true
+	}
+	for _, child := range node.Children {
+		if item, ok := findPlaylistItem(child, id); ok {
+			return item, true
+		}
+	}
+	return httpPlaylistNode{}, false
+}
@@ -0,0 +1,186 @@
+package vlc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testPassword = "hunter2"
+
+// fakeHTTP is vlc's web interface with a playlist holding two items, the second playing
+type fakeHTTP struct {
+	mu       sync.Mutex
+	commands []string // command and the raw query it came with
+	status   httpStatus
+}
+
+func newFakeHTTP(t *testing.T) (*HTTPClient, *fakeHTTP) {
+	f := &fakeHTTP{status: httpStatus{State: "playing", Time: 42, Length: 600, Volume: 256, CurrentPlID: 5}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	c, err := DialHTTP(strings.TrimPrefix(srv.URL, "http://"), testPassword, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, f
+}
+
+func (f *fakeHTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, p, ok := r.BasicAuth(); !ok || p != testPassword {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/requests/status.json":
+		if cmd := r.URL.Query().Get("command"); cmd != "" {
+			f.commands = append(f.commands, r.URL.RawQuery)
+		}
+		json.NewEncoder(w).Encode(f.status)
+	case "/requests/playlist.json":
+		json.NewEncoder(w).Encode(httpPlaylistNode{ID: "1", Name: "", Type: "node", Children: []httpPlaylistNode{
+			{ID: "2", Name: "Playlist", Type: "node", Children: []httpPlaylistNode{
+				{ID: "4", Name: "song.mp3", URI: "file:///E:/bgm/song.mp3", Duration: 210, Type: "leaf"},
+				{ID: "5", Name: "stream", URI: "https://www.youtube.com/watch?v=abcdefghijk", Type: "leaf", Current: "current"},
+			}},
+			{ID: "3", Name: "Media Library", Type: "node", Children: []httpPlaylistNode{
+				{ID: "6", Name: "other.mp3", URI: "file:///E:/bgm/other.mp3", Duration: 60, Type: "leaf"},
+			}},
+		}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestHTTPPassword(t *testing.T) {
+	srv := httptest.NewServer(&fakeHTTP{})
+	defer srv.Close()
+
+	_, err := DialHTTP(strings.TrimPrefix(srv.URL, "http://"), "wrong", 0)
+	if err == nil || !strings.Contains(err.Error(), "password rejected") {
+		t.Errorf("got %v, want the password rejected", err)
+	}
+}
+
+func TestHTTPCommands(t *testing.T) {
+	c, f := newFakeHTTP(t)
+
+	tests := []struct {
+		run  func() error
+		want string
+	}{
+		{func() error { return c.Add("E:/bgm/my song.mp3") }, "command=in_play&input=E%3A%2Fbgm%2Fmy%20song.mp3"},
+		{func() error { return c.Enqueue("https://youtu.be/abcdefghijk") }, "command=in_enqueue&input=https%3A%2F%2Fyoutu.be%2Fabcdefghijk"},
+		{c.Clear, "command=pl_empty"},
+		{c.Play, "command=pl_play"},
+		{c.Pause, "command=pl_pause"},
+		{c.Stop, "command=pl_stop"},
+		{c.Next, "command=pl_next"},
+		{func() error { return c.Seek(90) }, "command=seek&val=90"},
+		{func() error { return c.Volume(128) }, "command=volume&val=128"},
+	}
+	for _, tt := range tests {
+		if err := tt.run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.commands) != len(tests) {
+		t.Fatalf("got %q", f.commands)
+	}
+	for i, tt := range tests {
+		if f.commands[i] != tt.want {
+			t.Errorf("got %v, want %v", f.commands[i], tt.want)
+		}
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	c, f := newFakeHTTP(t)
+
+	s, err := c.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Status{State: StatePlaying, Input: "https://www.youtube.com/watch?v=abcdefghijk", Volume: 256, Time: 42, Length: 600}
+	if s != want {
+		t.Errorf("got %+v, want %+v", s, want)
+	}
+
+	f.mu.Lock()
+	f.status = httpStatus{State: "stopped", CurrentPlID: -1}
+	f.mu.Unlock()
+
+	s, err = c.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.State != StateEnded || s.Input != "" {
+		t.Errorf("got %+v, want stopped with no input", s)
+	}
+
+	v, err := c.GetVolume()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 0 {
+		t.Errorf("got volume %v, want 0", v)
+	}
+}
+
+func TestHTTPPlaylist(t *testing.T) {
+	c, _ := newFakeHTTP(t)
+
+	list, err := c.Playlist()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PlaylistItem{
+		{ID: 4, Name: "song.mp3", Duration: 210},
+		{ID: 5, Name: "stream", Current: true},
+	}
+	if len(list) != len(want) {
+		t.Fatalf("got %+v, want %+v", list, want)
+	}
+	for i := range want {
+		if list[i] != want[i] {
+			t.Errorf("%d: got %+v, want %+v", i, list[i], want[i])
+		}
+	}
+}
+
+func TestHTTPErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("command") == "" {
+			w.Write([]byte(`{"state":"stopped"}`))
+			return
+		}
+		if r.URL.Query().Get("command") == "pl_play" {
+			w.Write([]byte("<html>not json</html>"))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	c, err := DialHTTP(strings.TrimPrefix(srv.URL, "http://"), testPassword, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Stop(); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("got %v, want the status code", err)
+	}
+	if err := c.Play(); err == nil || !strings.Contains(err.Error(), "decode") {
+		t.Errorf("got %v, want a decode error", err)
+	}
+}
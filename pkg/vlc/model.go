@@ -0,0 +1,53 @@
+package vlc
+
+// State is the input state reported by VLC's "play state" status changes
+type State int
+
+const (
+	StateInit    State = 0
+	StateOpening State = 1
+	StatePlaying State = 3
+	StatePaused  State = 4
+	StateEnded   State = 5
+	StateError   State = 6
+)
+
+// Active returns true if something is loaded and not ended
+func (s State) Active() bool {
+	return s > StateInit && s != StateEnded && s != StateError
+}
+
+func (s State) String() string {
+	switch s {
+	case StateInit:
+		return "stopped"
+	case StateOpening:
+		return "opening"
+	case StatePlaying:
+		return "playing"
+	case StatePaused:
+		return "paused"
+	case StateEnded:
+		return "ended"
+	case StateError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// Status is the playback status of VLC
+type Status struct {
+	State  State   `json:"state"`
+	Input  string  `json:"input"`
+	Volume int     `json:"volume"` // 0-512, 256 is 100%
+	Time   float64 `json:"time"`   // seconds
+	Length float64 `json:"length"` // seconds
+}
+
+// PlaylistItem is a single entry in VLC's playlist
+type PlaylistItem struct {
+	ID       int     `json:"id"`
+	Name     string  `json:"name"`
+	Duration float64 `json:"duration"` // seconds
+	Current  bool    `json:"current"`
+}
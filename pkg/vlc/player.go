@@ -0,0 +1,114 @@
+package vlc
+
+import (
+	"sync"
+
+	"github.com/BlunterMonk/StreamNotify/pkg/player"
+)
+
+var _ player.Player = (*Player)(nil)
+var _ player.VolumeController = (*Player)(nil)
+var _ player.Seeker = (*Player)(nil)
+
+// Player plays through a VLC backend, usually a Supervisor
+type Player struct {
+	backend Backend
+
+	mu   sync.Mutex
+	last player.Status
+}
+
+func NewPlayer(backend Backend) *Player {
+	return &Player{backend: backend}
+}
+
+// Backend returns the VLC connection for commands the player interface doesn't cover
+func (p *Player) Backend() Backend {
+	return p.backend
+}
+
+func (p *Player) PlayURL(url string) error {
+	return p.replace(url)
+}
+
+func (p *Player) PlayFile(path string) error {
+	return p.replace(path)
+}
+
+// Stop clears the playlist so nothing resumes
+func (p *Player) Stop() error {
+	return p.backend.Clear()
+}
+
+func (p *Player) Status() (player.Status, error) {
+	s, err := p.backend.Status()
+	if err != nil {
+		return player.Status{}, err
+	}
+
+	st := PlayerStatus(s)
+
+	p.mu.Lock()
+	p.last = st
+	p.mu.Unlock()
+
+	return st, nil
+}
+
+func (p *Player) NowPlaying() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.last.State.Active() {
+		return ""
+	}
+	return p.last.Input
+}
+
+func (p *Player) Seek(seconds int) error {
+	return p.backend.Seek(seconds)
+}
+
+// SetVolume sets the volume as a percentage, vlc itself goes from 0 to 512 where 256 is 100%
+func (p *Player) SetVolume(volume int) error {
+	return p.backend.Volume(volume * 256 / 100)
+}
+
+// GetVolume returns the volume as a percentage
+func (p *Player) GetVolume() (int, error) {
+	v, err := p.backend.GetVolume()
+	return v * 100 / 256, err
+}
+
+func (p *Player) Close() error {
+	return p.backend.Close()
+}
+
+// replace stops the current video and starts the new one
+func (p *Player) replace(input string) error {
+	if err := p.backend.Clear(); err != nil {
+		return err
+	}
+	return p.backend.Add(input)
+}
+
+// PlayerStatus converts the vlc status into the status shared by every player
+func PlayerStatus(s Status) player.Status {
+	st := player.StateStopped
+	switch s.State {
+	case StateOpening:
+		st = player.StateOpening
+	case StatePlaying:
+		st = player.StatePlaying
+	case StatePaused:
+		st = player.StatePaused
+	}
+
+	return player.Status{
+		State:   st,
+		Input:   s.Input,
+		VideoID: player.VideoID(s.Input),
+		Time:    s.Time,
+		Length:  s.Length,
+	}
+}
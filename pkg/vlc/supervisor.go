@@ -0,0 +1,339 @@
+package vlc
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultStallTimeout = 30 * time.Second
+
+	// failed status requests in a row before vlc is considered hung
+	maxFailedStatus = 3
+
+	connectAttempts = 5
+	restartBackoff  = 2 * time.Second
+	maxBackoff      = 5 * time.Minute
+
+	// a connection that lasts this long resets the restart backoff
+	healthyAfter = 5 * time.Minute
+)
+
+var ErrRestartPending = errors.New("vlc is down, waiting to restart")
+
+// Supervisor keeps a connection to VLC alive, restarting VLC when the connection drops
+// or playback stalls and restoring whatever was playing before
+type Supervisor struct {
+	StallTimeout time.Duration
+
+	dial  func() (Backend, error) // connects to a running vlc
+	start func() error            // launches vlc
+	kill  func() error            // stops a hung vlc, optional
+
+	mu           sync.Mutex
+	client       Backend
+	last         Status
+	lastProgress time.Time
+	connectedAt  time.Time
+	failedStatus int
+	failures     int
+	restarts     int
+	restarting   bool
+	nextAttempt  time.Time
+}
+
+func NewSupervisor(dial func() (Backend, error), start func() error, kill func() error) *Supervisor {
+	return &Supervisor{
+		StallTimeout: DefaultStallTimeout,
+		dial:         dial,
+		start:        start,
+		kill:         kill,
+	}
+}
+
+// Connect connects to VLC, starting it if it isn't running
+func (s *Supervisor) Connect() error {
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.setClient(c)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Supervisor) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client == nil {
+		return nil
+	}
+	return s.client.Close()
+}
+
+// Status polls VLC and checks that it's still healthy, this should be called regularly
+func (s *Supervisor) Status() (Status, error) {
+	st, reason, err := s.check()
+	if reason != "" {
+		return st, s.restart(reason)
+	}
+	return st, err
+}
+
+// check polls VLC and returns why it needs a restart, if it does.
+// The poll runs without the lock so a slow vlc doesn't hold up commands
+func (s *Supervisor) check() (Status, string, error) {
+	s.mu.Lock()
+	if s.restarting {
+		s.mu.Unlock()
+		return Status{}, "", ErrRestartPending
+	}
+	client := s.client
+	s.mu.Unlock()
+
+	if client == nil {
+		return Status{}, "not connected", nil
+	}
+
+	// the rc socket reports when it's closed, the http interface only fails requests
+	if c, ok := client.(*Client); ok {
+		select {
+		case <-c.Done():
+			return Status{}, fmt.Sprintf("connection lost: %v", c.Err()), nil
+		default:
+		}
+	}
+
+	st, err := client.Status()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// vlc was restarted while polling, the next check polls the new one
+	if s.client != client {
+		return Status{}, "", ErrRestartPending
+	}
+
+	if err != nil {
+		s.failedStatus++
+		if s.failedStatus >= maxFailedStatus {
+			return st, fmt.Sprintf("not responding: %v", err), nil
+		}
+		return st, "", err
+	}
+	s.failedStatus = 0
+
+	now := time.Now()
+	if now.Sub(s.connectedAt) > healthyAfter {
+		s.failures = 0
+	}
+
+	// a playing input whose time doesn't move is stuck
+	if st.State == StatePlaying && st.Input == s.last.Input && st.Time == s.last.Time {
+		if now.Sub(s.lastProgress) > s.StallTimeout {
+			return st, "playback stalled", nil
+		}
+	} else {
+		s.lastProgress = now
+	}
+	s.last = st
+
+	return st, "", nil
+}
+
+/////////////// Commands
+
+func (s *Supervisor) Add(uri string) error {
+	return s.do(func(c Backend) error { return c.Add(uri) })
+}
+
+func (s *Supervisor) Enqueue(uri string) error {
+	return s.do(func(c Backend) error { return c.Enqueue(uri) })
+}
+
+func (s *Supervisor) Clear() error {
+	return s.do(func(c Backend) error { return c.Clear() })
+}
+
+func (s *Supervisor) Play() error {
+	return s.do(func(c Backend) error { return c.Play() })
+}
+
+func (s *Supervisor) Pause() error {
+	return s.do(func(c Backend) error { return c.Pause() })
+}
+
+func (s *Supervisor) Stop() error {
+	return s.do(func(c Backend) error { return c.Stop() })
+}
+
+func (s *Supervisor) Next() error {
+	return s.do(func(c Backend) error { return c.Next() })
+}
+
+func (s *Supervisor) Seek(seconds int) error {
+	return s.do(func(c Backend) error { return c.Seek(seconds) })
+}
+
+func (s *Supervisor) Volume(volume int) error {
+	return s.do(func(c Backend) error { return c.Volume(volume) })
+}
+
+func (s *Supervisor) GetVolume() (int, error) {
+	var v int
+	err := s.do(func(c Backend) error {
+		var err error
+		v, err = c.GetVolume()
+		return err
+	})
+	return v, err
+}
+
+func (s *Supervisor) Playlist() ([]PlaylistItem, error) {
+	var list []PlaylistItem
+	err := s.do(func(c Backend) error {
+		var err error
+		list, err = c.Playlist()
+		return err
+	})
+	return list, err
+}
+
+// do runs a command on the current connection, a lost connection is picked up by the next Status
+func (s *Supervisor) do(fn func(c Backend) error) error {
+	s.mu.Lock()
+	c := s.client
+	s.mu.Unlock()
+
+	if c == nil {
+		return ErrRestartPending
+	}
+	return fn(c)
+}
+
+/////////////// Restarting
+
+// connect dials vlc, starting it if it isn't running. It's called without the lock
+// so commands and status checks fail fast instead of waiting out the retries.
+func (s *Supervisor) connect() (Backend, error) {
+	c, err := s.dial()
+	if err == nil {
+		return c, nil
+	}
+	log.Println("vlc not running, trying to connect")
+
+	for i := 0; i < connectAttempts; i++ {
+		if err = s.start(); err != nil {
+			log.Println("failed to start vlc:", err)
+			continue
+		}
+		time.Sleep(time.Second)
+
+		c, err = s.dial()
+		if err != nil {
+			log.Println("failed to connect to vlc:", err)
+			continue
+		}
+		return c, nil
+	}
+	return nil, err
+}
+
+// setClient must be called with the lock held
+func (s *Supervisor) setClient(c Backend) {
+	s.client = c
+	s.connectedAt = time.Now()
+	s.lastProgress = s.connectedAt
+	s.failedStatus = 0
+}
+
+// restart replaces vlc and puts back what was playing, only one restart runs at a time
+func (s *Supervisor) restart(reason string) error {
+	s.mu.Lock()
+	now := time.Now()
+	if s.restarting || now.Before(s.nextAttempt) {
+		s.mu.Unlock()
+		return ErrRestartPending
+	}
+
+	s.restarting = true
+	s.restarts++
+	s.failures++
+	log.Printf("vlc %v, restarting (restart #%d)\n", reason, s.restarts)
+
+	old := s.client
+	s.client = nil
+	last := s.last
+	s.mu.Unlock()
+
+	// ask a hung vlc to quit before starting another
+	if old != nil {
+		if c, ok := old.(*Client); ok {
+			c.Command("shutdown")
+		}
+		old.Close()
+	}
+	if s.kill != nil {
+		if err := s.kill(); err != nil {
+			log.Println("failed to stop vlc:", err)
+		}
+	}
+
+	c, err := s.connect()
+
+	s.mu.Lock()
+	s.restarting = false
+	s.nextAttempt = now.Add(backoff(s.failures))
+	if err != nil {
+		next := s.nextAttempt
+		s.mu.Unlock()
+		return fmt.Errorf("failed to restart vlc, next attempt at %v: %v", next.Format(time.Kitchen), err)
+	}
+	s.setClient(c)
+	s.mu.Unlock()
+
+	// put back what was playing, live streams have no length so they start at the live edge
+	if last.State.Active() && last.Input != "" {
+		log.Println("resuming playback:", last.Input)
+		if err := c.Add(last.Input); err != nil {
+			return fmt.Errorf("failed to resume playback: %v", err)
+		}
+		if last.Length > 0 && last.Time > 0 {
+			if err := seekWhenPlaying(c, int(last.Time)); err != nil {
+				log.Println("failed to seek resumed playback:", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// seekWhenPlaying waits for vlc to open the input before seeking, seeks sent while it's opening are lost
+func seekWhenPlaying(c Backend, seconds int) error {
+	for i := 0; i < 20; i++ {
+		st, err := c.Status()
+		if err == nil && st.State == StatePlaying && st.Length > 0 {
+			return c.Seek(seconds)
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+
+	return errors.New("timed out waiting for vlc to open the input")
+}
+
+func backoff(failures int) time.Duration {
+	d := restartBackoff
+	for i := 1; i < failures && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
@@ -0,0 +1,208 @@
+package vlc
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBackend opens whatever is added after a few status polls
+type fakeBackend struct {
+	mu     sync.Mutex
+	status Status
+	polls  int
+	cmds   []string
+	broken bool
+	hang   chan struct{} // status polls send on it when they start and wait for a reply
+}
+
+func (f *fakeBackend) record(cmd string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cmds = append(f.cmds, cmd)
+	return nil
+}
+
+func (f *fakeBackend) Add(uri string) error {
+	f.mu.Lock()
+	f.status = Status{State: StateOpening, Input: uri}
+	f.polls = 0
+	f.mu.Unlock()
+	return f.record("add " + uri)
+}
+
+func (f *fakeBackend) Seek(seconds int) error {
+	f.mu.Lock()
+	opened := f.status.State == StatePlaying
+	f.mu.Unlock()
+	if !opened {
+		return f.record("lost seek")
+	}
+	return f.record("seek")
+}
+
+func (f *fakeBackend) Status() (Status, error) {
+	f.mu.Lock()
+	hang := f.hang
+	f.mu.Unlock()
+	if hang != nil {
+		hang <- struct{}{}
+		<-hang
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.broken {
+		return Status{}, errors.New("broken")
+	}
+	f.polls++
+	if f.status.State == StateOpening && f.polls > 2 {
+		f.status.State = StatePlaying
+		f.status.Length = 600
+	}
+	return f.status, nil
+}
+
+func (f *fakeBackend) Enqueue(uri string) error          { return f.record("enqueue") }
+func (f *fakeBackend) Clear() error                      { return f.record("clear") }
+func (f *fakeBackend) Play() error                       { return f.record("play") }
+func (f *fakeBackend) Pause() error                      { return f.record("pause") }
+func (f *fakeBackend) Stop() error                       { return f.record("stop") }
+func (f *fakeBackend) Next() error                       { return f.record("next") }
+func (f *fakeBackend) Volume(volume int) error           { return f.record("volume") }
+func (f *fakeBackend) GetVolume() (int, error)           { return 256, nil }
+func (f *fakeBackend) Playlist() ([]PlaylistItem, error) { return nil, nil }
+func (f *fakeBackend) Close() error                      { return nil }
+
+func TestRestartSeeksOncePlaying(t *testing.T) {
+	first := &fakeBackend{status: Status{State: StatePlaying, Input: "video.mp4", Time: 120, Length: 600}}
+	second := &fakeBackend{}
+
+	backends := []*fakeBackend{first, second}
+	s := NewSupervisor(func() (Backend, error) {
+		b := backends[0]
+		backends = backends[1:]
+		return b, nil
+	}, func() error { return nil }, nil)
+
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Status(); err != nil {
+		t.Fatal(err)
+	}
+
+	first.mu.Lock()
+	first.broken = true
+	first.mu.Unlock()
+	for i := 0; i < maxFailedStatus; i++ {
+		s.Status()
+	}
+
+	s.mu.Lock()
+	restarts := s.restarts
+	s.mu.Unlock()
+	if restarts != 1 {
+		t.Fatalf("got %d restarts, want 1", restarts)
+	}
+	second.mu.Lock()
+	defer second.mu.Unlock()
+	want := []string{"add video.mp4", "seek"}
+	if len(second.cmds) != len(want) || second.cmds[0] != want[0] || second.cmds[1] != want[1] {
+		t.Errorf("got %q, want %q", second.cmds, want)
+	}
+}
+
+func TestRestartDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	dials := 0
+	s := NewSupervisor(func() (Backend, error) {
+		dials++
+		if dials > 1 {
+			<-release
+		}
+		return &fakeBackend{}, nil
+	}, func() error { return nil }, nil)
+
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	s.client = nil
+	s.mu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Status()
+		done <- err
+	}()
+
+	// wait for the restart to start dialing
+	for {
+		s.mu.Lock()
+		r := s.restarting
+		s.mu.Unlock()
+		if r {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	checked := make(chan error, 1)
+	go func() {
+		_, err := s.Status()
+		checked <- err
+	}()
+	select {
+	case err := <-checked:
+		if !errors.Is(err, ErrRestartPending) {
+			t.Errorf("got %v, want restart pending", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("status blocked on the restart")
+	}
+	if err := s.Volume(100); !errors.Is(err, ErrRestartPending) {
+		t.Errorf("got %v, want restart pending", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSlowStatusDoesNotBlock(t *testing.T) {
+	hang := make(chan struct{})
+	b := &fakeBackend{hang: hang}
+	s := NewSupervisor(func() (Backend, error) { return b, nil }, func() error { return nil }, nil)
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Status()
+		done <- err
+	}()
+
+	// the poll reached vlc
+	<-hang
+
+	volume := make(chan error, 1)
+	go func() { volume <- s.Volume(100) }()
+	select {
+	case err := <-volume:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a command waited for the status poll")
+	}
+
+	hang <- struct{}{}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,438 @@
+package vlc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAddr    = "localhost:4212"
+	DefaultTimeout = 5 * time.Second
+
+	statusChangePrefix = "status change:"
+)
+
+var (
+	ErrClosed  = errors.New("vlc connection closed")
+	ErrTimeout = errors.New("timed out waiting for vlc")
+)
+
+var (
+	inputRegex    = regexp.MustCompile(`\( new input: (.*) \)`)
+	stateRegex    = regexp.MustCompile(`\( \w+ state: (\d+) \)`)
+	stateNameRe   = regexp.MustCompile(`\( state (\w+) \)`)
+	volumeRegex   = regexp.MustCompile(`\( audio volume: (\d+) \)`)
+	returnedRegex = regexp.MustCompile(`^(\S+): returned (-?\d+) \((.*)\)$`)
+	playlistRegex = regexp.MustCompile(`^\|(\s+)(\*?)(\d+) - (.+?)(?: \((\d+:\d+:\d+)\))?(?: \[played \d+ times?\])?$`)
+)
+
+// Client talks to VLC's RC interface, commands are sent one at a time and
+// each response is matched to its command by the prompt VLC prints when it's done
+type Client struct {
+	conn    net.Conn
+	timeout time.Duration
+
+	// cmdMu serializes commands so responses can't interleave
+	cmdMu sync.Mutex
+
+	mu       sync.Mutex
+	pending  []chan []string // waiting for a prompt, in the order commands were sent
+	status   Status          // updated from asynchronous status changes
+	volumeAt int             // status changes that reported a volume, so GetVolume can tell a fresh one
+	onChange func(Status)
+	err      error
+	done     chan struct{}
+}
+
+// Dial connects to a running VLC RC interface
+func Dial(addr string, timeout time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClient(conn, timeout), nil
+}
+
+// NewClient wraps an open RC connection, the greeting VLC sends on connect is skipped
+func NewClient(conn net.Conn, timeout time.Duration) *Client {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	c := &Client{
+		conn:    conn,
+		timeout: timeout,
+		done:    make(chan struct{}),
+	}
+
+	// the greeting ends with the first prompt, treat it as a response nobody asked for
+	greeting := make(chan []string, 1)
+	c.pending = append(c.pending, greeting)
+
+	go c.read()
+
+	select {
+	case <-greeting:
+	case <-c.done:
+	case <-time.After(timeout):
+	}
+
+	return c
+}
+
+// Close closes the connection to VLC
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Done is closed when the connection to VLC is lost
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the reason the connection was lost
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Watch sets a function called with the latest status every time VLC reports a status change
+func (c *Client) Watch(fn func(Status)) {
+	c.mu.Lock()
+	c.onChange = fn
+	c.mu.Unlock()
+}
+
+/////////////// Commands
+
+// Add adds the item to the playlist and starts playing it
+func (c *Client) Add(uri string) error {
+	_, err := c.Command("add " + uri)
+	return err
+}
+
+// Enqueue adds the item to the end of the playlist
+func (c *Client) Enqueue(uri string) error {
+	_, err := c.Command("enqueue " + uri)
+	return err
+}
+
+func (c *Client) Clear() error {
+	_, err := c.Command("clear")
+	return err
+}
+
+func (c *Client) Play() error {
+	_, err := c.Command("play")
+	return err
+}
+
+// Pause toggles pause
+func (c *Client) Pause() error {
+	_, err := c.Command("pause")
+	return err
+}
+
+func (c *Client) Stop() error {
+	_, err := c.Command("stop")
+	return err
+}
+
+func (c *Client) Next() error {
+	_, err := c.Command("next")
+	return err
+}
+
+// Seek jumps to a position in seconds
+func (c *Client) Seek(seconds int) error {
+	_, err := c.Command(fmt.Sprintf("seek %d", seconds))
+	return err
+}
+
+// Volume sets the volume, 0-512 where 256 is 100%
+func (c *Client) Volume(volume int) error {
+	_, err := c.Command(fmt.Sprintf("volume %d", volume))
+	return err
+}
+
+// GetVolume returns the current volume, 0-512 where 256 is 100%
+func (c *Client) GetVolume() (int, error) {
+	c.mu.Lock()
+	seen := c.volumeAt
+	c.mu.Unlock()
+
+	lines, err := c.Command("volume")
+	if err != nil {
+		return 0, err
+	}
+	if n, err := parseVolume(lines); err == nil {
+		return n, nil
+	}
+
+	// some versions answer with a status change, which is read into the status instead of the response
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.volumeAt != seen {
+		return c.status.Volume, nil
+	}
+	return 0, errors.New("vlc did not return the volume")
+}
+
+// Status returns the current playback status
+func (c *Client) Status() (Status, error) {
+	var s Status
+
+	lines, err := c.Command("status")
+	if err != nil {
+		return s, err
+	}
+
+	for _, line := range lines {
+		parseStatusLine(&s, line)
+	}
+
+	// time and length are only meaningful when something is loaded
+	if s.Input != "" {
+		if t, err := c.Command("get_time"); err == nil {
+			n, _ := parseInt(t)
+			s.Time = float64(n)
+		}
+		if l, err := c.Command("get_length"); err == nil {
+			n, _ := parseInt(l)
+			s.Length = float64(n)
+		}
+	}
+
+	c.mu.Lock()
+	c.status = s
+	c.mu.Unlock()
+
+	return s, nil
+}
+
+// Playlist returns the items in the playlist, not the media library
+func (c *Client) Playlist() ([]PlaylistItem, error) {
+	lines, err := c.Command("playlist")
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePlaylist(lines), nil
+}
+
+// Command sends a raw RC command and returns the lines VLC responded with
+func (c *Client) Command(cmd string) ([]string, error) {
+	c.cmdMu.Lock()
+	defer c.cmdMu.Unlock()
+
+	res := make(chan []string, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.pending = append(c.pending, res)
+	c.mu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	if _, err := c.conn.Write([]byte(cmd + "\n")); err != nil {
+		c.mu.Lock()
+		for i, p := range c.pending {
+			if p == res {
+				c.pending = append(c.pending[:i], c.pending[i+1:]...)
+				break
+			}
+		}
+		c.mu.Unlock()
+		return nil, fmt.Errorf("failed to send vlc command: %v: %w", cmd, err)
+	}
+
+	// a late response still goes to this channel, so the next command can't receive it
+	select {
+	case lines := <-res:
+		return lines, responseError(cmd, lines)
+	case <-c.done:
+		return nil, c.Err()
+	case <-time.After(c.timeout):
+		return nil, fmt.Errorf("%w: %v", ErrTimeout, cmd)
+	}
+}
+
+/////////////// Reading
+
+func (c *Client) read() {
+	r := bufio.NewReader(c.conn)
+	lines := make([]string, 0)
+
+	var err error
+	for {
+		// a prompt means the previous command is done, the next output can follow it on the same line
+		var p []byte
+		p, err = r.Peek(2)
+		if err != nil {
+			break
+		}
+		if string(p) == "> " {
+			r.Discard(2)
+			c.respond(lines)
+			lines = make([]string, 0)
+			continue
+		}
+
+		var line string
+		line, err = r.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" {
+			if strings.HasPrefix(line, statusChangePrefix) {
+				c.statusChange(line)
+			} else {
+				lines = append(lines, line)
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	c.mu.Lock()
+	c.err = fmt.Errorf("%w: %v", ErrClosed, err)
+	c.mu.Unlock()
+	close(c.done)
+}
+
+func (c *Client) respond(lines []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.pending) == 0 {
+		return
+	}
+
+	res := c.pending[0]
+	c.pending = c.pending[1:]
+	res <- lines
+}
+
+func (c *Client) statusChange(line string) {
+	c.mu.Lock()
+	before := c.status
+	parseStatusLine(&c.status, line)
+	if volumeRegex.MatchString(line) {
+		c.volumeAt++
+	}
+	s := c.status
+	fn := c.onChange
+	c.mu.Unlock()
+
+	if fn != nil && s != before {
+		fn(s)
+	}
+}
+
+/////////////// Parsing
+
+func parseStatusLine(s *Status, line string) {
+	if m := inputRegex.FindStringSubmatch(line); m != nil {
+		s.Input = m[1]
+	}
+	if m := stateRegex.FindStringSubmatch(line); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		s.State = State(n)
+	}
+	if m := stateNameRe.FindStringSubmatch(line); m != nil {
+		switch m[1] {
+		case "playing":
+			s.State = StatePlaying
+		case "paused":
+			s.State = StatePaused
+		case "opening":
+			s.State = StateOpening
+		case "stopped":
+			s.State = StateEnded
+		}
+	}
+	if m := volumeRegex.FindStringSubmatch(line); m != nil {
+		s.Volume, _ = strconv.Atoi(m[1])
+	}
+}
+
+func parsePlaylist(lines []string) []PlaylistItem {
+	list := make([]PlaylistItem, 0)
+
+	inPlaylist := false
+	for _, line := range lines {
+		m := playlistRegex.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		// top level nodes are the playlist and the media library
+		if len(m[1]) == 1 {
+			inPlaylist = m[4] == "Playlist"
+			continue
+		}
+		if !inPlaylist {
+			continue
+		}
+
+		id, _ := strconv.Atoi(m[3])
+		list = append(list, PlaylistItem{
+			ID:       id,
+			Name:     m[4],
+			Duration: parseDuration(m[5]),
+			Current:  m[2] == "*",
+		})
+	}
+
+	return list
+}
+
+// parseDuration converts hh:mm:ss to seconds
+func parseDuration(d string) float64 {
+	var h, m, s int
+	if _, err := fmt.Sscanf(d, "%d:%d:%d", &h, &m, &s); err != nil {
+		return 0
+	}
+	return float64(h*3600 + m*60 + s)
+}
+
+func parseInt(lines []string) (int, error) {
+	for _, line := range lines {
+		if n, err := strconv.Atoi(strings.TrimSpace(line)); err == nil {
+			return n, nil
+		}
+	}
+	return 0, errors.New("vlc did not return a number")
+}
+
+// parseVolume reads the volume from a bare number or the "( audio volume: N )" form
+func parseVolume(lines []string) (int, error) {
+	for _, line := range lines {
+		if m := volumeRegex.FindStringSubmatch(line); m != nil {
+			return strconv.Atoi(m[1])
+		}
+	}
+	return parseInt(lines)
+}
+
+func responseError(cmd string, lines []string) error {
+	for _, line := range lines {
+		if strings.HasPrefix(line, "Unknown command") {
+			return fmt.Errorf("vlc: %v", line)
+		}
+		if m := returnedRegex.FindStringSubmatch(line); m != nil && m[2] != "0" {
+			return fmt.Errorf("vlc command failed: %v: %v", cmd, m[3])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package vlc
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRC is an rc interface that answers each command with what reply returns for it
+type fakeRC struct {
+	ln    net.Listener
+	reply func(cmd string) string
+	cmds  chan string
+}
+
+func newFakeRC(t *testing.T, reply func(cmd string) string) *fakeRC {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRC{ln: ln, reply: reply, cmds: make(chan string, 64)}
+	t.Cleanup(func() { ln.Close() })
+
+	go f.serve()
+	return f
+}
+
+func (f *fakeRC) serve() {
+	conn, err := f.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("VLC media player 3.0.18 Vetinari\nCommand Line Interface initialized. Type `help' for help.\n> "))
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimSpace(line)
+		f.cmds <- cmd
+
+		res := f.reply(cmd)
+		if res == "hang" {
+			continue
+		}
+		conn.Write([]byte(res + "> "))
+	}
+}
+
+func dialFake(t *testing.T, reply func(cmd string) string) (*Client, *fakeRC) {
+	f := newFakeRC(t, reply)
+	c, err := Dial(f.ln.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, f
+}
+
+func TestGetVolume(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		want  int
+	}{
+		{"bare", "256\n", 256},
+		{"audio volume", "( audio volume: 128 )\n", 128},
+		{"status change", "status change: ( audio volume: 320 )\n", 320},
+		{"crlf", "( audio volume: 64 )\r\n", 64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := dialFake(t, func(cmd string) string {
+				if cmd == "volume" {
+					return tt.reply
+				}
+				return ""
+			})
+
+			got, err := c.GetVolume()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetVolumeStale(t *testing.T) {
+	vol := "status change: ( audio volume: 200 )\n"
+	c, _ := dialFake(t, func(cmd string) string {
+		if cmd == "volume" {
+			v := vol
+			vol = ""
+			return v
+		}
+		return ""
+	})
+
+	if _, err := c.GetVolume(); err != nil {
+		t.Fatal(err)
+	}
+	// a volume from an earlier status change isn't an answer
+	if _, err := c.GetVolume(); err == nil {
+		t.Error("expected an error when vlc doesn't report the volume")
+	}
+}
+
+func TestStatus(t *testing.T) {
+	c, _ := dialFake(t, func(cmd string) string {
+		switch cmd {
+		case "status":
+			return "( new input: https://www.youtube.com/watch?v=abcdefghijk )\n( audio volume: 256 )\n( state playing )\n"
+		case "get_time":
+			return "42\n"
+		case "get_length":
+			return "3600\n"
+		}
+		return ""
+	})
+
+	s, err := c.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Status{State: StatePlaying, Input: "https://www.youtube.com/watch?v=abcdefghijk", Volume: 256, Time: 42, Length: 3600}
+	if s != want {
+		t.Errorf("got %+v, want %+v", s, want)
+	}
+}
+
+func TestStatusChange(t *testing.T) {
+	c, _ := dialFake(t, func(cmd string) string {
+		if cmd == "add song.mp3" {
+			return "status change: ( new input: file:///song.mp3 )\nstatus change: ( play state: 3 ): Play\n"
+		}
+		return ""
+	})
+
+	changes := make(chan Status, 4)
+	c.Watch(func(s Status) { changes <- s })
+
+	if err := c.Add("song.mp3"); err != nil {
+		t.Fatal(err)
+	}
+
+	var last Status
+	for last.State != StatePlaying {
+		select {
+		case last = <-changes:
+		case <-time.After(time.Second):
+			t.Fatalf("no status change, last %+v", last)
+		}
+	}
+	if last.Input != "file:///song.mp3" {
+		t.Errorf("got input %v", last.Input)
+	}
+}
+
+func TestCommandOrder(t *testing.T) {
+	c, f := dialFake(t, func(cmd string) string {
+		return cmd + " done\n"
+	})
+
+	for _, cmd := range []string{"play", "pause", "next"} {
+		lines, err := c.Command(cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lines) != 1 || lines[0] != cmd+" done" {
+			t.Errorf("%v: got %q", cmd, lines)
+		}
+		if got := <-f.cmds; got != cmd {
+			t.Errorf("server got %v, want %v", got, cmd)
+		}
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	c, _ := dialFake(t, func(cmd string) string {
+		switch cmd {
+		case "bogus":
+			return "Unknown command `bogus'. Type `help' for help.\n"
+		case "seek 10":
+			return "seek: returned -1 (generic error)\n"
+		case "wait":
+			return "hang"
+		}
+		return ""
+	})
+	c.timeout = 100 * time.Millisecond
+
+	if _, err := c.Command("bogus"); err == nil {
+		t.Error("expected an error for an unknown command")
+	}
+	if err := c.Seek(10); err == nil || !strings.Contains(err.Error(), "generic error") {
+		t.Errorf("got %v, want the returned error", err)
+	}
+	if _, err := c.Command("wait"); !errors.Is(err, ErrTimeout) {
+		t.Errorf("got %v, want a timeout", err)
+	}
+}
+
+func TestClosed(t *testing.T) {
+	c, f := dialFake(t, func(cmd string) string { return "" })
+	f.ln.Close()
+	c.Close()
+
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatal("done wasn't closed")
+	}
+	if _, err := c.Command("status"); !errors.Is(err, ErrClosed) {
+		t.Errorf("got %v, want closed", err)
+	}
+}
+
+func TestParsePlaylist(t *testing.T) {
+	lines := []string{
+		"+----[ Playlist - playlist ]",
+		"| 1 - Playlist",
+		"|   4 - song.mp3 (00:03:30) [played 1 time]",
+		"|   *5 - stream (00:00:00)",
+		"| 2 - Media Library",
+		"|   6 - other.mp3 (00:01:00)",
+		"+----[ End of playlist ]",
+	}
+
+	got := parsePlaylist(lines)
+	want := []PlaylistItem{
+		{ID: 4, Name: "song.mp3", Duration: 210},
+		{ID: 5, Name: "stream", Current: true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
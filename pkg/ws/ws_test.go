@@ -0,0 +1,315 @@
+package ws
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// frame is what the server side of a test saw or sends
+type frame struct {
+	fin     bool
+	op      byte
+	masked  bool
+	payload []byte
+}
+
+func pipe(t *testing.T) (*Conn, net.Conn, *bufio.Reader) {
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return &Conn{conn: client, r: bufio.NewReader(client)}, server, bufio.NewReader(server)
+}
+
+func readFrame(r io.Reader) (frame, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return frame{}, err
+	}
+
+	f := frame{fin: head[0]&0x80 != 0, op: head[0] & 0x0F, masked: head[1]&0x80 != 0}
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		ext := make([]byte, 2)
+		io.ReadFull(r, ext)
+		n = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		io.ReadFull(r, ext)
+		n = binary.BigEndian.Uint64(ext)
+	}
+
+	mask := make([]byte, 4)
+	if f.masked {
+		io.ReadFull(r, mask)
+	}
+	f.payload = make([]byte, n)
+	if _, err := io.ReadFull(r, f.payload); err != nil {
+		return frame{}, err
+	}
+	for i := range f.payload {
+		f.payload[i] ^= mask[i%4]
+	}
+	return f, nil
+}
+
+// writeFrame writes an unmasked frame, servers never mask
+func writeFrame(w io.Writer, fin bool, op byte, payload []byte) error {
+	b := op
+	if fin {
+		b |= 0x80
+	}
+	head := []byte{b}
+
+	n := len(payload)
+	switch {
+	case n < 126:
+		head = append(head, byte(n))
+	case n <= 0xFFFF:
+		head = append(head, 126, byte(n>>8), byte(n))
+	default:
+		ext := make([]byte, 8)
+		binary.BigEndian.PutUint64(ext, uint64(n))
+		head = append(append(head, 127), ext...)
+	}
+
+	_, err := w.Write(append(head, payload...))
+	return err
+}
+
+func TestWriteMasked(t *testing.T) {
+	for _, n := range []int{0, 5, 125, 126, 0xFFFF, 0x10000} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			c, _, r := pipe(t)
+			payload := bytes.Repeat([]byte("a"), n)
+
+			errc := make(chan error, 1)
+			go func() { errc <- c.WriteMessage(payload) }()
+
+			f, err := readFrame(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := <-errc; err != nil {
+				t.Fatal(err)
+			}
+			if !f.fin || f.op != opText || !f.masked {
+				t.Errorf("got fin %v op %v masked %v, want a masked final text frame", f.fin, f.op, f.masked)
+			}
+			if !bytes.Equal(f.payload, payload) {
+				t.Errorf("got %d bytes, want %d", len(f.payload), n)
+			}
+		})
+	}
+}
+
+func TestMaskIsRandom(t *testing.T) {
+	c, server, _ := pipe(t)
+	payload := []byte("same message")
+
+	raw := make([][]byte, 2)
+	for i := range raw {
+		go c.WriteMessage(payload)
+		buf := make([]byte, 2+4+len(payload))
+		if _, err := io.ReadFull(server, buf); err != nil {
+			t.Fatal(err)
+		}
+		raw[i] = buf
+	}
+	if bytes.Equal(raw[0], raw[1]) {
+		t.Error("the same message was masked the same way twice")
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	for _, n := range []int{0, 125, 126, 0xFFFF, 70000} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			c, server, _ := pipe(t)
+			payload := bytes.Repeat([]byte("b"), n)
+			go writeFrame(server, true, opText, payload)
+
+			msg, err := c.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(msg, payload) {
+				t.Errorf("got %d bytes, want %d", len(msg), n)
+			}
+		})
+	}
+}
+
+func TestFragmentedWithPing(t *testing.T) {
+	c, server, r := pipe(t)
+
+	pong := make(chan frame, 1)
+	go func() {
+		writeFrame(server, false, opText, []byte("hel"))
+		writeFrame(server, true, opPing, []byte("are you there"))
+		f, _ := readFrame(r)
+		pong <- f
+		writeFrame(server, true, opContinuation, []byte("lo"))
+	}()
+
+	msg, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg) != "hello" {
+		t.Errorf("got %q, want hello", msg)
+	}
+
+	f := <-pong
+	if f.op != opPong || !f.masked || string(f.payload) != "are you there" {
+		t.Errorf("got %+v, want a masked pong with the ping payload", f)
+	}
+}
+
+func TestCloseFromServer(t *testing.T) {
+	c, server, r := pipe(t)
+
+	reply := make(chan frame, 1)
+	go func() {
+		writeFrame(server, true, opClose, []byte{0x03, 0xE8, 'b', 'y', 'e'})
+		f, _ := readFrame(r)
+		reply <- f
+	}()
+
+	if _, err := c.ReadMessage(); !errors.Is(err, ErrClosed) {
+		t.Errorf("got %v, want closed", err)
+	}
+
+	f := <-reply
+	if f.op != opClose || !f.masked || !bytes.Equal(f.payload, []byte{0x03, 0xE8, 'b', 'y', 'e'}) {
+		t.Errorf("got %+v, want the close frame echoed", f)
+	}
+}
+
+func TestCloseFromClient(t *testing.T) {
+	c, _, r := pipe(t)
+
+	frames := make(chan frame, 1)
+	eof := make(chan error, 1)
+	go func() {
+		f, _ := readFrame(r)
+		frames <- f
+		_, err := r.ReadByte()
+		eof <- err
+	}()
+
+	c.Close()
+
+	if f := <-frames; f.op != opClose || !f.masked {
+		t.Errorf("got %+v, want a masked close frame", f)
+	}
+	if err := <-eof; err != io.EOF {
+		t.Errorf("got %v, want the connection closed after the close frame", err)
+	}
+	if err := c.WriteMessage([]byte("late")); err == nil {
+		t.Error("wrote to a closed connection")
+	}
+}
+
+func TestFrameTooLarge(t *testing.T) {
+	c, server, _ := pipe(t)
+
+	go func() {
+		head := []byte{0x80 | opText, 127}
+		ext := make([]byte, 8)
+		binary.BigEndian.PutUint64(ext, maxMessageSize+1)
+		server.Write(append(head, ext...))
+	}()
+
+	if _, err := c.ReadMessage(); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("got %v, want too large", err)
+	}
+}
+
+// serve accepts one connection and answers the handshake with the accept key accept returns
+func serve(t *testing.T, status int, accept func(key string) string, after func(net.Conn)) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil {
+			return
+		}
+		if req.Header.Get("Upgrade") != "websocket" || req.Header.Get("Sec-WebSocket-Version") != "13" || req.URL.Path != "/devtools/page/1" {
+			fmt.Fprint(conn, "HTTP/1.1 400 Bad Request\r\n\r\n")
+			return
+		}
+
+		fmt.Fprintf(conn, "HTTP/1.1 %d %v\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %v\r\n\r\n",
+			status, http.StatusText(status), accept(req.Header.Get("Sec-WebSocket-Key")))
+		if after != nil {
+			after(conn)
+		}
+	}()
+
+	return "ws://" + ln.Addr().String() + "/devtools/page/1"
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func TestDial(t *testing.T) {
+	u := serve(t, http.StatusSwitchingProtocols, acceptKey, func(conn net.Conn) {
+		writeFrame(conn, true, opText, []byte(`{"id":1}`))
+		readFrame(conn)
+	})
+
+	c, err := Dial(u, nil, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	msg, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg) != `{"id":1}` {
+		t.Errorf("got %s", msg)
+	}
+}
+
+func TestDialRejected(t *testing.T) {
+	bad := serve(t, http.StatusSwitchingProtocols, func(string) string { return "bogus" }, nil)
+	if _, err := Dial(bad, nil, time.Second); err == nil || !strings.Contains(err.Error(), "accept key") {
+		t.Errorf("got %v, want a bad accept key", err)
+	}
+
+	forbidden := serve(t, http.StatusForbidden, acceptKey, nil)
+	if _, err := Dial(forbidden, nil, time.Second); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("got %v, want the status", err)
+	}
+
+	if _, err := Dial("http://localhost/", nil, time.Second); err == nil {
+		t.Error("dialed an http url")
+	}
+}
@@ -0,0 +1,323 @@
+package youtube
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	liveChatPage     = "https://www.youtube.com/live_chat?is_popout=1&v="
+	liveChatEndpoint = "https://www.youtube.com/youtubei/v1/live_chat/get_live_chat?prettyPrint=false&key="
+
+	// polling is kept between these no matter what youtube asks for
+	minChatPoll = 2 * time.Second
+	maxChatPoll = 30 * time.Second
+)
+
+var (
+	ErrChatEnded    = errors.New("live chat has ended")
+	ErrChatDisabled = errors.New("live chat is not available for this video")
+
+	apiKeyRegex        = regexp.MustCompile(`"INNERTUBE_API_KEY"\s*:\s*"([^"]+)"`)
+	clientVersionRegex = regexp.MustCompile(`"INNERTUBE_CLIENT_VERSION"\s*:\s*"([^"]+)"`)
+	initialDataRegex   = regexp.MustCompile(`(?s)(?:window\["ytInitialData"\]|var\s+ytInitialData)\s*=\s*(\{.+?\});\s*</script>`)
+)
+
+// ChatMessage is a single message from a live chat
+type ChatMessage struct {
+	ID              string    `json:"id"`
+	Author          string    `json:"author"`
+	AuthorChannelID string    `json:"authorChannelId"`
+	Text            string    `json:"text"`
+	Owner           bool      `json:"owner"`
+	Moderator       bool      `json:"moderator"`
+	Member          bool      `json:"member"`
+	Paid            string    `json:"paid"` // super chat amount, empty for normal messages
+	Time            time.Time `json:"time"`
+}
+
+// ChatPage is one poll of a live chat, Continuation fetches the messages after it
+type ChatPage struct {
+	Messages     []ChatMessage `json:"messages"`
+	Continuation string        `json:"continuation"`
+	Timeout      time.Duration `json:"timeout"` // how long youtube wants us to wait before the next poll
+}
+
+// Chat polls a stream's live chat through the innertube continuation endpoint
+type Chat struct {
+	VideoID string
+
+	mu            sync.Mutex
+	apiKey        string
+	clientVersion string
+	continuation  string
+	timeout       time.Duration
+}
+
+// OpenChat loads the live chat page of a video to get the first continuation
+func OpenChat(videoID string) (*Chat, error) {
+	u := liveChatPage + videoID
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, fmt.Errorf("error occurred getting live chat page: %v: %v", u, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error occurred trying to read response body: %v: %v", u, err)
+	}
+
+	c, err := parseChatPage(resp, string(body))
+	if err != nil {
+		return nil, err
+	}
+	c.VideoID = videoID
+	return c, nil
+}
+
+// Next fetches the messages posted since the last poll.
+// The returned duration is how long to wait before calling it again.
+func (c *Chat) Next() ([]ChatMessage, time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	req := map[string]interface{}{
+		"context": map[string]interface{}{
+			"client": map[string]interface{}{
+				"clientName":    "WEB",
+				"clientVersion": c.clientVersion,
+				"hl":            "en",
+			},
+		},
+		"continuation": c.continuation,
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := client.Post(liveChatEndpoint+c.apiKey, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return nil, c.timeout, fmt.Errorf("error occurred getting live chat: %v: %v", c.VideoID, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, c.timeout, fmt.Errorf("error occurred trying to read response body: %v: %v", c.VideoID, err)
+	}
+	if err := checkInterstitial(resp, string(body)); err != nil {
+		return nil, maxChatPoll, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.timeout, fmt.Errorf("live chat request failed: %v: %v", c.VideoID, resp.Status)
+	}
+
+	page, err := ParseChatResponse(body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	c.continuation = page.Continuation
+	c.timeout = clampPoll(page.Timeout)
+	return page.Messages, c.timeout, nil
+}
+
+// parseChatPage reads the api key, client version and first continuation from the live chat page
+func parseChatPage(resp *http.Response, b string) (*Chat, error) {
+	if err := checkInterstitial(resp, b); err != nil {
+		return nil, err
+	}
+
+	key := apiKeyRegex.FindStringSubmatch(b)
+	version := clientVersionRegex.FindStringSubmatch(b)
+	data := initialDataRegex.FindStringSubmatch(b)
+	if key == nil || version == nil || data == nil {
+		return nil, fmt.Errorf("failed to read live chat page, regex did not match")
+	}
+
+	var res struct {
+		Contents struct {
+			LiveChatRenderer *struct {
+				Continuations []chatContinuation `json:"continuations"`
+			} `json:"liveChatRenderer"`
+			Message json.RawMessage `json:"messageRenderer"`
+		} `json:"contents"`
+	}
+	if err := json.Unmarshal([]byte(data[1]), &res); err != nil {
+		return nil, fmt.Errorf("failed to decode live chat data: %v", err)
+	}
+
+	// chat is replaced by a message when it's turned off or the stream is over
+	if res.Contents.LiveChatRenderer == nil {
+		return nil, ErrChatDisabled
+	}
+
+	cont, timeout := nextContinuation(res.Contents.LiveChatRenderer.Continuations)
+	if cont == "" {
+		return nil, ErrChatEnded
+	}
+
+	return &Chat{
+		apiKey:        key[1],
+		clientVersion: version[1],
+		continuation:  cont,
+		timeout:       clampPoll(timeout),
+	}, nil
+}
+
+// ParseChatResponse reads the messages and next continuation from a get_live_chat response
+func ParseChatResponse(body []byte) (*ChatPage, error) {
+	var res chatResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("failed to decode live chat response: %v", err)
+	}
+
+	lc := res.ContinuationContents.LiveChatContinuation
+	if lc == nil {
+		return nil, ErrChatEnded
+	}
+
+	cont, timeout := nextContinuation(lc.Continuations)
+	if cont == "" {
+		return nil, ErrChatEnded
+	}
+
+	page := &ChatPage{
+		Messages:     make([]ChatMessage, 0, len(lc.Actions)),
+		Continuation: cont,
+		Timeout:      timeout,
+	}
+	for _, a := range lc.Actions {
+		item := a.AddChatItemAction.Item
+		if r := item.LiveChatTextMessageRenderer; r != nil {
+			page.Messages = append(page.Messages, r.message(""))
+		}
+		if r := item.LiveChatPaidMessageRenderer; r != nil {
+			page.Messages = append(page.Messages, r.message(r.PurchaseAmountText.SimpleText))
+		}
+	}
+
+	return page, nil
+}
+
+func nextContinuation(list []chatContinuation) (string, time.Duration) {
+	for _, c := range list {
+		for _, d := range []*continuationData{c.Invalidation, c.Timed, c.Reload} {
+			if d != nil && d.Continuation != "" {
+				return d.Continuation, time.Duration(d.TimeoutMs) * time.Millisecond
+			}
+		}
+	}
+	return "", 0
+}
+
+func clampPoll(d time.Duration) time.Duration {
+	if d < minChatPoll {
+		return minChatPoll
+	}
+	if d > maxChatPoll {
+		return maxChatPoll
+	}
+	return d
+}
+
+type chatResponse struct {
+	ContinuationContents struct {
+		LiveChatContinuation *struct {
+			Continuations []chatContinuation `json:"continuations"`
+			Actions       []struct {
+				AddChatItemAction struct {
+					Item struct {
+						LiveChatTextMessageRenderer *chatRenderer `json:"liveChatTextMessageRenderer"`
+						LiveChatPaidMessageRenderer *chatRenderer `json:"liveChatPaidMessageRenderer"`
+					} `json:"item"`
+				} `json:"addChatItemAction"`
+			} `json:"actions"`
+		} `json:"liveChatContinuation"`
+	} `json:"continuationContents"`
+}
+
+type chatContinuation struct {
+	Invalidation *continuationData `json:"invalidationContinuationData"`
+	Timed        *continuationData `json:"timedContinuationData"`
+	Reload       *continuationData `json:"reloadContinuationData"`
+}
+
+type continuationData struct {
+	Continuation string `json:"continuation"`
+	TimeoutMs    int    `json:"timeoutMs"`
+}
+
+type chatRenderer struct {
+	ID      string `json:"id"`
+	Message struct {
+		Runs []struct {
+			Text  string `json:"text"`
+			Emoji *struct {
+				Shortcuts []string `json:"shortcuts"`
+			} `json:"emoji"`
+		} `json:"runs"`
+	} `json:"message"`
+	AuthorName struct {
+		SimpleText string `json:"simpleText"`
+	} `json:"authorName"`
+	AuthorExternalChannelID string `json:"authorExternalChannelId"`
+	AuthorBadges            []struct {
+		LiveChatAuthorBadgeRenderer struct {
+			Icon *struct {
+				IconType string `json:"iconType"`
+			} `json:"icon"`
+			Tooltip string `json:"tooltip"`
+		} `json:"liveChatAuthorBadgeRenderer"`
+	} `json:"authorBadges"`
+	PurchaseAmountText struct {
+		SimpleText string `json:"simpleText"`
+	} `json:"purchaseAmountText"`
+	TimestampUsec string `json:"timestampUsec"`
+}
+
+func (r *chatRenderer) message(paid string) ChatMessage {
+	var text strings.Builder
+	for _, run := range r.Message.Runs {
+		text.WriteString(run.Text)
+		if run.Emoji != nil && len(run.Emoji.Shortcuts) > 0 {
+			text.WriteString(run.Emoji.Shortcuts[0])
+		}
+	}
+
+	m := ChatMessage{
+		ID:              r.ID,
+		Author:          r.AuthorName.SimpleText,
+		AuthorChannelID: r.AuthorExternalChannelID,
+		Text:            text.String(),
+		Paid:            paid,
+	}
+
+	for _, b := range r.AuthorBadges {
+		badge := b.LiveChatAuthorBadgeRenderer
+		switch {
+		case badge.Icon != nil && badge.Icon.IconType == "OWNER":
+			m.Owner = true
+		case badge.Icon != nil && badge.Icon.IconType == "MODERATOR":
+			m.Moderator = true
+		case badge.Icon == nil: // member badges are custom images
+			m.Member = true
+		}
+	}
+
+	if usec, err := strconv.ParseInt(r.TimestampUsec, 10, 64); err == nil {
+		m.Time = time.UnixMicro(usec)
+	}
+	return m
+}
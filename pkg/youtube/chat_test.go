@@ -0,0 +1,114 @@
+package youtube
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseChatFixtures(t *testing.T) {
+	list, err := LoadFixtures(filepath.Join(fixturesDir, "live_chat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixtures := make(map[string]Fixture, len(list))
+	for _, f := range list {
+		fixtures[f.RecordedAt.Format(fixtureTimeFormat)] = f
+	}
+
+	tests := []struct {
+		name         string
+		fixture      string
+		err          error
+		messages     int
+		continuation string
+		timeout      time.Duration
+	}{
+		{"chat page", "20261019T120000", nil, 0, "0ofMyANhGlhDaWtxSndvWVZVTklPVlpmYW1oZk1XVmFZMDE1TTNKVlkwRXlTV1JSRWd0aFltTmtaV1puYUdscWF4b1Q2cWpadVFFTkNndGhZbU5rWldabmFHbHFheUFCMAGCAQIIBA%3D%3D", 10 * time.Second},
+		{"live", "20261019T120002", nil, 5, "0ofMyANiGlhDaWtxSndvWVZVTklPVlpmYW1oZk1XVmFZMDE1TTNKVlkwRXlTV1JSRWd0aFltTmtaV1puYUdscWF4b1Q2cWpadVFFTkNndGhZbU5rWldabmFHbHFheUFCKOKY1o2T0IsDMAA%3D", 5 * time.Second},
+		{"ended", "20261019T120007", ErrChatEnded, 0, "", 0},
+		{"disabled", "20261019T120100", ErrChatDisabled, 0, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, ok := fixtures[tt.fixture]
+			if !ok {
+				t.Fatalf("missing fixture %v", tt.fixture)
+			}
+
+			page, err := ParseChatFixture(f)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("got %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Messages) != tt.messages || page.Continuation != tt.continuation || page.Timeout != tt.timeout {
+				t.Errorf("got %v messages, continuation %q, timeout %v, want %v, %q, %v",
+					len(page.Messages), page.Continuation, page.Timeout, tt.messages, tt.continuation, tt.timeout)
+			}
+		})
+	}
+}
+
+func TestParseChatMessages(t *testing.T) {
+	list, err := LoadFixtures(filepath.Join(fixturesDir, "live_chat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var page *ChatPage
+	for _, f := range list {
+		if f.RecordedAt.Format(fixtureTimeFormat) == "20261019T120002" {
+			page, err = ParseChatFixture(f)
+		}
+	}
+	if err != nil || page == nil {
+		t.Fatalf("got %v parsing the live chat fixture", err)
+	}
+
+	want := []ChatMessage{
+		{ID: "ChwKGkNPbWFfYWJjMTIz", Author: "viewer one", AuthorChannelID: "UCaaaaaaaaaaaaaaaaaaaaaa", Text: "karaoke when?"},
+		{ID: "ChwKGkNPbWFfYWJjMTI0", Author: "Doki", AuthorChannelID: "UCH9V_jhb_1eZcMy3rUcA2IdQ", Text: "thank you for coming :heart:", Owner: true},
+		{ID: "ChwKGkNPbWFfYWJjMTI1", Author: "mod person", AuthorChannelID: "UCbbbbbbbbbbbbbbbbbbbbbb", Text: "reminder: be nice", Moderator: true},
+		{ID: "ChwKGkNPbWFfYWJjMTI2", Author: "long time member", AuthorChannelID: "UCcccccccccccccccccccccc", Text: "hi chat", Member: true},
+		{ID: "ChwKGkNPbWFfYWJjMTI3", Author: "big fan", AuthorChannelID: "UCdddddddddddddddddddddd", Text: "play the karaoke song pls", Paid: "$5.00"},
+	}
+	if len(page.Messages) != len(want) {
+		t.Fatalf("got %+v", page.Messages)
+	}
+	for i, w := range want {
+		w.Time = time.UnixMicro(1792411201000000 + int64(i)*1000000)
+		if got := page.Messages[i]; got != w {
+			t.Errorf("%d: got %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+func TestReplayChatDisabled(t *testing.T) {
+	defer func(rt http.RoundTripper) { client.Transport = rt }(client.Transport)
+	Replay(fixturesDir)
+
+	if _, err := OpenChat("chatoffvid1"); !errors.Is(err, ErrChatDisabled) {
+		t.Errorf("got %v, want %v", err, ErrChatDisabled)
+	}
+}
+
+func TestClampPoll(t *testing.T) {
+	tests := map[time.Duration]time.Duration{
+		0:                minChatPoll,
+		time.Second:      minChatPoll,
+		10 * time.Second: 10 * time.Second,
+		time.Minute:      maxChatPoll,
+	}
+	for d, want := range tests {
+		if got := clampPoll(d); got != want {
+			t.Errorf("%v: got %v, want %v", d, got, want)
+		}
+	}
+}
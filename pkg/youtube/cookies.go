@@ -0,0 +1,232 @@
+package youtube
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const consentDomain = "youtube.com"
+
+var (
+	jar    = newCookieJar()
+	client = &http.Client{Jar: jar}
+)
+
+// UseCookieJar loads cookies saved from a previous run and keeps the file updated
+// with any cookies youtube sets, so consent choices survive restarts
+func UseCookieJar(filename string) error {
+	jar.mu.Lock()
+	jar.filename = filename
+	jar.mu.Unlock()
+
+	return jar.load()
+}
+
+// SetConsentCookie sets cookies such as "SOCS=CAI" or "CONSENT=YES+1" that are sent with
+// every youtube request, this skips the EU cookie consent page.
+// Multiple cookies can be separated with a semicolon.
+func SetConsentCookie(value string) {
+	u := &url.URL{Scheme: "https", Host: "www." + consentDomain, Path: "/"}
+
+	cookies := make([]*http.Cookie, 0)
+	for _, part := range strings.Split(value, ";") {
+		name, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || name == "" {
+			continue
+		}
+		cookies = append(cookies, &http.Cookie{
+			Name:    name,
+			Value:   val,
+			Domain:  consentDomain,
+			Path:    "/",
+			Expires: time.Now().AddDate(1, 0, 0),
+		})
+	}
+
+	jar.SetCookies(u, cookies)
+}
+
+// cookieJar is a simple http.CookieJar that can be saved to disk,
+// the standard library jar has no way to list its cookies
+type cookieJar struct {
+	mu       sync.Mutex
+	filename string
+	cookies  map[string]map[string]*jarCookie // domain -> name -> cookie
+}
+
+// jarCookie is a cookie as it's kept in the jar, a cookie set without a domain
+// is host only and isn't sent to subdomains of the host that set it
+type jarCookie struct {
+	*http.Cookie
+	HostOnly bool `json:"HostOnly,omitempty"`
+}
+
+func newCookieJar() *cookieJar {
+	return &cookieJar{cookies: make(map[string]map[string]*jarCookie, 0)}
+}
+
+func (j *cookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	host := strings.ToLower(u.Hostname())
+	for _, c := range cookies {
+		domain := strings.TrimPrefix(strings.ToLower(c.Domain), ".")
+		hostOnly := domain == ""
+		if hostOnly {
+			domain = host
+		}
+
+		// a site can only set cookies for itself or a parent domain, never a bare suffix like "com"
+		if !domainMatch(host, domain) || !strings.Contains(domain, ".") {
+			continue
+		}
+		if c.Path == "" {
+			c.Path = "/"
+		}
+		if c.MaxAge > 0 {
+			c.Expires = time.Now().Add(time.Duration(c.MaxAge) * time.Second)
+		}
+
+		if _, ok := j.cookies[domain]; !ok {
+			j.cookies[domain] = make(map[string]*jarCookie, 0)
+		}
+
+		// negative max age or a past expiry removes the cookie
+		if c.MaxAge < 0 || (!c.Expires.IsZero() && c.Expires.Before(time.Now())) {
+			delete(j.cookies[domain], c.Name)
+			continue
+		}
+
+		j.cookies[domain][c.Name] = &jarCookie{
+			Cookie: &http.Cookie{
+				Name:    c.Name,
+				Value:   c.Value,
+				Domain:  domain,
+				Path:    c.Path,
+				Expires: c.Expires,
+				Secure:  c.Secure,
+			},
+			HostOnly: hostOnly,
+		}
+	}
+}
+
+func (j *cookieJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	host := strings.ToLower(u.Hostname())
+	now := time.Now()
+
+	list := make([]*http.Cookie, 0)
+	for domain, cookies := range j.cookies {
+		if !domainMatch(host, domain) {
+			continue
+		}
+		for _, c := range cookies {
+			if c.HostOnly && host != domain {
+				continue
+			}
+			if !c.Expires.IsZero() && c.Expires.Before(now) {
+				continue
+			}
+			if c.Secure && u.Scheme != "https" {
+				continue
+			}
+			if !strings.HasPrefix(u.Path, c.Path) && !(c.Path == "/" && u.Path == "") {
+				continue
+			}
+			list = append(list, &http.Cookie{Name: c.Name, Value: c.Value})
+		}
+	}
+
+	return list
+}
+
+// domainMatch reports if the host is the domain or one of its subdomains
+func domainMatch(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+func (j *cookieJar) load() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	body, err := os.ReadFile(j.filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// jars saved before host only cookies were kept load as domain cookies
+	var list []*jarCookie
+	if err := json.Unmarshal(body, &list); err != nil {
+		return err
+	}
+
+	for _, c := range list {
+		if c.Cookie == nil {
+			continue
+		}
+		if _, ok := j.cookies[c.Domain]; !ok {
+			j.cookies[c.Domain] = make(map[string]*jarCookie, 0)
+		}
+		j.cookies[c.Domain][c.Name] = c
+	}
+
+	return nil
+}
+
+func (j *cookieJar) save() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.filename == "" {
+		return nil
+	}
+
+	list := make([]*jarCookie, 0)
+	for _, cookies := range j.cookies {
+		for _, c := range cookies {
+			// session cookies aren't kept between runs
+			if c.Expires.IsZero() {
+				continue
+			}
+			list = append(list, c)
+		}
+	}
+
+	body, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(j.filename), 0755); err != nil {
+		return err
+	}
+
+	// write to a temp file first so a crash doesn't leave a broken jar
+	tmp := j.filename + ".tmp"
+	if err := os.WriteFile(tmp, body, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, j.filename)
+}
+
+func saveCookies() {
+	if err := jar.save(); err != nil {
+		log.Println("failed to save youtube cookies:", err)
+	}
+}
@@ -0,0 +1,80 @@
+package youtube
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCookieDomains(t *testing.T) {
+	j := newCookieJar()
+	u, _ := url.Parse("https://www.youtube.com/")
+
+	j.SetCookies(u, []*http.Cookie{
+		{Name: "host", Value: "1"},
+		{Name: "parent", Value: "1", Domain: ".youtube.com"},
+		{Name: "other", Value: "1", Domain: "example.com"},
+		{Name: "suffix", Value: "1", Domain: "com"},
+		{Name: "child", Value: "1", Domain: "music.www.youtube.com"},
+	})
+
+	tests := []struct {
+		url  string
+		want []string
+	}{
+		{"https://www.youtube.com/", []string{"host", "parent"}},
+		{"https://m.youtube.com/", []string{"parent"}},
+		// a cookie set without a domain is only sent back to the host that set it
+		{"https://music.www.youtube.com/", []string{"parent"}},
+		{"https://example.com/", nil},
+		{"https://google.com/", nil},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		got := make(map[string]bool, 0)
+		for _, c := range j.Cookies(u) {
+			got[c.Name] = true
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.url, got, tt.want)
+			continue
+		}
+		for _, name := range tt.want {
+			if !got[name] {
+				t.Errorf("%v: missing %v, got %v", tt.url, name, got)
+			}
+		}
+	}
+}
+
+func TestCookieJarSaved(t *testing.T) {
+	j := newCookieJar()
+	j.filename = filepath.Join(t.TempDir(), "cookies.json")
+	u, _ := url.Parse("https://www.youtube.com/")
+
+	expires := time.Now().Add(time.Hour)
+	j.SetCookies(u, []*http.Cookie{
+		{Name: "host", Value: "1", Expires: expires},
+		{Name: "parent", Value: "1", Domain: ".youtube.com", Expires: expires},
+		{Name: "session", Value: "1"},
+	})
+	if err := j.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newCookieJar()
+	loaded.filename = j.filename
+	if err := loaded.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	sub, _ := url.Parse("https://music.www.youtube.com/")
+	if got := loaded.Cookies(sub); len(got) != 1 || got[0].Name != "parent" {
+		t.Errorf("got %v, want only the domain cookie sent to a subdomain", got)
+	}
+	if got := loaded.Cookies(u); len(got) != 2 {
+		t.Errorf("got %v, want the saved cookies without the session one", got)
+	}
+}
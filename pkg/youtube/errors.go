@@ -0,0 +1,55 @@
+package youtube
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrRateLimited     = errors.New("youtube rate limited the request")
+	ErrConsentRequired = errors.New("youtube requires cookie consent, set consentCookie in the config")
+	ErrBotCheck        = errors.New("youtube asked to sign in to confirm this is not a bot")
+	ErrCaptcha         = errors.New("youtube returned a captcha page")
+)
+
+var (
+	// the bot check is a playability status youtube returns in place of the video,
+	// matching the field keeps a page that only mentions the text from being reported as blocked
+	botCheckRegex = regexp.MustCompile(`(?i)"reason"\s*:\s*(\{\s*"simpleText"\s*:\s*)?"sign in to confirm you(’|'|\\u0027|&#39;)re not a bot`)
+
+	// the captcha interstitial is google's sorry page, built around its captcha form
+	captchaFormRegex = regexp.MustCompile(`<form[^>]*\sid="captcha-form"`)
+)
+
+// checkInterstitial returns an error if youtube served a consent, bot check or captcha
+// page instead of the requested page, these aren't parse failures and need user action or a slowdown
+func checkInterstitial(resp *http.Response, body string) error {
+	u := resp.Request.URL
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %v", ErrRateLimited, u)
+	}
+
+	if u.Host == "consent.youtube.com" || u.Host == "consent.google.com" ||
+		strings.Contains(body, `action="https://consent.youtube.com/save"`) {
+		return fmt.Errorf("%w: %v", ErrConsentRequired, u)
+	}
+
+	if strings.HasPrefix(u.Path, "/sorry/") || captchaFormRegex.MatchString(body) {
+		return fmt.Errorf("%w: %v", ErrCaptcha, u)
+	}
+
+	if botCheckRegex.MatchString(body) {
+		return fmt.Errorf("%w: %v", ErrBotCheck, u)
+	}
+
+	return nil
+}
+
+// isInterstitial returns true if the error came from a page that blocks every channel, not just one
+func isInterstitial(err error) bool {
+	return errors.Is(err, ErrConsentRequired) || errors.Is(err, ErrBotCheck) || errors.Is(err, ErrCaptcha)
+}
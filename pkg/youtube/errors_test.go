@@ -0,0 +1,40 @@
+package youtube
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestCheckInterstitial(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		code int
+		body string
+		want error
+	}{
+		{"normal page", "https://www.youtube.com/@a/live", 200, `<script>var ytInitialData = {};</script>`, nil},
+		{"page mentioning recaptcha", "https://www.youtube.com/@a/live", 200,
+			`{"title":"how g-recaptcha works","description":"Our systems have detected unusual traffic"}`, nil},
+		{"chat message mentioning the bot check", "https://www.youtube.com/watch?v=aaaaaaaaaaa", 200,
+			`{"text":"sign in to confirm you're not a bot lol"}`, nil},
+		{"rate limited", "https://www.youtube.com/@a/live", 429, "", ErrRateLimited},
+		{"consent redirect", "https://consent.youtube.com/m?continue=x", 200, "", ErrConsentRequired},
+		{"sorry redirect", "https://www.google.com/sorry/index?continue=x", 200, "", ErrCaptcha},
+		{"captcha form", "https://www.youtube.com/@a/live", 200,
+			`<form id="captcha-form" action="index" method="post"><div class="g-recaptcha"></div></form>`, ErrCaptcha},
+		{"bot check", "https://www.youtube.com/watch?v=aaaaaaaaaaa", 200,
+			`"playabilityStatus":{"status":"LOGIN_REQUIRED","reason":"Sign in to confirm you’re not a bot"}`, ErrBotCheck},
+	}
+
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		resp := &http.Response{StatusCode: tt.code, Request: &http.Request{URL: u}}
+		err := checkInterstitial(resp, tt.body)
+		if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package youtube
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	fixtureTimeFormat = "20060102T150405"
+
+	// fixtures kept per channel while the app records, every poll saves one
+	maxFixtures = 100
+)
+
+// Fixture is a raw youtube response saved to disk so the parser can be run against it offline
+type Fixture struct {
+	Channel      string    `json:"channel"`
+	URL          string    `json:"url"`
+	Location     string    `json:"location"`               // redirect target, if any
+	Continuation string    `json:"continuation,omitempty"` // continuation sent with a live chat request, they all share one url
+	StatusCode   int       `json:"statusCode"`
+	ContentType  string    `json:"contentType"`
+	RecordedAt   time.Time `json:"recordedAt"`
+	Body         string    `json:"body"`
+}
+
+// values in the page that identify us, these are removed before saving
+var sanitizeRegex = []*regexp.Regexp{
+	regexp.MustCompile(`("(?:visitorData|VISITOR_DATA|DATASYNC_ID|ID_TOKEN|XSRF_TOKEN|DELEGATED_SESSION_ID|remoteHost|appInstallData)"\s*:\s*")[^"]*(")`),
+	regexp.MustCompile(`(nonce=")[^"]*(")`),
+}
+
+// Record saves youtube responses to dir while still returning them to the caller,
+// only the most recent ones are kept for each channel
+func Record(dir string) {
+	client.Transport = &RecordTransport{Dir: dir, Max: maxFixtures}
+}
+
+// Replay serves saved responses from dir instead of contacting youtube
+func Replay(dir string) {
+	client.Transport = &ReplayTransport{Dir: dir}
+}
+
+// RecordTransport saves sanitized responses, keyed by channel and time
+type RecordTransport struct {
+	Dir  string
+	Max  int // fixtures kept per channel, the oldest are removed first, 0 keeps every one
+	Base http.RoundTripper
+}
+
+func (t *RecordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	cont, err := requestContinuation(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	f := Fixture{
+		Channel:      fixtureKey(req.URL),
+		URL:          req.URL.String(),
+		Location:     resp.Header.Get("Location"),
+		Continuation: cont,
+		StatusCode:   resp.StatusCode,
+		ContentType:  resp.Header.Get("Content-Type"),
+		RecordedAt:   time.Now(),
+		Body:         sanitize(string(body)),
+	}
+
+	if err := SaveFixture(t.Dir, f); err != nil {
+		return nil, fmt.Errorf("failed to record response: %v: %v", req.URL, err)
+	}
+	if t.Max > 0 {
+		if err := pruneFixtures(filepath.Join(t.Dir, f.Channel), t.Max); err != nil {
+			log.Println("failed to remove old fixtures:", err)
+		}
+	}
+
+	return resp, nil
+}
+
+// pruneFixtures removes the oldest fixtures in dir until max are left
+func pruneFixtures(dir string, max int) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(files) <= max {
+		return err
+	}
+
+	// names are the time they were recorded, with a counter for the same second
+	sort.Slice(files, func(i, j int) bool {
+		ti, ni := fixtureOrder(files[i])
+		tj, nj := fixtureOrder(files[j])
+		if ti != tj {
+			return ti < tj
+		}
+		return ni < nj
+	})
+
+	for _, fn := range files[:len(files)-max] {
+		if err := os.Remove(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fixtureOrder splits a fixture file name into its time and counter, see SaveFixture
+func fixtureOrder(fn string) (string, int) {
+	name := strings.TrimSuffix(filepath.Base(fn), ".json")
+	stamp, count, ok := strings.Cut(name, "-")
+	if !ok {
+		return stamp, 0
+	}
+	n, _ := strconv.Atoi(count)
+	return stamp, n
+}
+
+// ReplayTransport serves the most recent fixture recorded for the requested channel,
+// live chat requests are matched on their continuation as well
+type ReplayTransport struct {
+	Dir string
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cont, err := requestContinuation(req)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fixtureKey(req.URL)
+	list, err := LoadFixtures(filepath.Join(t.Dir, key))
+	if err != nil {
+		return nil, err
+	}
+
+	// each hop of a redirect is recorded on its own, so the client follows them the same way
+	for i := len(list) - 1; i >= 0; i-- {
+		if list[i].URL == req.URL.String() && list[i].Continuation == cont {
+			return list[i].Response(req), nil
+		}
+	}
+
+	if cont != "" {
+		return nil, fmt.Errorf("no fixture recorded for: %v, continuation %v", req.URL, cont)
+	}
+	return nil, fmt.Errorf("no fixture recorded for: %v", req.URL)
+}
+
+// requestContinuation returns the continuation in a live chat request body, leaving the body readable
+func requestContinuation(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return "", nil
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	var v struct {
+		Continuation string `json:"continuation"`
+	}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return "", nil
+	}
+	return v.Continuation, nil
+}
+
+// Response builds the http response the fixture was recorded from
+func (f Fixture) Response(req *http.Request) *http.Response {
+	header := make(http.Header)
+	header.Set("Content-Type", f.ContentType)
+	if f.Location != "" {
+		header.Set("Location", f.Location)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.StatusCode, http.StatusText(f.StatusCode)),
+		StatusCode:    f.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(f.Body)),
+		ContentLength: int64(len(f.Body)),
+		Request:       req,
+	}
+}
+
+// ParseFixture runs the channel page parser on a recorded response
+func ParseFixture(f Fixture) (*VideoDetails, error) {
+	u, err := url.Parse(f.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &http.Request{Method: http.MethodGet, URL: u}
+	return parseChannelPage(f.Response(req), f.Body)
+}
+
+// IsChatFixture reports if the fixture is a live chat page or get_live_chat response
+func IsChatFixture(f Fixture) bool {
+	return strings.Contains(f.URL, "/live_chat")
+}
+
+// ParseChatFixture runs the live chat parser on a recorded chat page or get_live_chat response
+func ParseChatFixture(f Fixture) (*ChatPage, error) {
+	u, err := url.Parse(f.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(u.Path, "/youtubei/") {
+		return ParseChatResponse([]byte(f.Body))
+	}
+
+	req := &http.Request{Method: http.MethodGet, URL: u}
+	c, err := parseChatPage(f.Response(req), f.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &ChatPage{Messages: []ChatMessage{}, Continuation: c.continuation, Timeout: c.timeout}, nil
+}
+
+// SaveFixture writes a fixture to <dir>/<channel>/<time>.json
+func SaveFixture(dir string, f Fixture) error {
+	stamp := f.RecordedAt.Format(fixtureTimeFormat)
+	fn := filepath.Join(dir, f.Channel, fmt.Sprintf("%v.json", stamp))
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return err
+	}
+
+	body, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// redirects can be recorded in the same second, don't overwrite the earlier one.
+	// The counter goes past the highest one so a pruned name isn't reused out of order
+	same, err := filepath.Glob(filepath.Join(dir, f.Channel, stamp+"*.json"))
+	if err != nil {
+		return err
+	}
+	if len(same) > 0 {
+		last := 0
+		for _, s := range same {
+			if _, n := fixtureOrder(s); n > last {
+				last = n
+			}
+		}
+		fn = filepath.Join(dir, f.Channel, fmt.Sprintf("%v-%d.json", stamp, last+1))
+	}
+
+	return os.WriteFile(fn, body, 0644)
+}
+
+// LoadFixtures reads every fixture in dir and its sub directories, oldest first
+func LoadFixtures(dir string) ([]Fixture, error) {
+	list := make([]Fixture, 0)
+
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		var f Fixture
+		if err := json.Unmarshal(body, &f); err != nil {
+			return fmt.Errorf("failed to decode fixture: %v: %v", path, err)
+		}
+
+		list = append(list, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].RecordedAt.Before(list[j].RecordedAt)
+	})
+
+	return list, nil
+}
+
+// fixtureKey names the folder a response is saved in, the channel handle for channel pages
+func fixtureKey(u *url.URL) string {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	key := parts[0]
+	if key == "channel" && len(parts) > 1 {
+		key = parts[1]
+	}
+	// chat api requests are kept with the chat pages
+	if key == "youtubei" && len(parts) > 2 {
+		key = parts[2]
+	}
+	if key == "" {
+		key = u.Host
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == '?' || r == '*' {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+func sanitize(body string) string {
+	for _, r := range sanitizeRegex {
+		body = r.ReplaceAllString(body, "${1}SANITIZED${2}")
+	}
+	return body
+}
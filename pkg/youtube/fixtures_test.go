@@ -0,0 +1,145 @@
+package youtube
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const fixturesDir = "testdata/fixtures"
+
+func TestParseChannelFixtures(t *testing.T) {
+	list, err := LoadFixtures(filepath.Join(fixturesDir, "@dokibird"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]struct {
+		live  bool
+		id    string
+		title string
+	}{
+		"20261019T110000": {false, "nextDoki456", "karaoke later"},
+		"20261019T115900": {true, "liveDoki123", "morning zatsudan"},
+	}
+	if len(list) != len(want) {
+		t.Fatalf("got %v fixtures, want %v", len(list), len(want))
+	}
+
+	for _, f := range list {
+		key := f.RecordedAt.Format(fixtureTimeFormat)
+		w, ok := want[key]
+		if !ok {
+			t.Errorf("unexpected fixture %v", key)
+			continue
+		}
+
+		res, err := ParseFixture(f)
+		if err != nil {
+			t.Errorf("%v: %v", key, err)
+			continue
+		}
+		d := res.VideoDetails
+		if d.IsLive != w.live || d.VideoID != w.id || d.Title != w.title {
+			t.Errorf("%v: got live %v, id %v, title %q, want %+v", key, d.IsLive, d.VideoID, d.Title, w)
+		}
+	}
+}
+
+// every recorded fixture has to parse, or fail the way a finished or disabled chat does
+func TestParseAllFixtures(t *testing.T) {
+	list, err := LoadFixtures(fixturesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) == 0 {
+		t.Fatal("no fixtures")
+	}
+
+	for _, f := range list {
+		if IsChatFixture(f) {
+			_, err = ParseChatFixture(f)
+			if errors.Is(err, ErrChatEnded) || errors.Is(err, ErrChatDisabled) {
+				err = nil
+			}
+		} else {
+			_, err = ParseFixture(f)
+		}
+		if err != nil {
+			t.Errorf("%v %v: %v", f.Channel, f.RecordedAt.Format(fixtureTimeFormat), err)
+		}
+	}
+}
+
+// chat requests all post to the same url, replay has to tell them apart by continuation
+func TestReplayChat(t *testing.T) {
+	defer func(rt http.RoundTripper) { client.Transport = rt }(client.Transport)
+	Replay(fixturesDir)
+
+	c, err := OpenChat("abcdefghijk")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, _, err := c.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 5 {
+		t.Errorf("first poll: got %v messages, want 5", len(msgs))
+	}
+
+	if _, _, err := c.Next(); !errors.Is(err, ErrChatEnded) {
+		t.Errorf("second poll: got %v, want %v", err, ErrChatEnded)
+	}
+}
+
+func TestReplayMissing(t *testing.T) {
+	defer func(rt http.RoundTripper) { client.Transport = rt }(client.Transport)
+	Replay(fixturesDir)
+
+	if _, err := client.Get("https://www.youtube.com/@dokibird/streams"); err == nil {
+		t.Error("expected an error for a url that wasn't recorded")
+	}
+}
+
+type countingTransport struct{ n int }
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.n++
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/html"}},
+		Body:       io.NopCloser(strings.NewReader(fmt.Sprintf("response %d", t.n))),
+		Request:    req,
+	}, nil
+}
+
+func TestRecordKeepsNewest(t *testing.T) {
+	dir := t.TempDir()
+	c := &http.Client{Transport: &RecordTransport{Dir: dir, Max: 3, Base: &countingTransport{}}}
+
+	for i := 0; i < 5; i++ {
+		resp, err := c.Get("https://www.youtube.com/@dokibird/streams")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	list, err := LoadFixtures(filepath.Join(dir, "@dokibird"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0, len(list))
+	for _, f := range list {
+		got = append(got, f.Body)
+	}
+	if len(got) != 3 || got[0] != "response 3" || got[2] != "response 5" {
+		t.Errorf("got %q, want the last 3 responses", got)
+	}
+}
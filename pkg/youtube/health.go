@@ -0,0 +1,163 @@
+package youtube
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	backoffBase = time.Minute
+	backoffMax  = time.Hour
+
+	// how much a backoff may randomly vary so channels don't all retry together
+	backoffJitter = 0.2
+)
+
+// ChannelHealth tracks fetch failures for a single channel
+type ChannelHealth struct {
+	Channel             string    `json:"channel"`
+	Handle              string    `json:"handle"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	LastError           string    `json:"lastError"`
+	LastErrorTime       time.Time `json:"lastErrorTime"`
+	LastSuccess         time.Time `json:"lastSuccess"`
+	NextAttempt         time.Time `json:"nextAttempt"`
+}
+
+// Broken returns true if the channel is currently backing off
+func (h ChannelHealth) Broken() bool {
+	return h.ConsecutiveFailures > 0
+}
+
+type healthTracker struct {
+	mu       sync.Mutex
+	channels map[string]*ChannelHealth
+	last     map[string]VideoDetails
+
+	// global slowdown when youtube starts throttling us
+	slowdownLevel int
+	slowdownUntil time.Time
+}
+
+var tracker = &healthTracker{
+	channels: make(map[string]*ChannelHealth, 0),
+	last:     make(map[string]VideoDetails, 0),
+}
+
+// Health returns a snapshot of the health of every channel that has been checked
+func Health() []ChannelHealth {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	list := make([]ChannelHealth, 0, len(tracker.channels))
+	for _, v := range tracker.channels {
+		list = append(list, *v)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Channel < list[j].Channel
+	})
+
+	return list
+}
+
+// SlowdownUntil returns the time when the global slowdown ends, zero if there is none
+func SlowdownUntil() time.Time {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	if time.Now().After(tracker.slowdownUntil) {
+		return time.Time{}
+	}
+	return tracker.slowdownUntil
+}
+
+// ready returns true if the channel may be fetched now
+func (t *healthTracker) ready(name, handle string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if now.Before(t.slowdownUntil) {
+		return false
+	}
+
+	h := t.get(name, handle)
+	return !now.Before(h.NextAttempt)
+}
+
+func (t *healthTracker) success(name, handle string, res VideoDetails, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h := t.get(name, handle)
+	h.ConsecutiveFailures = 0
+	h.LastSuccess = now
+	h.NextAttempt = time.Time{}
+	t.last[name] = res
+
+	t.slowdownLevel = 0
+}
+
+func (t *healthTracker) failure(name, handle string, err error, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h := t.get(name, handle)
+	h.ConsecutiveFailures++
+	h.LastError = err.Error()
+	h.LastErrorTime = now
+	h.NextAttempt = now.Add(backoff(h.ConsecutiveFailures))
+
+	if isSlowdown(err) {
+		t.slowdownLevel++
+		t.slowdownUntil = now.Add(backoff(t.slowdownLevel))
+	}
+}
+
+// lastKnown returns the last successful result for a channel that is being skipped, marked stale.
+// The stream may have ended since, so it isn't reported as live
+func (t *healthTracker) lastKnown(name string) (VideoDetails, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	v, ok := t.last[name]
+	if ok {
+		v.Stale = true
+		v.VideoDetails.IsLive = false
+	}
+	return v, ok
+}
+
+func (t *healthTracker) get(name, handle string) *ChannelHealth {
+	h, ok := t.channels[name]
+	if !ok || h.Handle != handle {
+		// a new or changed handle starts out healthy
+		h = &ChannelHealth{Channel: name, Handle: handle}
+		t.channels[name] = h
+		delete(t.last, name)
+	}
+	return h
+}
+
+// isSlowdown returns true for errors that mean youtube is throttling every request, not just this channel
+func isSlowdown(err error) bool {
+	return errors.Is(err, ErrRateLimited) || isInterstitial(err)
+}
+
+// backoff returns an exponential delay with jitter for the given number of failures
+func backoff(failures int) time.Duration {
+	if failures < 1 {
+		return 0
+	}
+
+	d := float64(backoffBase) * math.Pow(2, float64(failures-1))
+	if d > float64(backoffMax) {
+		d = float64(backoffMax)
+	}
+	d += d * backoffJitter * (rand.Float64()*2 - 1)
+
+	return time.Duration(d)
+}
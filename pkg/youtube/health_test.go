@@ -0,0 +1,144 @@
+package youtube
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newTracker() *healthTracker {
+	return &healthTracker{
+		channels: make(map[string]*ChannelHealth, 0),
+		last:     make(map[string]VideoDetails, 0),
+	}
+}
+
+func TestLastKnownIsNotLive(t *testing.T) {
+	h := newTracker()
+	now := time.Now()
+
+	var live VideoDetails
+	live.VideoDetails.VideoID = "aaaaaaaaaaa"
+	live.VideoDetails.Title = "stream"
+	live.VideoDetails.IsLive = true
+	h.success("a", "@a", live, now)
+	h.failure("a", "@a", errors.New("timeout"), now)
+
+	last, ok := h.lastKnown("a")
+	if !ok {
+		t.Fatal("expected a last known status")
+	}
+	if last.VideoDetails.IsLive || !last.Stale {
+		t.Errorf("stale status should not be live: live %v, stale %v", last.VideoDetails.IsLive, last.Stale)
+	}
+	if last.VideoDetails.VideoID != "aaaaaaaaaaa" || last.VideoDetails.Title != "stream" {
+		t.Errorf("metadata not kept: %+v", last.VideoDetails)
+	}
+
+	// the saved result is left alone
+	if !h.last["a"].VideoDetails.IsLive {
+		t.Error("saved result was changed")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	if d := backoff(0); d != 0 {
+		t.Errorf("got %v with no failures, want 0", d)
+	}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{6, 32 * time.Minute},
+		// capped from here on
+		{7, time.Hour},
+		{30, time.Hour},
+	}
+	for _, tt := range tests {
+		lo := time.Duration(float64(tt.want) * (1 - backoffJitter))
+		hi := time.Duration(float64(tt.want) * (1 + backoffJitter))
+		for i := 0; i < 20; i++ {
+			if d := backoff(tt.failures); d < lo || d > hi {
+				t.Errorf("%v failures: got %v, want %v give or take the jitter", tt.failures, d, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestReadyAfterNextAttempt(t *testing.T) {
+	h := newTracker()
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	if !h.ready("a", "@a", now) {
+		t.Fatal("a new channel isn't ready")
+	}
+
+	h.failure("a", "@a", errors.New("timeout"), now)
+	next := h.channels["a"].NextAttempt
+	if !next.After(now) {
+		t.Fatalf("next attempt %v isn't after the failure", next)
+	}
+	if h.ready("a", "@a", next.Add(-time.Second)) {
+		t.Error("ready before the next attempt")
+	}
+	if !h.ready("a", "@a", next) {
+		t.Error("not ready at the next attempt")
+	}
+	if !h.ready("b", "@b", now) {
+		t.Error("another channel is skipped over a single channel's failure")
+	}
+
+	// a changed handle starts out healthy
+	if !h.ready("a", "@a2", now) {
+		t.Error("a changed handle is still backing off")
+	}
+}
+
+func TestSlowdown(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		err      error
+		slowdown bool
+	}{
+		{fmt.Errorf("%w: https://www.youtube.com/@a/live", ErrRateLimited), true},
+		{fmt.Errorf("%w: https://www.youtube.com/sorry/index", ErrCaptcha), true},
+		{fmt.Errorf("%w: https://consent.youtube.com/m", ErrConsentRequired), true},
+		{fmt.Errorf("%w: https://www.youtube.com/@a/live", ErrBotCheck), true},
+		{errors.New("unexpected EOF"), false},
+	}
+	for _, tt := range tests {
+		h := newTracker()
+		h.failure("a", "@a", tt.err, now)
+
+		// another channel that hasn't failed is held back too
+		later := now.Add(30 * time.Second)
+		if got := !h.ready("b", "@b", later); got != tt.slowdown {
+			t.Errorf("%v: slowed down %v, want %v", tt.err, got, tt.slowdown)
+		}
+		if !h.ready("b", "@b", now.Add(2*time.Minute)) {
+			t.Errorf("%v: the slowdown didn't end", tt.err)
+		}
+	}
+
+	// the slowdown grows while youtube keeps throttling and ends with the first success
+	h := newTracker()
+	h.failure("a", "@a", ErrRateLimited, now)
+	first := h.slowdownUntil.Sub(now)
+	h.failure("b", "@b", ErrRateLimited, now)
+	if second := h.slowdownUntil.Sub(now); second <= first {
+		t.Errorf("got %v after a second throttled request, want more than %v", second, first)
+	}
+
+	h.success("c", "@c", VideoDetails{}, now)
+	h.failure("a", "@a", ErrRateLimited, now)
+	if d := h.slowdownUntil.Sub(now); d > time.Duration(float64(backoffBase)*(1+backoffJitter)) {
+		t.Errorf("got %v after a success, want the slowdown to start over", d)
+	}
+}
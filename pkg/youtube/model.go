@@ -3,6 +3,7 @@ package youtube
 type VideoDetails struct {
 	PlayabilityStatus map[string]interface{} `json:"playabilityStatus"`
 	VideoDetails      videoDetails           `json:"videoDetails"`
+	Stale             bool                   `json:"stale,omitempty"` // last known details of a channel that couldn't be checked, never live
 }
 type videoDetails struct {
 	Author    string          `json:"author"`
@@ -12,9 +13,9 @@ type videoDetails struct {
 	Thumbnail thumbnailObject `json:"thumbnail"`
 }
 type thumbnailObject struct {
-	Thumbnails []thumbnailDetails `json:"thumbnails"`
+	Thumbnails []Thumbnail `json:"thumbnails"`
 }
-type thumbnailDetails struct {
+type Thumbnail struct {
 	Url    string `json:"url"`
 	Width  int    `json:"width"`
 	Height int    `json:"height"`
@@ -50,5 +51,12 @@ func (d *VideoDetails) GetThumbnail() string {
 		}
 	}
 
+	if len(d.VideoDetails.Thumbnail.Thumbnails) == 0 {
+		return ""
+	}
 	return d.VideoDetails.Thumbnail.Thumbnails[0].Url
 }
+
+func (d *VideoDetails) GetThumbnails() []Thumbnail {
+	return d.VideoDetails.Thumbnail.Thumbnails
+}
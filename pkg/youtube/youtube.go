@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"time"
 )
 
 var (
@@ -36,16 +37,36 @@ func GetAllChannelStatus(channels map[string]string) map[string]VideoDetails {
 
 	// record stream status
 	for k, v := range channels {
+		now := time.Now()
+
+		// channels that are backing off keep their last known details, marked stale and not live
+		if !tracker.ready(k, v, now) {
+			if last, ok := tracker.lastKnown(k); ok {
+				streamInfo[k] = last
+			}
+			continue
+		}
+
 		res, err := getChannelLiveStatus(v)
 		if err != nil {
-			log.Printf("failed to get live status for channel: %v - %v\n%s\n", v, k, err.Error())
+			if isInterstitial(err) {
+				log.Printf("youtube blocked the request for channel: %v - %v\n%s\n", v, k, err.Error())
+			} else {
+				log.Printf("failed to get live status for channel: %v - %v\n%s\n", v, k, err.Error())
+			}
+			tracker.failure(k, v, err, now)
+			if last, ok := tracker.lastKnown(k); ok {
+				streamInfo[k] = last
+			}
 			continue
 		}
 
 		// log.Printf("Channel: %v, Live: %v, ID: %v, Title: %v\n", k, res.VideoDetails.IsLive, res.VideoDetails.VideoID, res.VideoDetails.Title)
+		tracker.success(k, v, *res, now)
 		streamInfo[k] = *res
 	}
 
+	saveCookies()
 	return streamInfo
 }
 
@@ -54,7 +75,7 @@ func GetAllChannelStatus(channels map[string]string) map[string]VideoDetails {
 func getLiveStatus(channelID string) (bool, *searchItem, error) {
 
 	queryChannel := fmt.Sprintf("%v?part=snippet&channelId=%v&type=video&eventType=live&key=%v", GOOGLE_API_SEARCH_ENDPOINT, channelID, YT_API_KEY)
-	resp, err := http.Get(queryChannel)
+	resp, err := client.Get(queryChannel)
 	if err != nil {
 		return false, nil, err
 	}
@@ -87,11 +108,13 @@ func getChannelLiveStatus(channelID string) (*VideoDetails, error) {
 
 	query := "https://www.youtube.com/" + channelID + "/live"
 
-	resp, err := http.Get(query)
+	resp, err := client.Get(query)
 	if err != nil {
 		return nil, fmt.Errorf("error occurred getting youtube page: %v: %v\n", query, err)
 	}
 
+	defer resp.Body.Close()
+
 	// log.Printf("getChannelLiveStatus: %v, statusCode: %v\n", query, resp.StatusCode)
 
 	// read response body
@@ -100,7 +123,17 @@ func getChannelLiveStatus(channelID string) (*VideoDetails, error) {
 		return nil, fmt.Errorf("error occurred trying to read response body: %v: %v\n", query, err)
 	}
 
-	b := string(body)
+	return parseChannelPage(resp, string(body))
+}
+
+// parseChannelPage reads the live status from a channel's live page
+func parseChannelPage(resp *http.Response, b string) (*VideoDetails, error) {
+
+	// consent, bot check and captcha pages replace the channel page entirely
+	if err := checkInterstitial(resp, b); err != nil {
+		return nil, err
+	}
+
 	mr := ytirRegex.MatchString(b)
 	// log.Printf("matched initial response: %v\n", mr)
 	if !mr {
@@ -114,9 +147,9 @@ func getChannelLiveStatus(channelID string) (*VideoDetails, error) {
 
 	var res VideoDetails
 	rb := bytes.NewReader([]byte(values[0][1]))
-	err = json.NewDecoder(rb).Decode(&res)
+	err := json.NewDecoder(rb).Decode(&res)
 	if err != nil {
-		log.Fatalf("failed to decode response: %v\n", err)
+		return nil, fmt.Errorf("failed to decode response: %v", err)
 	}
 
 	return &res, nil
@@ -129,7 +162,7 @@ func checkYoutubePage(channelID string) (bool, string, string) {
 
 	fmt.Println("Searching Page: " + query)
 
-	resp, err := http.Get(query)
+	resp, err := client.Get(query)
 	if err != nil {
 		log.Printf("error occurred getting youtube page: %v: %v\n", query, err)
 		return false, "", ""